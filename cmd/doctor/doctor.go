@@ -0,0 +1,62 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package doctor
+
+import (
+	"os"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/marlinprotocol/ctl2/modules/doctor"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// DoctorCmd represents the doctor command
+var DoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check host and marlinctl state for common problems",
+	Long: `Check availability of runtimes, access to supervisor, freshness and integrity of registry, checksums
+of installed binaries, keystores of projects and drift between resource files and supervisor confs.
+Suggests a fix for every problem found. Exits with 1 if any check fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		results := doctor.Run()
+
+		t := util.GetTable()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Check", "Status", "Detail"})
+		for _, r := range results {
+			t.AppendRow(table.Row{r.Check, r.Status, r.Detail})
+		}
+		t.Render()
+
+		for _, r := range results {
+			if r.Fix == "" {
+				continue
+			}
+			if r.Status == doctor.StatusFail {
+				log.Error(r.Check, ": ", r.Fix)
+			} else {
+				log.Warning(r.Check, ": ", r.Fix)
+			}
+		}
+
+		if doctor.HasFailures(results) {
+			os.Exit(1)
+		}
+		log.Info("No failing checks")
+	},
+}
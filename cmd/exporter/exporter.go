@@ -0,0 +1,50 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package exporter
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/marlinprotocol/ctl2/modules/exporter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var listenAddr string
+
+// ExporterCmd represents the exporter command
+var ExporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Serve prometheus metrics of instances managed by marlinctl",
+	Long:  `Serve prometheus metrics of instances managed by marlinctl on /metrics`,
+	Run: func(cmd *cobra.Command, args []string) {
+		e := exporter.NewExporter()
+		e.Start()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", e)
+		log.Info("Serving metrics on ", listenAddr, "/metrics")
+		err := http.ListenAndServe(listenAddr, mux)
+		if err != nil {
+			log.Error("Error while serving metrics: ", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	ExporterCmd.Flags().StringVar(&listenAddr, "listen", ":9123", "address to serve metrics on")
+}
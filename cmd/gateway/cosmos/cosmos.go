@@ -38,9 +38,12 @@ func init() {
 		appcommands.CommandDetails{Use: "destroy", DescShort: "Destroy gateway for cosmos blockchain", DescLong: "Destroy gateway for cosmos blockchain"},
 		appcommands.CommandDetails{Use: "logs", DescShort: "Tail logs for running gateway (cosmos) instances", DescLong: "Tail logs for running gateway (cosmos) instances"},
 		appcommands.CommandDetails{Use: "status", DescShort: "Show status of currently running gateway (cosmos) instances", DescLong: "Show status of currently running gateway (cosmos) instances"},
+		appcommands.CommandDetails{Use: "health", DescShort: "Check health of gateway (cosmos) instances", DescLong: "Check health of gateway (cosmos) instances. Exits with 0 when healthy, 1 on warnings, 2 when critical and 3 when health is unknown"},
 		appcommands.CommandDetails{Use: "recreate", DescShort: "Recreate end to end gateway (cosmos) instances", DescLong: "Recreate end to end gateway (cosmos) instances"},
 		appcommands.CommandDetails{Use: "restart", DescShort: "Restart services for gateway (cosmos) instances", DescLong: "Restart services for gateway (cosmos) instances"},
+		appcommands.CommandDetails{Use: "upgrade", DescShort: "Upgrade gateway (cosmos) instances to a different version", DescLong: "Upgrade gateway (cosmos) instances to a different version"},
 		appcommands.CommandDetails{Use: "versions", DescShort: "Show available versions for use", DescLong: "Show available versions for use"},
+		appcommands.CommandDetails{Use: "adopt", DescShort: "Adopt gateway (cosmos) programs set up outside of marlinctl", DescLong: "Adopt supervisor programs of gateway (cosmos) set up outside of marlinctl by writing a resource file for them, so that they can be managed using marlinctl"},
 
 		appcommands.CommandDetails{Use: "show", DescShort: "Show current configuration residing on disk", DescLong: "Show current configuration residing on disk"},
 		appcommands.CommandDetails{Use: "diff", DescShort: "Show soft modifications to config staged for apply", DescLong: "Show soft modifications to config staged for apply"},
@@ -50,6 +53,17 @@ func init() {
 
 		appcommands.CommandDetails{Use: "create", DescShort: "Create keystore", DescLong: "Create keystore"},
 		appcommands.CommandDetails{Use: "destroy", DescShort: "Destroy keystore", DescLong: "Destroy keystore"},
+		appcommands.CommandDetails{Use: "import", DescShort: "Import existing account into keystore", DescLong: "Import existing account into keystore from an encrypted JSON keystore or a hex encoded private key"},
+		appcommands.CommandDetails{Use: "export", DescShort: "Export account from keystore", DescLong: "Export account from keystore as encrypted JSON keystore"},
+		appcommands.CommandDetails{Use: "list", DescShort: "List accounts in keystore", DescLong: "List addresses of accounts in keystore along with the one used by default"},
+		appcommands.CommandDetails{Use: "show", DescShort: "Show account in keystore", DescLong: "Show address, files and instances using an account in keystore"},
+		appcommands.CommandDetails{Use: "select", DescShort: "Select account used by default", DescLong: "Select account of keystore used by default when creating instances"},
+		appcommands.CommandDetails{Use: "migrate-secret", DescShort: "Move keystore passphrase to a different backend", DescLong: "Move passphrase of keystore out of its plain file into systemd-creds, kernel keyring, an external command or an environment variable, or back into a file readable only by its owner"},
+		appcommands.CommandDetails{Use: "rotate-passphrase", DescShort: "Change keystore passphrase", DescLong: "Re-encrypt keystore with a new passphrase, store new passphrase where old one was kept and restart instances using keystore"},
+		appcommands.CommandDetails{Use: "backup", DescShort: "Back up keystore", DescLong: "Write accounts of keystore along with their passphrases into an encrypted backup file"},
+		appcommands.CommandDetails{Use: "restore", DescShort: "Restore keystore from backup", DescLong: "Add accounts held in an encrypted backup file to keystore, leaving accounts already in keystore untouched"},
+		appcommands.CommandDetails{Use: "sign", DescShort: "Sign a message using keystore", DescLong: "Sign a message as an EIP-191 personal message using an account of keystore, to prove control of its address without the key leaving keystore"},
+		appcommands.CommandDetails{Use: "verify", DescShort: "Verify a signed message", DescLong: "Verify that an EIP-191 personal signature of a message was made by an address, default account of keystore if none is given"},
 	)
 	if err != nil {
 		log.Error("Error while creating gateway_cosmos application command tree")
@@ -60,9 +74,12 @@ func init() {
 	CosmosCmd.AddCommand(app.DestroyCmd.Cmd)
 	CosmosCmd.AddCommand(app.LogsCmd.Cmd)
 	CosmosCmd.AddCommand(app.StatusCmd.Cmd)
+	CosmosCmd.AddCommand(app.HealthCmd.Cmd)
 	CosmosCmd.AddCommand(app.RecreateCmd.Cmd)
 	CosmosCmd.AddCommand(app.RestartCmd.Cmd)
+	CosmosCmd.AddCommand(app.UpgradeCmd.Cmd)
 	CosmosCmd.AddCommand(app.VersionsCmd.Cmd)
+	CosmosCmd.AddCommand(app.AdoptCmd.Cmd)
 
 	configCmd := &cobra.Command{Use: "config", Short: "Configurations of project set on disk", Long: "Configurations of project set on disk"}
 	CosmosCmd.AddCommand(configCmd)
@@ -72,10 +89,37 @@ func init() {
 	configCmd.AddCommand(app.ConfigResetCmd.Cmd)
 	configCmd.AddCommand(app.ConfigApplyCmd.Cmd)
 
-	keystoreCmd := &cobra.Command{Use: "keystore", Short: "Create or Destroy keystore", Long: "Create or Destroy keystore"}
+	keystoreCmd := &cobra.Command{Use: "keystore", Short: "Manage keystore", Long: "Create, import, export, back up, restore, list or destroy accounts of keystore, and sign messages using them"}
 	CosmosCmd.AddCommand(keystoreCmd)
 	keystoreCmd.AddCommand(app.KeystoreCreateCmd.Cmd)
 	keystoreCmd.AddCommand(app.KeystoreDestroyCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreImportCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreExportCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreListCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreShowCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreSelectCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreMigrateCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreRotateCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreBackupCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreRestoreCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreSignCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreVerifyCmd.Cmd)
+
+	app.SetupKeyfileCommands(projectRunners.KeyfileChain, projectRunners.KeyfileGenerator,
+		appcommands.CommandDetails{Use: "show", DescShort: "Show keyfile and node id of instances", DescLong: "Show keyfile used by instances, or to be used once they are created, along with node id it holds"},
+		appcommands.CommandDetails{Use: "generate", DescShort: "Generate keyfile for instances yet to be created", DescLong: "Generate keyfile for instances yet to be created, so that their node id is known in advance. Instances generate their keyfile on create otherwise"},
+		appcommands.CommandDetails{Use: "import", DescShort: "Import keyfile for an instance yet to be created", DescLong: "Import an existing keyfile for an instance yet to be created, so that it keeps node id of gateway it replaces"},
+		appcommands.CommandDetails{Use: "rotate", DescShort: "Replace keyfile of running instances", DescLong: `Replace keyfile of instances with a newly generated one, or one imported using --file, and restart their
+gateway. Node id of instance changes unless imported keyfile holds same key. Replaced keyfile is kept alongside
+with a timestamped .old suffix. --file can only be given when replacing keyfile of a single instance.`},
+	)
+
+	keyfileCmd := &cobra.Command{Use: "keyfile", Short: "Manage keyfiles of gateway (cosmos) instances", Long: "Manage keyfiles holding keys gateway (cosmos) instances identify themselves with to their peers, one per instance. Keyfile of a destroyed instance is kept alongside with a timestamped .destroyed suffix"}
+	CosmosCmd.AddCommand(keyfileCmd)
+	keyfileCmd.AddCommand(app.KeyfileShowCmd.Cmd)
+	keyfileCmd.AddCommand(app.KeyfileGenerateCmd.Cmd)
+	keyfileCmd.AddCommand(app.KeyfileImportCmd.Cmd)
+	keyfileCmd.AddCommand(app.KeyfileRotateCmd.Cmd)
 
 	// Extra flag additions for gateway_cosmos -----------------------------------------------
 	keystorePath, keystorePassPath, _ := keystore.GetKeystoreDetails("gateway_cosmos")
@@ -86,6 +130,7 @@ func init() {
 	app.CreateCmd.ArgStore["internal-listen-addr"] = app.CreateCmd.Cmd.Flags().StringP("internal-listen-address", "l", "127.0.0.1:22401", "Bridge listen address")
 	app.CreateCmd.ArgStore["keystore-path"] = app.CreateCmd.Cmd.Flags().StringP("keystore-path", "k", keystorePath, "Keystore Path")
 	app.CreateCmd.ArgStore["keystore-pass-path"] = app.CreateCmd.Cmd.Flags().StringP("keystore-pass-path", "y", keystorePassPath, "Keystore pass path")
+	app.CreateCmd.ArgStore["keystore"] = app.CreateCmd.Cmd.Flags().String("keystore", "", "Name of shared keystore to use default account of, instead of keystore-path")
 	app.CreateCmd.ArgStore["contracts"] = app.CreateCmd.Cmd.Flags().StringP("contracts", "c", "mainnet", "mainnet/kovan")
 	app.CreateCmd.ArgStore["gateway-listen-port-peer"] = app.CreateCmd.Cmd.Flags().StringP("gateway-listen-port-peer", "g", "22400", "port on which TMCore dials for connection")
 	app.CreateCmd.ArgStore["gateway-direction"] = app.CreateCmd.Cmd.Flags().StringP("gateway-direction", "z", "producer", "gateway usage direction (producer/consumer/both)")
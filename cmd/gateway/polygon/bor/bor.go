@@ -38,9 +38,12 @@ func init() {
 		appcommands.CommandDetails{Use: "destroy", DescShort: "Destroy gateway for bor blockchain", DescLong: "Destroy gateway for bor blockchain"},
 		appcommands.CommandDetails{Use: "logs", DescShort: "Tail logs for running gateway (bor) instances", DescLong: "Tail logs for running gateway (bor) instances"},
 		appcommands.CommandDetails{Use: "status", DescShort: "Show status of currently running gateway (bor) instances", DescLong: "Show status of currently running gateway (bor) instances"},
+		appcommands.CommandDetails{Use: "health", DescShort: "Check health of gateway (bor) instances", DescLong: "Check health of gateway (bor) instances. Exits with 0 when healthy, 1 on warnings, 2 when critical and 3 when health is unknown"},
 		appcommands.CommandDetails{Use: "recreate", DescShort: "Recreate end to end gateway (bor) instances", DescLong: "Recreate end to end gateway (bor) instances"},
 		appcommands.CommandDetails{Use: "restart", DescShort: "Restart services for gateway (bor) instances", DescLong: "Restart services for gateway (bor) instances"},
+		appcommands.CommandDetails{Use: "upgrade", DescShort: "Upgrade gateway (bor) instances to a different version", DescLong: "Upgrade gateway (bor) instances to a different version"},
 		appcommands.CommandDetails{Use: "versions", DescShort: "Show available versions for use", DescLong: "Show available versions for use"},
+		appcommands.CommandDetails{Use: "adopt", DescShort: "Adopt gateway (bor) programs set up outside of marlinctl", DescLong: "Adopt supervisor programs of gateway (bor) set up outside of marlinctl by writing a resource file for them, so that they can be managed using marlinctl"},
 
 		appcommands.CommandDetails{Use: "show", DescShort: "Show current configuration residing on disk", DescLong: "Show current configuration residing on disk"},
 		appcommands.CommandDetails{Use: "diff", DescShort: "Show soft modifications to config staged for apply", DescLong: "Show soft modifications to config staged for apply"},
@@ -50,6 +53,17 @@ func init() {
 
 		appcommands.CommandDetails{Use: "create", DescShort: "Create keystore", DescLong: "Create keystore"},
 		appcommands.CommandDetails{Use: "destroy", DescShort: "Destroy keystore", DescLong: "Destroy keystore"},
+		appcommands.CommandDetails{Use: "import", DescShort: "Import existing account into keystore", DescLong: "Import existing account into keystore from an encrypted JSON keystore or a hex encoded private key"},
+		appcommands.CommandDetails{Use: "export", DescShort: "Export account from keystore", DescLong: "Export account from keystore as encrypted JSON keystore"},
+		appcommands.CommandDetails{Use: "list", DescShort: "List accounts in keystore", DescLong: "List addresses of accounts in keystore along with the one used by default"},
+		appcommands.CommandDetails{Use: "show", DescShort: "Show account in keystore", DescLong: "Show address, files and instances using an account in keystore"},
+		appcommands.CommandDetails{Use: "select", DescShort: "Select account used by default", DescLong: "Select account of keystore used by default when creating instances"},
+		appcommands.CommandDetails{Use: "migrate-secret", DescShort: "Move keystore passphrase to a different backend", DescLong: "Move passphrase of keystore out of its plain file into systemd-creds, kernel keyring, an external command or an environment variable, or back into a file readable only by its owner"},
+		appcommands.CommandDetails{Use: "rotate-passphrase", DescShort: "Change keystore passphrase", DescLong: "Re-encrypt keystore with a new passphrase, store new passphrase where old one was kept and restart instances using keystore"},
+		appcommands.CommandDetails{Use: "backup", DescShort: "Back up keystore", DescLong: "Write accounts of keystore along with their passphrases into an encrypted backup file"},
+		appcommands.CommandDetails{Use: "restore", DescShort: "Restore keystore from backup", DescLong: "Add accounts held in an encrypted backup file to keystore, leaving accounts already in keystore untouched"},
+		appcommands.CommandDetails{Use: "sign", DescShort: "Sign a message using keystore", DescLong: "Sign a message as an EIP-191 personal message using an account of keystore, to prove control of its address without the key leaving keystore"},
+		appcommands.CommandDetails{Use: "verify", DescShort: "Verify a signed message", DescLong: "Verify that an EIP-191 personal signature of a message was made by an address, default account of keystore if none is given"},
 	)
 	if err != nil {
 		log.Error("Error while creating gateway_polygonbor application command tree")
@@ -60,9 +74,12 @@ func init() {
 	BorCmd.AddCommand(app.DestroyCmd.Cmd)
 	BorCmd.AddCommand(app.LogsCmd.Cmd)
 	BorCmd.AddCommand(app.StatusCmd.Cmd)
+	BorCmd.AddCommand(app.HealthCmd.Cmd)
 	BorCmd.AddCommand(app.RecreateCmd.Cmd)
 	BorCmd.AddCommand(app.RestartCmd.Cmd)
+	BorCmd.AddCommand(app.UpgradeCmd.Cmd)
 	BorCmd.AddCommand(app.VersionsCmd.Cmd)
+	BorCmd.AddCommand(app.AdoptCmd.Cmd)
 
 	configCmd := &cobra.Command{Use: "config", Short: "Configurations of project set on disk", Long: "Configurations of project set on disk"}
 	BorCmd.AddCommand(configCmd)
@@ -72,10 +89,35 @@ func init() {
 	configCmd.AddCommand(app.ConfigResetCmd.Cmd)
 	configCmd.AddCommand(app.ConfigApplyCmd.Cmd)
 
-	keystoreCmd := &cobra.Command{Use: "keystore", Short: "Create or Destroy keystore", Long: "Create or Destroy keystore"}
+	keystoreCmd := &cobra.Command{Use: "keystore", Short: "Manage keystore", Long: "Create, import, export, back up, restore, list or destroy accounts of keystore, and sign messages using them"}
 	BorCmd.AddCommand(keystoreCmd)
 	keystoreCmd.AddCommand(app.KeystoreCreateCmd.Cmd)
 	keystoreCmd.AddCommand(app.KeystoreDestroyCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreImportCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreExportCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreListCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreShowCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreSelectCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreMigrateCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreRotateCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreBackupCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreRestoreCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreSignCmd.Cmd)
+	keystoreCmd.AddCommand(app.KeystoreVerifyCmd.Cmd)
+
+	app.SetupMevProxyCommands(
+		appcommands.CommandDetails{Use: "status", DescShort: "Show status of MEV proxy", DescLong: "Show supervisor state of MEV proxy along with whether bor JSON-RPC endpoint it forwards bundles to answers eth_chainId"},
+		appcommands.CommandDetails{Use: "restart", DescShort: "Restart MEV proxy", DescLong: "Restart MEV proxy leaving gateway running, once bor JSON-RPC endpoint it forwards bundles to answers eth_chainId"},
+		appcommands.CommandDetails{Use: "reconfigure", DescShort: "Change configuration of MEV proxy", DescLong: "Change addresses MEV proxy listens on and forwards bundles to, or enable or disable it, restarting only MEV proxy. Bor JSON-RPC endpoint has to answer eth_chainId before MEV proxy is started."},
+		appcommands.CommandDetails{Use: "logs", DescShort: "Tail logs of MEV proxy", DescLong: "Tail logs of MEV proxy run alongside gateway (bor) instances"},
+	)
+
+	mevProxyCmd := &cobra.Command{Use: "mevproxy", Short: "Manage MEV proxy run alongside gateway (bor) instances", Long: "Manage MEV proxy run alongside gateway (bor) instances, leaving gateway running"}
+	BorCmd.AddCommand(mevProxyCmd)
+	mevProxyCmd.AddCommand(app.MevProxyStatusCmd.Cmd)
+	mevProxyCmd.AddCommand(app.MevProxyRestartCmd.Cmd)
+	mevProxyCmd.AddCommand(app.MevProxyReconfigureCmd.Cmd)
+	mevProxyCmd.AddCommand(app.MevProxyLogsCmd.Cmd)
 
 	// Extra flag additions for gateway_polygonbor -----------------------------------------------
 	keystorePath, keystorePassPath, _ := keystore.GetKeystoreDetails("gateway_polygonbor")
@@ -85,10 +127,12 @@ func init() {
 	app.CreateCmd.ArgStore["bootstrap-addr"] = app.CreateCmd.Cmd.Flags().StringP("bootstrap-addr", "b", "", "bootstrap address")
 	app.CreateCmd.ArgStore["keystore-path"] = app.CreateCmd.Cmd.Flags().StringP("keystore-path", "k", keystorePath, "keystore Path")
 	app.CreateCmd.ArgStore["keystore-pass-path"] = app.CreateCmd.Cmd.Flags().StringP("keystore-pass-path", "y", keystorePassPath, "keystore pass path")
+	app.CreateCmd.ArgStore["keystore"] = app.CreateCmd.Cmd.Flags().String("keystore", "", "Name of shared keystore to use default account of, instead of keystore-path")
 	app.CreateCmd.ArgStore["contracts"] = app.CreateCmd.Cmd.Flags().StringP("contracts", "c", "mainnet", "mainnet/kovan")
 	app.CreateCmd.ArgStore["spamcheck-addr"] = app.CreateCmd.Cmd.Flags().StringP("spamcheck-addr", "z", "", "spamcheck address")
 	app.CreateCmd.ArgStore["mevproxy-listen-addr"] = app.CreateCmd.Cmd.Flags().StringP("mevproxy-listen-addr", "m", "0.0.0.0:18545", "endpoint to recieve MEV bundles on")
 	app.CreateCmd.ArgStore["mevproxy-bundle-addr"] = app.CreateCmd.Cmd.Flags().StringP("bundle-addr", "j", "http://127.0.0.1:8545", "polygon bor JSON RPC endpoint")
 	app.CreateCmd.ArgStore["subgraph-path"] = app.CreateCmd.Cmd.Flags().StringP("subgraph-path", "g", "/marlinprotocol/mev-bor", "subgraph url")
+	app.CreateCmd.ArgStore["disable-mevproxy"] = app.CreateCmd.Cmd.Flags().Bool("disable-mevproxy", false, "run gateway without MEV proxy, for deployments not relaying MEV bundles")
 	// ----------------------------------------------------------------------------------
 }
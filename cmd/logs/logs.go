@@ -0,0 +1,105 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package logs
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/runner"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	archiveOutput   string
+	archiveProjects []string
+	archiveSince    string
+)
+
+// LogsCmd represents the logs command
+var LogsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Manage logs of resources spawned by marlinctl",
+	Long:  `Manage logs of resources spawned by marlinctl`,
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Bundle logs of resources into a tarball",
+	Long:  `Bundle logs of resources, including rotated logs and supervisor log, into a gzipped tarball to attach to a support ticket`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var since time.Time
+		if archiveSince != "" {
+			var err error
+			since, err = runner.ParseLogTime(archiveSince)
+			if err != nil {
+				log.Error("Invalid --since: ", err)
+				os.Exit(1)
+			}
+		}
+		selected := make(map[string]bool)
+		for _, p := range archiveProjects {
+			selected[p] = true
+		}
+
+		instances, err := projects.GetInstances()
+		if err != nil {
+			log.Error("Error while listing instances: ", err)
+			os.Exit(1)
+		}
+
+		files := map[string]string{"supervisord.log": "/var/log/supervisor/supervisord.log"}
+		for _, instance := range instances {
+			if len(selected) != 0 && !selected[instance.ProjectID] {
+				continue
+			}
+			logFiles, err := instance.LogFiles()
+			if err != nil {
+				log.Warning("Skipping logs of ", instance.ProjectID, " instance ", instance.InstanceID, ": ", err)
+				continue
+			}
+			for name, location := range logFiles {
+				if stat, err := os.Stat(location); err == nil && stat.ModTime().Before(since) {
+					continue
+				}
+				files[instance.ProjectID+"/"+instance.InstanceID+"/"+name] = location
+			}
+		}
+
+		output := archiveOutput
+		if output == "" {
+			output = "marlinctl-logs-" + time.Now().Format("20060102-150405") + ".tar.gz"
+		}
+		err = util.WriteTarGz(output, files, nil)
+		if err != nil {
+			log.Error("Error while writing archive: ", err)
+			os.Exit(1)
+		}
+		log.Info("Archived " + strconv.Itoa(len(files)) + " log files into " + output)
+	},
+}
+
+func init() {
+	LogsCmd.AddCommand(archiveCmd)
+
+	archiveCmd.Flags().StringVarP(&archiveOutput, "output", "o", "", "location of archive to write (default marlinctl-logs-<timestamp>.tar.gz)")
+	archiveCmd.Flags().StringSliceVar(&archiveProjects, "project", []string{}, "projects to archive logs of, all projects if not given")
+	archiveCmd.Flags().StringVar(&archiveSince, "since", "", "only archive log files modified after a timestamp or a duration such as 24h")
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package reconcile
+
+import (
+	"os"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/marlinprotocol/ctl2/modules/reconcile"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var fix, removeUnmanaged bool
+
+// ReconcileCmd represents the reconcile command
+var ReconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Detect and repair drift between resource files and supervisor",
+	Long: `Detect orphaned supervisor confs, programs of resources unknown to supervisor, supervisor confs differing
+from what resource files render to and missing binaries. With --fix, binaries are downloaded again, confs are
+rewritten from resource files and orphaned confs are stopped and removed. Only confs written by marlinctl count
+as orphaned, confs named like ones marlinctl writes but written otherwise are reported as unmanaged and removed
+only with --remove-unmanaged. Exits with 1 if drift remains.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		drifts, err := reconcile.Detect()
+		if err != nil {
+			log.Error("Error while detecting drift: ", err)
+			os.Exit(1)
+		}
+		if len(drifts) == 0 {
+			log.Info("No drift found")
+			return
+		}
+
+		t := util.GetTable()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Project", "Instance", "Kind", "Target", "Detail"})
+		for _, d := range drifts {
+			t.AppendRow(table.Row{d.ProjectID, d.InstanceID, d.Kind, d.Target, d.Detail})
+		}
+		t.Render()
+
+		if !fix {
+			log.Info("Run marlinctl reconcile --fix to repair")
+			os.Exit(1)
+		}
+		err = reconcile.Repair(drifts, removeUnmanaged)
+		if err != nil {
+			log.Error("Error while repairing drift: ", err)
+			os.Exit(1)
+		}
+		log.Info("Drift repaired")
+	},
+}
+
+func init() {
+	ReconcileCmd.Flags().BoolVar(&fix, "fix", false, "repair drift found")
+	ReconcileCmd.Flags().BoolVar(&removeUnmanaged, "remove-unmanaged", false, "with --fix, also stop and remove unmanaged confs")
+}
@@ -40,9 +40,12 @@ func init() {
 		appcommands.CommandDetails{Use: "destroy", DescShort: "Destroy relay for polkadot blockchain", DescLong: "Destroy relay for polkadot blockchain"},
 		appcommands.CommandDetails{Use: "logs", DescShort: "Tail logs for running relay (polkadot) instances", DescLong: "Tail logs for running relay (polkadot) instances"},
 		appcommands.CommandDetails{Use: "status", DescShort: "Show current status of currently running relay instances", DescLong: "Show current status of currently running relay instances"},
+		appcommands.CommandDetails{Use: "health", DescShort: "Check health of relay (polkadot) instances", DescLong: "Check health of relay (polkadot) instances. Exits with 0 when healthy, 1 on warnings, 2 when critical and 3 when health is unknown"},
 		appcommands.CommandDetails{Use: "recreate", DescShort: "Recreate end to end relay (polkadot) instances", DescLong: "Recreate end to end relay (polkadot) instances"},
 		appcommands.CommandDetails{Use: "restart", DescShort: "Restart services for relay (polkadot) instances", DescLong: "Restart services for relay (polkadot) instances"},
+		appcommands.CommandDetails{Use: "upgrade", DescShort: "Upgrade relay (polkadot) instances to a different version", DescLong: "Upgrade relay (polkadot) instances to a different version"},
 		appcommands.CommandDetails{Use: "versions", DescShort: "Show available versions for use", DescLong: "Show available versions for use"},
+		appcommands.CommandDetails{Use: "adopt", DescShort: "Adopt relay programs set up outside of marlinctl", DescLong: "Adopt supervisor programs of relay set up outside of marlinctl by writing a resource file for them, so that they can be managed using marlinctl"},
 
 		appcommands.CommandDetails{Use: "show", DescShort: "Show current configuration residing on disk", DescLong: "Show current configuration residing on disk"},
 		appcommands.CommandDetails{Use: "diff", DescShort: "Show soft modifications to config staged for apply", DescLong: "Show soft modifications to config staged for apply"},
@@ -52,6 +55,17 @@ func init() {
 
 		appcommands.CommandDetails{Use: "create", DescShort: "Create keystore", DescLong: "Create keystore"},
 		appcommands.CommandDetails{Use: "destroy", DescShort: "Destroy keystore", DescLong: "Destroy keystore"},
+		appcommands.CommandDetails{Use: "import", DescShort: "Import existing account into keystore", DescLong: "Import existing account into keystore from an encrypted JSON keystore or a hex encoded private key"},
+		appcommands.CommandDetails{Use: "export", DescShort: "Export account from keystore", DescLong: "Export account from keystore as encrypted JSON keystore"},
+		appcommands.CommandDetails{Use: "list", DescShort: "List accounts in keystore", DescLong: "List addresses of accounts in keystore along with the one used by default"},
+		appcommands.CommandDetails{Use: "show", DescShort: "Show account in keystore", DescLong: "Show address, files and instances using an account in keystore"},
+		appcommands.CommandDetails{Use: "select", DescShort: "Select account used by default", DescLong: "Select account of keystore used by default when creating instances"},
+		appcommands.CommandDetails{Use: "migrate-secret", DescShort: "Move keystore passphrase to a different backend", DescLong: "Move passphrase of keystore out of its plain file into systemd-creds, kernel keyring, an external command or an environment variable, or back into a file readable only by its owner"},
+		appcommands.CommandDetails{Use: "rotate-passphrase", DescShort: "Change keystore passphrase", DescLong: "Re-encrypt keystore with a new passphrase, store new passphrase where old one was kept and restart instances using keystore"},
+		appcommands.CommandDetails{Use: "backup", DescShort: "Back up keystore", DescLong: "Write accounts of keystore along with their passphrases into an encrypted backup file"},
+		appcommands.CommandDetails{Use: "restore", DescShort: "Restore keystore from backup", DescLong: "Add accounts held in an encrypted backup file to keystore, leaving accounts already in keystore untouched"},
+		appcommands.CommandDetails{Use: "sign", DescShort: "Sign a message using keystore", DescLong: "Sign a message as an EIP-191 personal message using an account of keystore, to prove control of its address without the key leaving keystore"},
+		appcommands.CommandDetails{Use: "verify", DescShort: "Verify a signed message", DescLong: "Verify that an EIP-191 personal signature of a message was made by an address, default account of keystore if none is given"},
 	)
 	if err != nil {
 		log.Error("Error while creating relay_dot application command tree")
@@ -62,9 +76,12 @@ func init() {
 	DotCmd.AddCommand(app.DestroyCmd.Cmd)
 	DotCmd.AddCommand(app.LogsCmd.Cmd)
 	DotCmd.AddCommand(app.StatusCmd.Cmd)
+	DotCmd.AddCommand(app.HealthCmd.Cmd)
 	DotCmd.AddCommand(app.RecreateCmd.Cmd)
 	DotCmd.AddCommand(app.RestartCmd.Cmd)
+	DotCmd.AddCommand(app.UpgradeCmd.Cmd)
 	DotCmd.AddCommand(app.VersionsCmd.Cmd)
+	DotCmd.AddCommand(app.AdoptCmd.Cmd)
 
 	configCmd := &cobra.Command{Use: "config", Short: "Configurations of project set on disk", Long: "Configurations of project set on disk"}
 	DotCmd.AddCommand(configCmd)
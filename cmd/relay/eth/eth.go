@@ -40,9 +40,12 @@ func init() {
 		appcommands.CommandDetails{Use: "destroy", DescShort: "Destroy relay for ethereum blockchain", DescLong: "Destroy relay for ethereum blockchain"},
 		appcommands.CommandDetails{Use: "logs", DescShort: "Tail logs for running relay (eth) instances", DescLong: "Tail logs for running relay (eth) instances"},
 		appcommands.CommandDetails{Use: "status", DescShort: "Show current status of currently running relay instances", DescLong: "Show current status of currently running relay instances"},
+		appcommands.CommandDetails{Use: "health", DescShort: "Check health of relay (eth) instances", DescLong: "Check health of relay (eth) instances. Exits with 0 when healthy, 1 on warnings, 2 when critical and 3 when health is unknown"},
 		appcommands.CommandDetails{Use: "recreate", DescShort: "Recreate end to end relay (eth) instances", DescLong: "Recreate end to end relay (eth) instances"},
 		appcommands.CommandDetails{Use: "restart", DescShort: "Restart services for relay (eth) instances", DescLong: "Restart services for relay (eth) instances"},
+		appcommands.CommandDetails{Use: "upgrade", DescShort: "Upgrade relay (eth) instances to a different version", DescLong: "Upgrade relay (eth) instances to a different version"},
 		appcommands.CommandDetails{Use: "versions", DescShort: "Show available versions for use", DescLong: "Show available versions for use"},
+		appcommands.CommandDetails{Use: "adopt", DescShort: "Adopt relay programs set up outside of marlinctl", DescLong: "Adopt supervisor programs of relay set up outside of marlinctl by writing a resource file for them, so that they can be managed using marlinctl"},
 
 		appcommands.CommandDetails{Use: "show", DescShort: "Show current configuration residing on disk", DescLong: "Show current configuration residing on disk"},
 		appcommands.CommandDetails{Use: "diff", DescShort: "Show soft modifications to config staged for apply", DescLong: "Show soft modifications to config staged for apply"},
@@ -52,6 +55,17 @@ func init() {
 
 		appcommands.CommandDetails{Use: "create", DescShort: "Create keystore", DescLong: "Create keystore"},
 		appcommands.CommandDetails{Use: "destroy", DescShort: "Destroy keystore", DescLong: "Destroy keystore"},
+		appcommands.CommandDetails{Use: "import", DescShort: "Import existing account into keystore", DescLong: "Import existing account into keystore from an encrypted JSON keystore or a hex encoded private key"},
+		appcommands.CommandDetails{Use: "export", DescShort: "Export account from keystore", DescLong: "Export account from keystore as encrypted JSON keystore"},
+		appcommands.CommandDetails{Use: "list", DescShort: "List accounts in keystore", DescLong: "List addresses of accounts in keystore along with the one used by default"},
+		appcommands.CommandDetails{Use: "show", DescShort: "Show account in keystore", DescLong: "Show address, files and instances using an account in keystore"},
+		appcommands.CommandDetails{Use: "select", DescShort: "Select account used by default", DescLong: "Select account of keystore used by default when creating instances"},
+		appcommands.CommandDetails{Use: "migrate-secret", DescShort: "Move keystore passphrase to a different backend", DescLong: "Move passphrase of keystore out of its plain file into systemd-creds, kernel keyring, an external command or an environment variable, or back into a file readable only by its owner"},
+		appcommands.CommandDetails{Use: "rotate-passphrase", DescShort: "Change keystore passphrase", DescLong: "Re-encrypt keystore with a new passphrase, store new passphrase where old one was kept and restart instances using keystore"},
+		appcommands.CommandDetails{Use: "backup", DescShort: "Back up keystore", DescLong: "Write accounts of keystore along with their passphrases into an encrypted backup file"},
+		appcommands.CommandDetails{Use: "restore", DescShort: "Restore keystore from backup", DescLong: "Add accounts held in an encrypted backup file to keystore, leaving accounts already in keystore untouched"},
+		appcommands.CommandDetails{Use: "sign", DescShort: "Sign a message using keystore", DescLong: "Sign a message as an EIP-191 personal message using an account of keystore, to prove control of its address without the key leaving keystore"},
+		appcommands.CommandDetails{Use: "verify", DescShort: "Verify a signed message", DescLong: "Verify that an EIP-191 personal signature of a message was made by an address, default account of keystore if none is given"},
 	)
 	if err != nil {
 		log.Error("Error while creating relay_eth application command tree")
@@ -62,9 +76,24 @@ func init() {
 	EthCmd.AddCommand(app.DestroyCmd.Cmd)
 	EthCmd.AddCommand(app.LogsCmd.Cmd)
 	EthCmd.AddCommand(app.StatusCmd.Cmd)
+	EthCmd.AddCommand(app.HealthCmd.Cmd)
 	EthCmd.AddCommand(app.RecreateCmd.Cmd)
 	EthCmd.AddCommand(app.RestartCmd.Cmd)
+	EthCmd.AddCommand(app.UpgradeCmd.Cmd)
 	EthCmd.AddCommand(app.VersionsCmd.Cmd)
+	EthCmd.AddCommand(app.AdoptCmd.Cmd)
+
+	app.SetupGethCommands(
+		appcommands.CommandDetails{Use: "status", DescShort: "Show sync status of geth", DescLong: "Show whether geth is syncing, how far it got and how many peers it has, as reported by eth_syncing over its IPC endpoint"},
+		appcommands.CommandDetails{Use: "datadir", DescShort: "Show size of geth data directory", DescLong: "Show data directory of geth along with size of chain data kept in it"},
+		appcommands.CommandDetails{Use: "prune", DescShort: "Prune stale state from geth data directory", DescLong: "Stop geth, prune state no longer needed from its data directory using geth snapshot prune-state and start it again. Relay cannot reach chain while geth is stopped, which may last hours. Not available for geth running in light mode."},
+	)
+
+	gethCmd := &cobra.Command{Use: "geth", Short: "Manage geth run alongside relay (eth) instances", Long: "Manage geth run alongside relay (eth) instances by runners which manage geth"}
+	EthCmd.AddCommand(gethCmd)
+	gethCmd.AddCommand(app.GethStatusCmd.Cmd)
+	gethCmd.AddCommand(app.GethDataDirCmd.Cmd)
+	gethCmd.AddCommand(app.GethPruneCmd.Cmd)
 
 	configCmd := &cobra.Command{Use: "config", Short: "Configurations of project set on disk", Long: "Configurations of project set on disk"}
 	EthCmd.AddCommand(configCmd)
@@ -78,12 +107,15 @@ func init() {
 
 	app.CreateCmd.ArgStore["discovery-addrs"] = app.CreateCmd.Cmd.Flags().StringP("discovery-addrs", "a", "127.0.0.1:8002", "Discovery address of relay")
 	app.CreateCmd.ArgStore["heartbeat-addrs"] = app.CreateCmd.Cmd.Flags().StringP("heartbeat-addrs", "g", "127.0.0.1:8003", "Heartbeat address of relay")
-	app.CreateCmd.ArgStore["datadir"] = app.CreateCmd.Cmd.Flags().StringP("datadir", "d", "~/.ethereum/", "{deprecated} Data directory")
+	app.CreateCmd.ArgStore["datadir"] = app.CreateCmd.Cmd.Flags().StringP("datadir", "d", "~/.ethereum/", "Data directory of geth, managed by runners running geth and read by relay")
 	app.CreateCmd.ArgStore["discovery-port"] = app.CreateCmd.Cmd.Flags().StringP("discovery-port", "f", "", "Discovery port")
 	app.CreateCmd.ArgStore["pubsub-port"] = app.CreateCmd.Cmd.Flags().StringP("pubsub-port", "p", "", "PubSub port")
 	app.CreateCmd.ArgStore["address"] = app.CreateCmd.Cmd.Flags().StringP("address", "b", "", "Address")
 	app.CreateCmd.ArgStore["name"] = app.CreateCmd.Cmd.Flags().StringP("name", "n", "", "Name of relay")
-	app.CreateCmd.ArgStore["sync-mode"] = app.CreateCmd.Cmd.Flags().StringP("sync-mode", "m", "light", "{deprecated} Sync mode of GETH")
+	app.CreateCmd.ArgStore["sync-mode"] = app.CreateCmd.Cmd.Flags().StringP("sync-mode", "m", "light", "Sync mode of geth, one of light, snap, fast or full (runners managing geth only)")
+	app.CreateCmd.ArgStore["geth-pprof-addr"] = app.CreateCmd.Cmd.Flags().String("geth-pprof-addr", projectRunners.DefaultGethPprofAddr, "Address pprof of geth listens on (runners managing geth only)")
+	app.CreateCmd.ArgStore["geth-port"] = app.CreateCmd.Cmd.Flags().String("geth-port", projectRunners.DefaultGethPort, "Port geth listens on for peers, distinct for every instance on host (runners managing geth only)")
+	app.CreateCmd.ArgStore["geth-pprof-port"] = app.CreateCmd.Cmd.Flags().String("geth-pprof-port", projectRunners.DefaultGethPprofPort, "Port pprof of geth listens on, distinct for every instance on host (runners managing geth only)")
 
 	// ----------------------------------------------------------------------------------
 }
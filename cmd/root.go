@@ -38,8 +38,14 @@ import (
 	"github.com/inconshreveable/go-update"
 	"github.com/marlinprotocol/ctl2/cmd/beacon"
 	"github.com/marlinprotocol/ctl2/cmd/cp"
+	"github.com/marlinprotocol/ctl2/cmd/doctor"
+	"github.com/marlinprotocol/ctl2/cmd/exporter"
 	"github.com/marlinprotocol/ctl2/cmd/gateway"
+	"github.com/marlinprotocol/ctl2/cmd/logs"
+	"github.com/marlinprotocol/ctl2/cmd/reconcile"
 	"github.com/marlinprotocol/ctl2/cmd/relay"
+	"github.com/marlinprotocol/ctl2/cmd/serviceuser"
+	"github.com/marlinprotocol/ctl2/cmd/supportbundle"
 )
 
 var cfgFile string
@@ -149,6 +155,12 @@ func init() {
 	RootCmd.AddCommand(beacon.BeaconCmd)
 	RootCmd.AddCommand(relay.RelayCmd)
 	RootCmd.AddCommand(cp.CpCmd)
+	RootCmd.AddCommand(exporter.ExporterCmd)
+	RootCmd.AddCommand(logs.LogsCmd)
+	RootCmd.AddCommand(supportbundle.SupportBundleCmd)
+	RootCmd.AddCommand(doctor.DoctorCmd)
+	RootCmd.AddCommand(reconcile.ReconcileCmd)
+	RootCmd.AddCommand(serviceuser.ServiceUserCmd)
 
 	RootCmd.PersistentFlags().BoolVar(&skipRegistrySync, "skip-sync", false, "skip registry sync during run")
 	RootCmd.PersistentFlags().BoolVar(&forcefulRegistrySync, "registry-sync", false, "forceful registry sync from remote. May be used to check for upgrades.")
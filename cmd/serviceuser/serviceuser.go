@@ -0,0 +1,194 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package serviceuser
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/marlinprotocol/ctl2/modules/keystore"
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var serviceUserName, operatorsGroup string
+var setupProjects []string
+var allowTraverse, dryRun bool
+
+// ServiceUserCmd represents the service-user command
+var ServiceUserCmd = &cobra.Command{
+	Use:   "service-user",
+	Short: "Run programs of projects as a dedicated unprivileged user",
+	Long:  `Run programs of projects as a dedicated unprivileged user`,
+}
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Create service user and hand projects over to it",
+	Long: `Create service user if it does not exist and configure projects to run their programs as it. Keystores
+and secret environments of projects are handed over to service user and become unreadable by anyone else. Storage directories have to
+be reachable by service user, --allow-traverse makes directories leading to them searchable by everyone. Each
+such directory is listed, and home directories are never opened up.
+With --operators-group, members of group can run marlinctl without root.
+Only resources created afterwards run as service user, existing ones have to be recreated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dryRun {
+			util.EnableDryRun()
+		} else if os.Geteuid() != 0 {
+			log.Error("Setting up service user needs root")
+			os.Exit(1)
+		}
+		usr, err := util.EnsureServiceUser(serviceUserName)
+		if err != nil {
+			log.Error("Error while setting up service user: ", err)
+			os.Exit(1)
+		}
+
+		if len(setupProjects) == 0 {
+			setupProjects = projects.GetProjectIDs()
+		}
+		for _, projectID := range setupProjects {
+			if _, ok := projects.CommandPaths[projectID]; !ok || !viper.IsSet(projectID) {
+				log.Error("Project ", projectID, " is not configured")
+				os.Exit(1)
+			}
+			setupProjectOrDie(projectID, usr)
+		}
+
+		if operatorsGroup != "" {
+			err = util.ShareConfDirs(operatorsGroup)
+			if err != nil {
+				log.Error("Error while sharing conf directories with ", operatorsGroup, ": ", err)
+				os.Exit(1)
+			}
+			log.Info("Members of ", operatorsGroup, " can write supervisor confs now. To let them control supervisor, set chown=root:",
+				operatorsGroup, " and chmod=0770 under [unix_http_server] in /etc/supervisor/supervisord.conf and restart supervisor")
+		}
+
+		for _, projectID := range setupProjects {
+			log.Info("Recreate running instances of ", projectID, " using marlinctl ", projects.CommandPaths[projectID], " recreate to run them as ", usr.Username)
+		}
+		if dryRun {
+			util.PrintPlan()
+		}
+	},
+}
+
+func setupProjectOrDie(projectID string, usr *user.User) {
+	projectConfig, err := projects.GetProjectConfig(projectID)
+	if err != nil {
+		log.Error("Error while reading project config of ", projectID, ": ", err)
+		os.Exit(1)
+	}
+	projectConfig.ServiceUser = usr.Username
+	viper.Set(projectID, projectConfig)
+	if viper.IsSet(projectID + "_modified") {
+		projectConfigMod, err := projects.GetProjectConfig(projectID + "_modified")
+		if err == nil {
+			projectConfigMod.ServiceUser = usr.Username
+			viper.Set(projectID+"_modified", projectConfigMod)
+		}
+	}
+	if !util.IsDryRun() {
+		err = viper.WriteConfig()
+		if err != nil {
+			log.Error("Error while writing config: ", err)
+			os.Exit(1)
+		}
+	}
+	log.Info("Programs of ", projectID, " run as ", usr.Username)
+
+	locations := []string{projectConfig.Storage}
+	keystoreDir, err := keystore.Dir(projectID)
+	if err == nil {
+		for _, acc := range keystore.ListAccounts(keystoreDir) {
+			err = keystore.Grant(acc.Path, acc.PassPath, usr)
+			if err != nil {
+				log.Warning("Error while handing keystore account ", acc.Address, " of ", projectID, " to ", usr.Username, ": ", err)
+			}
+			locations = append(locations, acc.Path)
+		}
+	}
+
+	envFiles, _ := filepath.Glob(projectConfig.Storage + "/common/project_" + projectID + "_instance*.env")
+	for _, envFile := range envFiles {
+		err = util.ChownToUser(envFile, usr)
+		if err != nil {
+			log.Warning("Error while handing secret environment ", envFile, " to ", usr.Username, ": ", err)
+		}
+	}
+
+	keyfiles, _ := filepath.Glob(projectConfig.Storage + "/common/project_" + projectID + "_instance*.keyfile.json")
+	for _, keyfile := range keyfiles {
+		err = util.ChownToUser(keyfile, usr)
+		if err != nil {
+			log.Warning("Error while handing keyfile ", keyfile, " to ", usr.Username, ": ", err)
+		}
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, location := range locations {
+		if location == "" {
+			continue
+		}
+		untraversable, err := util.UntraversableDirs(location, usr)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			log.Error("Error while checking if ", usr.Username, " can reach ", location, ": ", err)
+			os.Exit(1)
+		}
+		for _, dir := range untraversable {
+			if !allowTraverse {
+				log.Warning(dir, " cannot be entered by user ", usr.Username, ", rerun with --allow-traverse or move storage of ", projectID)
+				break
+			}
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	for _, dir := range dirs {
+		if util.IsHomeDir(dir) {
+			log.Error("Refusing to make home directory ", dir, " searchable by everyone, move storage and keystores of ", projectID, " out of it")
+			os.Exit(1)
+		}
+	}
+	for _, dir := range dirs {
+		log.Info("Making ", dir, " searchable by everyone")
+		err = util.AllowTraverse(dir)
+		if err != nil {
+			log.Error("Error while allowing traversal of ", dir, ": ", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func init() {
+	setupCmd.Flags().StringVar(&serviceUserName, "user", util.DefaultServiceUser, "service user to run programs as")
+	setupCmd.Flags().StringSliceVar(&setupProjects, "project", []string{}, "projects to set up, all configured projects if not given")
+	setupCmd.Flags().BoolVar(&allowTraverse, "allow-traverse", false, "make directories leading to storage and keystores searchable by everyone, except home directories")
+	setupCmd.Flags().StringVar(&operatorsGroup, "operators-group", "", "group whose members may run marlinctl without root")
+	setupCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show actions to be taken without making any changes")
+
+	ServiceUserCmd.AddCommand(setupCmd)
+}
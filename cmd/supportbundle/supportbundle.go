@@ -0,0 +1,57 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supportbundle
+
+import (
+	"os"
+	"time"
+
+	"github.com/marlinprotocol/ctl2/modules/supportbundle"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	output  string
+	options supportbundle.Options
+)
+
+// SupportBundleCmd represents the support-bundle command
+var SupportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collect diagnostics of resources for Marlin support",
+	Long: `Collect versions, configuration, resource files, supervisor configuration, recent logs, checksums of
+installed binaries and host details into a tarball for Marlin support. Secrets are redacted and keystore
+passphrase files are never included.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if output == "" {
+			output = "marlinctl-support-" + time.Now().Format("20060102-150405") + ".tar.gz"
+		}
+		err := supportbundle.Create(output, options)
+		if err != nil {
+			log.Error("Error while creating support bundle: ", err)
+			os.Exit(1)
+		}
+		log.Info("Support bundle written to ", output, ", please review it before sharing")
+	},
+}
+
+func init() {
+	SupportBundleCmd.Flags().StringVarP(&output, "output", "o", "", "location of bundle to write (default marlinctl-support-<timestamp>.tar.gz)")
+	SupportBundleCmd.Flags().StringVarP(&options.ProjectID, "project", "p", "", "only include resources of project")
+	SupportBundleCmd.Flags().StringVarP(&options.InstanceID, "instance-id", "i", "", "only include resources with instance id")
+	SupportBundleCmd.Flags().IntVarP(&options.LogLines, "lines", "n", 1000, "number of last log lines to include per program and stream")
+}
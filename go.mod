@@ -14,6 +14,7 @@ require (
 	github.com/schollz/progressbar/v3 v3.7.3
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	gopkg.in/src-d/go-git.v4 v4.13.1
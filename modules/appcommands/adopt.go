@@ -0,0 +1,324 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/registry"
+	"github.com/marlinprotocol/ctl2/modules/runner"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Adopt command
+func (a *app) setupAdoptCommand() {
+	a.AdoptCmd.Cmd = &cobra.Command{
+		Use:   a.AdoptCmd.Use,
+		Short: a.AdoptCmd.DescShort,
+		Long:  a.AdoptCmd.DescLong,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			additionalTest := a.AdoptCmd.AdditionalPreRunTest
+			err := a.setupDefaultConfigIfNotExists()
+			if err != nil {
+				return err
+			} else if err == nil && additionalTest != nil {
+				return additionalTest(cmd, args)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			programs := a.AdoptCmd.getStringSliceFromArgStoreOrDie("program")
+			instanceID := a.AdoptCmd.getStringFromArgStoreOrDie("instance-id")
+			version := a.AdoptCmd.getStringFromArgStoreOrDie("version")
+			copyBinaries := a.AdoptCmd.getBoolFromArgStoreOrDie("copy-binary")
+			rewriteConf := a.AdoptCmd.getBoolFromArgStoreOrDie("rewrite-conf")
+			skipChecksum := a.AdoptCmd.getBoolFromArgStoreOrDie("skip-checksum")
+
+			// Run application
+			if len(programs) == 0 {
+				log.Error("Supervisor programs to adopt have to be given using --program")
+				os.Exit(1)
+			}
+			projConfig := a.getProjectConfigOrDie()
+			if instanceID == "auto" {
+				instanceID = a.allocateInstanceIDOrDie(projConfig)
+			}
+			if util.FileExists(a.getResourceFileLocation(projConfig, instanceID)) {
+				log.Error("Instance ", instanceID, " already exists, use a different instance id")
+				os.Exit(1)
+			}
+
+			sections, confFiles := a.getSupervisorSectionsOrDie(programs)
+			versionToRun := a.getAdoptedVersionOrDie(projConfig, version, sections, skipChecksum)
+			log.Info("Adopting as version ", versionToRun.Version, " (runner ", versionToRun.RunnerId, ")")
+
+			r := a.getRunnerInstanceOrDie(versionToRun.RunnerId,
+				versionToRun.Version,
+				projConfig.Storage,
+				versionToRun.RunnerData,
+				false,
+				skipChecksum,
+				instanceID)
+			tx := &runner.Transaction{}
+			if copyBinaries {
+				err := a.copyAdoptedBinaries(tx, projConfig, versionToRun, instanceID, sections)
+				if err != nil {
+					log.Error("Error while copying binaries: ", tx.Rollback(err))
+					os.Exit(1)
+				}
+			}
+			resourceFile := a.getResourceFileLocation(projConfig, instanceID)
+			var unmapped []string
+			err := tx.Do("write resource file", func() error {
+				var err error
+				unmapped, err = r.Adopt(sections)
+				return err
+			}, func() error {
+				return util.RemoveFileIfExists(resourceFile)
+			})
+			if err != nil {
+				log.Error("Error while adopting programs: ", tx.Rollback(err))
+				os.Exit(1)
+			}
+			for _, u := range unmapped {
+				log.Warning("Not carried over into resource: ", u)
+			}
+
+			if rewriteConf {
+				err = a.rewriteAdoptedConfs(tx, r, confFiles)
+				if err != nil {
+					log.Error("Error while rewriting supervisor confs: ", tx.Rollback(err))
+					os.Exit(1)
+				}
+			} else {
+				log.Info("Supervisor confs were left untouched, marlinctl reconcile shows how they differ from ones marlinctl writes")
+				if copyBinaries {
+					log.Warning("Programs keep running binaries from their old location until confs are rewritten")
+				}
+			}
+			log.Info("Adopted ", strings.Join(programs, ", "), " as ", a.ProjectID, " instance ", instanceID)
+		},
+	}
+
+	a.AdoptCmd.ArgStore = make(map[string]interface{})
+
+	a.AdoptCmd.ArgStore["program"] = a.AdoptCmd.Cmd.Flags().StringSlice("program", []string{}, "supervisor program(s) to adopt, all programs of a resource have to be given together")
+	a.AdoptCmd.ArgStore["instance-id"] = a.AdoptCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id to adopt programs as, \"auto\" to allocate next free id")
+	a.AdoptCmd.ArgStore["version"] = a.AdoptCmd.Cmd.Flags().StringP("version", "x", "", "version programs run, inferred from checksums of binaries if not given")
+	a.AdoptCmd.ArgStore["copy-binary"] = a.AdoptCmd.Cmd.Flags().Bool("copy-binary", false, "copy binaries into marlinctl storage instead of referring to them where they are")
+	a.AdoptCmd.ArgStore["rewrite-conf"] = a.AdoptCmd.Cmd.Flags().Bool("rewrite-conf", false, "replace supervisor confs of programs with ones marlinctl writes, restarts programs whose conf changes")
+	a.AdoptCmd.ArgStore["skip-checksum"] = a.AdoptCmd.Cmd.Flags().BoolP("skip-checksum", "s", false, "adopt binaries even if they do not match checksums of version")
+}
+
+// rewriteAdoptedConfs replaces supervisor confs programs were adopted from
+// with confs rendered from resource of adopted instance.
+func (a *app) rewriteAdoptedConfs(tx *runner.Transaction, r runner.Runner, confFiles []string) error {
+	confs, err := r.SupervisorConfs()
+	if err != nil {
+		return err
+	}
+	locations := append([]string{}, confFiles...)
+	for location := range confs {
+		locations = append(locations, location)
+	}
+	err = tx.Preserve(locations...)
+	if err != nil {
+		return err
+	}
+	for _, f := range confFiles {
+		err = tx.Do("remove supervisor conf "+f, func() error {
+			return util.RemoveFileIfExists(f)
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	for location, conf := range confs {
+		err = tx.Do("write supervisor conf "+location, func() error {
+			return util.WriteFile(location, []byte(conf), 0644)
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return util.SupervisorRereadUpdate()
+}
+
+// getSupervisorSectionsOrDie returns program sections of supervisor confs
+// along with conf files they are defined in.
+func (a *app) getSupervisorSectionsOrDie(programs []string) (map[string]map[string]string, []string) {
+	instances, err := projects.GetInstances()
+	if err != nil {
+		log.Error("Error while listing instances: ", err)
+		os.Exit(1)
+	}
+	managed := make(map[string]string)
+	for _, instance := range instances {
+		for _, prg := range instance.Programs() {
+			managed[prg] = instance.ProjectID + " instance " + instance.InstanceID
+		}
+	}
+
+	confs := util.SupervisorConfPrograms()
+	sections := make(map[string]map[string]string)
+	confFiles := make(map[string]bool)
+	for _, prg := range programs {
+		if owner, ok := managed[prg]; ok {
+			log.Error("Program ", prg, " is already managed by marlinctl as ", owner)
+			os.Exit(1)
+		}
+		conf, ok := confs[prg]
+		if !ok {
+			log.Error("Cannot find program ", prg, " in supervisor confs at ", util.SupervisorConfDir)
+			os.Exit(1)
+		}
+		data, err := ioutil.ReadFile(conf)
+		if err != nil {
+			log.Error("Error while reading supervisor conf ", conf, ": ", err)
+			os.Exit(1)
+		}
+		sections[prg] = runner.ParseSupervisorSections(string(data))[prg]
+		if len(runner.SplitCommand(sections[prg]["command"])) == 0 {
+			log.Error("Program ", prg, " has no command")
+			os.Exit(1)
+		}
+		confFiles[conf] = true
+	}
+
+	var files []string
+	for f := range confFiles {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return sections, files
+}
+
+// getAdoptedVersionOrDie finds version whose binaries published in registry
+// match binaries run by programs, or verifies binaries against given version.
+func (a *app) getAdoptedVersionOrDie(projConfig types.Project, version string, sections map[string]map[string]string, skipChecksum bool) registry.ProjectVersion {
+	var checksums []string
+	for prg, section := range sections {
+		binary := runner.SplitCommand(section["command"])[0]
+		checksum, err := util.FileChecksum(binary)
+		if err != nil {
+			log.Error("Error while reading binary of program ", prg, ": ", err)
+			os.Exit(1)
+		}
+		checksums = append(checksums, checksum)
+	}
+
+	if version != "" {
+		versionToRun := a.getVersionToRunOrDie("", version)
+		if !skipChecksum && !hasChecksums(versionToRun.RunnerData, checksums) {
+			log.Error("Binaries of programs do not match checksums published for version ", version, ", use --skip-checksum to adopt anyway")
+			os.Exit(1)
+		}
+		return versionToRun
+	}
+
+	versions, err := registry.GlobalRegistry.GetVersions(a.ProjectID, projConfig.Subscription, "0.0.0", "major", projConfig.Runtime)
+	if err != nil {
+		log.Error("Error while fetching from global registry: ", err)
+		os.Exit(1)
+	}
+	for _, v := range versions {
+		if hasChecksums(v.RunnerData, checksums) {
+			return v
+		}
+	}
+	log.Error("Binaries of programs do not match any version published in registry, give version using --version and --skip-checksum to adopt anyway")
+	os.Exit(1)
+	return registry.ProjectVersion{}
+}
+
+func hasChecksums(runnerData interface{}, checksums []string) bool {
+	runnerDataMap, ok := runnerData.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	published := make(map[string]bool)
+	for k, v := range runnerDataMap {
+		if checksum, ok := v.(string); ok && strings.HasSuffix(k, "_checksum") {
+			published[checksum] = true
+		}
+	}
+	for _, checksum := range checksums {
+		if !published[checksum] {
+			return false
+		}
+	}
+	return true
+}
+
+// copyAdoptedBinaries copies binaries run by programs into storage of
+// version and points commands of sections at the copies, removing copies on
+// rollback. Binaries not published for version are copied to a location of
+// their own for instance, so that instances created from version do not run
+// them. Binaries already in storage are only reused if they are identical.
+func (a *app) copyAdoptedBinaries(tx *runner.Transaction, projConfig types.Project, versionToRun registry.ProjectVersion, instanceID string, sections map[string]map[string]string) error {
+	dirPath := projConfig.Storage + "/" + versionToRun.Version
+	err := util.CreateDirPathIfNotExists(dirPath)
+	if err != nil {
+		return errors.New("Error while creating directory " + dirPath + ": " + err.Error())
+	}
+	for _, section := range sections {
+		binary := runner.SplitCommand(section["command"])[0]
+		checksum, err := util.FileChecksum(binary)
+		if err != nil {
+			return err
+		}
+		location := dirPath + "/" + filepath.Base(binary)
+		if !hasChecksums(versionToRun.RunnerData, []string{checksum}) {
+			location = location + "_instance" + instanceID
+		}
+		if binary != location && util.FileExists(location) {
+			existing, err := util.FileChecksum(location)
+			if err != nil {
+				return err
+			}
+			if existing != checksum {
+				return errors.New(location + " already exists and differs from " + binary)
+			}
+		} else if binary != location {
+			err = tx.Do("copy binary "+binary+" to "+location, func() error {
+				return util.CopyFile(binary, location, 0755)
+			}, func() error {
+				return util.RemoveFileIfExists(location)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		section["command"] = strings.Replace(section["command"], binary, location, 1)
+	}
+	err = util.ChownRmarlinctlDir()
+	if err != nil {
+		return errors.New("Error while chowning .marlin: " + err.Error())
+	}
+	return nil
+}
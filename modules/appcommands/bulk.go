@@ -0,0 +1,328 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/marlinprotocol/ctl2/modules/runner"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/types"
+	log "github.com/sirupsen/logrus"
+)
+
+var errSkipped = errors.New("skipped")
+
+type instanceResult struct {
+	InstanceID string
+	Duration   time.Duration
+	Err        error
+}
+
+// getResourceRunner returns a runner for an existing resource, with prerun
+// sanity already done.
+func (a *app) getResourceRunner(projectConfig types.Project, instanceId string) (runner.Runner, error) {
+	runnerId, version, err := a.getResourceMetadata(projectConfig, instanceId)
+	if err != nil {
+		return nil, errors.New("Error while getting resource file information: " + err.Error())
+	}
+	if util.IsDryRun() {
+		log.Info("Dry run: resource ", instanceId, " runs version ", version, " (runner ", runnerId, ")")
+	}
+	r, err := a.RunnerProvider(runnerId, version, projectConfig.Storage, struct{}{}, true, true, instanceId)
+	if err != nil {
+		return nil, errors.New("Error while getting project runner: " + err.Error())
+	}
+	err = r.PreRunSanity()
+	if err != nil {
+		return nil, errors.New("Error while doing prerun sanity: " + err.Error())
+	}
+	return r, nil
+}
+
+// runOnInstancesOrDie runs op on every instance with at most parallel
+// instances in flight. A summary is printed when more than one instance was
+// acted upon and marlinctl exits with a non zero status if any of them failed.
+func (a *app) runOnInstancesOrDie(action string, instanceIDs []string, parallel int, op func(instanceId string) error) {
+	if parallel < 1 || util.IsDryRun() {
+		parallel = 1
+	}
+
+	results := make([]instanceResult, len(instanceIDs))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, instanceID := range instanceIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, instanceID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			start := time.Now()
+			err := op(instanceID)
+			if err != nil {
+				log.Error("Error while running ", action, " on project ", a.ProjectID, " instance ", instanceID, ": ", err)
+			}
+			results[i] = instanceResult{instanceID, time.Since(start).Round(time.Millisecond), err}
+		}(i, instanceID)
+	}
+	wg.Wait()
+
+	a.printInstanceResultsOrDie(action, results)
+}
+
+// runRollingOrDie runs op on instances in batches of at most maxUnavailable
+// instances. Every instance in a batch has to be healthy for healthPeriod
+// before the next batch is started, remaining batches are skipped on failure.
+func (a *app) runRollingOrDie(action string, projectConfig types.Project, instanceIDs []string, maxUnavailable int, healthPeriod time.Duration, healthTimeout time.Duration, op func(instanceId string) error) {
+	if maxUnavailable < 1 {
+		maxUnavailable = 1
+	}
+
+	var results []instanceResult
+	halted := false
+	for b := 0; b < len(instanceIDs); b += maxUnavailable {
+		batch := instanceIDs[b:]
+		if len(batch) > maxUnavailable {
+			batch = batch[:maxUnavailable]
+		}
+		if halted {
+			for _, instanceID := range batch {
+				results = append(results, instanceResult{instanceID, 0, errSkipped})
+			}
+			continue
+		}
+
+		log.Info("Rolling ", action, ": processing instances ", strings.Join(batch, ", "))
+		batchResults := make([]instanceResult, len(batch))
+		var wg sync.WaitGroup
+		for i, instanceID := range batch {
+			wg.Add(1)
+			go func(i int, instanceID string) {
+				defer wg.Done()
+				start := time.Now()
+				err := op(instanceID)
+				if err == nil {
+					err = a.waitResourceHealthy(projectConfig, instanceID, healthPeriod, healthTimeout)
+				}
+				if err != nil {
+					log.Error("Error while running ", action, " on project ", a.ProjectID, " instance ", instanceID, ": ", err)
+				}
+				batchResults[i] = instanceResult{instanceID, time.Since(start).Round(time.Millisecond), err}
+			}(i, instanceID)
+			if util.IsDryRun() {
+				wg.Wait()
+			}
+		}
+		wg.Wait()
+
+		for _, res := range batchResults {
+			if res.Err != nil {
+				halted = true
+			}
+		}
+		results = append(results, batchResults...)
+		if halted {
+			log.Error("Rolling ", action, " halted due to failures")
+		}
+	}
+
+	a.printInstanceResultsOrDie(action, results)
+}
+
+func (a *app) waitResourceHealthy(projectConfig types.Project, instanceId string, healthPeriod time.Duration, healthTimeout time.Duration) error {
+	if util.IsDryRun() {
+		util.RecordPlanStep("wait until healthy for "+healthPeriod.String(), a.ProjectID+" instance "+instanceId, "")
+		return nil
+	}
+	r, err := a.getResourceRunner(projectConfig, instanceId)
+	if err != nil {
+		return err
+	}
+	extras, err := a.getResourceExtras(projectConfig, instanceId)
+	if err != nil {
+		return err
+	}
+	httpProbe, _ := extras["HealthProbe"].(string)
+	return a.waitHealthy(r, instanceId, httpProbe, healthPeriod, healthTimeout)
+}
+
+// waitHealthy polls health of a resource until it has been neither critical
+// nor unknown for healthPeriod, giving up after healthTimeout.
+func (a *app) waitHealthy(r runner.Runner, instanceId string, httpProbe string, healthPeriod time.Duration, healthTimeout time.Duration) error {
+	if util.IsDryRun() {
+		util.RecordPlanStep("wait until healthy for "+healthPeriod.String(), a.ProjectID+" instance "+instanceId, "")
+		return nil
+	}
+	log.Info("Waiting for instance ", instanceId, " to stay healthy for ", healthPeriod.String())
+	deadline := time.Now().Add(healthTimeout)
+	var healthySince time.Time
+	for {
+		report, err := r.Health(runner.HealthOptions{HTTPProbe: httpProbe})
+		if err != nil {
+			return errors.New("Error while fetching health: " + err.Error())
+		}
+		if report.Status == runner.HealthOK || report.Status == runner.HealthWarning {
+			if healthySince.IsZero() {
+				healthySince = time.Now()
+			}
+			if time.Since(healthySince) >= healthPeriod {
+				log.Info("Instance ", instanceId, " is healthy")
+				return nil
+			}
+		} else {
+			healthySince = time.Time{}
+		}
+		if time.Now().After(deadline) {
+			return errors.New("Instance did not stay healthy for " + healthPeriod.String() + " within " + healthTimeout.String() + ", last health: " + describeHealth(report))
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func describeHealth(report runner.HealthReport) string {
+	description := report.Status.String()
+	for _, p := range report.Programs {
+		description += fmt.Sprintf(", %s %s", p.Program, p.State)
+	}
+	for _, p := range report.Probes {
+		if !p.OK {
+			description += fmt.Sprintf(", %s %s failed: %s", p.Name, p.Target, p.Detail)
+		}
+	}
+	return description
+}
+
+// runLifecycleOrDie runs op on instances either in rolling fashion or with
+// bounded parallelism depending on flags of the command. Outside of rolling
+// mode instances are waited upon to stay healthy only with --wait-healthy.
+func (a *app) runLifecycleOrDie(c *CommandDetails, action string, projectConfig types.Project, instanceIDs []string, op func(instanceId string) error) {
+	healthPeriod := c.getDurationFromArgStoreOrDie("health-period")
+	healthTimeout := c.getDurationFromArgStoreOrDie("health-timeout")
+	if c.getBoolFromArgStoreOrDie("rolling") {
+		a.runRollingOrDie(action, projectConfig, instanceIDs,
+			c.getIntFromArgStoreOrDie("max-unavailable"),
+			healthPeriod, healthTimeout, op)
+	} else {
+		a.runOnInstancesOrDie(action, instanceIDs, c.getIntFromArgStoreOrDie("parallel"), func(instanceId string) error {
+			err := op(instanceId)
+			if err != nil || !c.getBoolFromArgStoreOrDie("wait-healthy") {
+				return err
+			}
+			return a.waitResourceHealthy(projectConfig, instanceId, healthPeriod, healthTimeout)
+		})
+	}
+}
+
+func (c *CommandDetails) addLifecycleFlags(verb string) {
+	c.ArgStore["parallel"] = c.Cmd.Flags().Int("parallel", 4, "maximum number of resources to "+verb+" at once")
+	c.ArgStore["rolling"] = c.Cmd.Flags().Bool("rolling", false, verb+" resources in batches, waiting for each batch to be healthy")
+	c.ArgStore["max-unavailable"] = c.Cmd.Flags().Int("max-unavailable", 1, "maximum number of resources in a rolling batch")
+	c.ArgStore["wait-healthy"] = c.Cmd.Flags().Bool("wait-healthy", false, "wait for resources to stay healthy after each "+verb+" outside of rolling mode")
+	c.ArgStore["health-period"] = c.Cmd.Flags().Duration("health-period", 30*time.Second, "period for which resources have to stay healthy, when rolling or with --wait-healthy")
+	c.ArgStore["health-timeout"] = c.Cmd.Flags().Duration("health-timeout", 2*time.Minute, "maximum time to wait for resources to become healthy, when rolling or with --wait-healthy")
+}
+
+func (a *app) printInstanceResultsOrDie(action string, results []instanceResult) {
+	failed, skipped := 0, 0
+	for _, res := range results {
+		if res.Err == errSkipped {
+			skipped++
+		} else if res.Err != nil {
+			failed++
+		}
+	}
+
+	if len(results) > 1 {
+		t := util.GetTable()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Instance", "Result", "Duration", "Error"})
+		for _, res := range results {
+			if res.Err == errSkipped {
+				t.AppendRow(table.Row{res.InstanceID, "SKIPPED", "", ""})
+			} else if res.Err != nil {
+				t.AppendRow(table.Row{res.InstanceID, "FAILED", res.Duration.String(), res.Err.Error()})
+			} else {
+				t.AppendRow(table.Row{res.InstanceID, "OK", res.Duration.String(), ""})
+			}
+		}
+		t.Render()
+		log.Info(action, " summary: ", strconv.Itoa(len(results)-failed-skipped), " succeeded, ",
+			strconv.Itoa(failed), " failed, ", strconv.Itoa(skipped), " skipped")
+	}
+
+	if failed != 0 {
+		os.Exit(1)
+	}
+}
+
+func (a *app) getHealthReport(projectConfig types.Project, instanceId string, httpProbe string, probeTimeout time.Duration) runner.HealthReport {
+	r, err := a.getResourceRunner(projectConfig, instanceId)
+	if err != nil {
+		return runner.HealthReport{Status: runner.HealthUnknown, Probes: []runner.ProbeResult{{Name: "resource", OK: false, Detail: err.Error()}}}
+	}
+	if httpProbe == "" {
+		if extras, err := a.getResourceExtras(projectConfig, instanceId); err == nil {
+			httpProbe, _ = extras["HealthProbe"].(string)
+		}
+	}
+	report, err := r.Health(runner.HealthOptions{HTTPProbe: httpProbe, ProbeTimeout: probeTimeout})
+	if err != nil {
+		return runner.HealthReport{Status: runner.HealthUnknown, Probes: []runner.ProbeResult{{Name: "resource", OK: false, Detail: err.Error()}}}
+	}
+	return report
+}
+
+func (a *app) printHealthReport(instanceId string, report runner.HealthReport) {
+	log.Info("Health of ", a.ProjectID, " instance ", instanceId, ": ", report.Status.String())
+
+	if len(report.Programs) != 0 {
+		t := util.GetTable()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Program", "State", "Pid", "Uptime", "Restarts"})
+		for _, p := range report.Programs {
+			restarts := "unknown"
+			if p.Restarts >= 0 {
+				restarts = strconv.Itoa(p.Restarts)
+			}
+			t.AppendRow(table.Row{p.Program, p.State, strconv.Itoa(p.Pid), p.Uptime.String(), restarts})
+		}
+		t.Render()
+	}
+
+	if len(report.Probes) != 0 {
+		t := util.GetTable()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Probe", "Target", "Result", "Detail"})
+		for _, p := range report.Probes {
+			result := "FAIL"
+			if p.OK {
+				result = "OK"
+			}
+			t.AppendRow(table.Row{p.Name, p.Target, result, p.Detail})
+		}
+		t.Render()
+	}
+}
@@ -18,8 +18,13 @@ package appcommands
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/user"
+	"regexp"
+	"sync"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/marlinprotocol/ctl2/modules/keystore"
@@ -48,9 +53,12 @@ type app struct {
 	DestroyCmd         CommandDetails
 	LogsCmd            CommandDetails
 	StatusCmd          CommandDetails
+	HealthCmd          CommandDetails
 	RecreateCmd        CommandDetails
 	RestartCmd         CommandDetails
+	UpgradeCmd         CommandDetails
 	VersionsCmd        CommandDetails
+	AdoptCmd           CommandDetails
 	ConfigShowCmd      CommandDetails
 	ConfigDiffCmd      CommandDetails
 	ConfigModifyCmd    CommandDetails
@@ -58,6 +66,34 @@ type app struct {
 	ConfigApplyCmd     CommandDetails
 	KeystoreCreateCmd  CommandDetails
 	KeystoreDestroyCmd CommandDetails
+	KeystoreImportCmd  CommandDetails
+	KeystoreExportCmd  CommandDetails
+	KeystoreListCmd    CommandDetails
+	KeystoreShowCmd    CommandDetails
+	KeystoreSelectCmd  CommandDetails
+	KeystoreMigrateCmd CommandDetails
+	KeystoreRotateCmd  CommandDetails
+	KeystoreBackupCmd  CommandDetails
+	KeystoreRestoreCmd CommandDetails
+	KeystoreSignCmd    CommandDetails
+	KeystoreVerifyCmd  CommandDetails
+
+	// Set up only for projects running MEV proxy, by SetupMevProxyCommands
+	MevProxyStatusCmd      CommandDetails
+	MevProxyRestartCmd     CommandDetails
+	MevProxyReconfigureCmd CommandDetails
+	MevProxyLogsCmd        CommandDetails
+
+	// Set up only for gateways identifying themselves with keyfiles, by SetupKeyfileCommands
+	KeyfileShowCmd     CommandDetails
+	KeyfileGenerateCmd CommandDetails
+	KeyfileImportCmd   CommandDetails
+	KeyfileRotateCmd   CommandDetails
+
+	// Set up only for relays running geth, by SetupGethCommands
+	GethStatusCmd  CommandDetails
+	GethDataDirCmd CommandDetails
+	GethPruneCmd   CommandDetails
 }
 
 // Write Defaults logic
@@ -69,9 +105,12 @@ func GetNewApp(_projectID string,
 	_destroyCmd CommandDetails,
 	_logsCmd CommandDetails,
 	_statusCmd CommandDetails,
+	_healthCmd CommandDetails,
 	_recreateCmd CommandDetails,
 	_restartCmd CommandDetails,
+	_upgradeCmd CommandDetails,
 	_versionsCmd CommandDetails,
+	_adoptCmd CommandDetails,
 	_configShowCmd CommandDetails,
 	_configDiffCmd CommandDetails,
 	_configModifyCmd CommandDetails,
@@ -79,6 +118,17 @@ func GetNewApp(_projectID string,
 	_configApplyCmd CommandDetails,
 	_keystoreCreateCmd CommandDetails,
 	_keystoreDestroyCmd CommandDetails,
+	_keystoreImportCmd CommandDetails,
+	_keystoreExportCmd CommandDetails,
+	_keystoreListCmd CommandDetails,
+	_keystoreShowCmd CommandDetails,
+	_keystoreSelectCmd CommandDetails,
+	_keystoreMigrateCmd CommandDetails,
+	_keystoreRotateCmd CommandDetails,
+	_keystoreBackupCmd CommandDetails,
+	_keystoreRestoreCmd CommandDetails,
+	_keystoreSignCmd CommandDetails,
+	_keystoreVerifyCmd CommandDetails,
 ) (app, error) {
 	createdApp := app{
 		ProjectID:      _projectID,
@@ -97,15 +147,24 @@ func GetNewApp(_projectID string,
 	createdApp.shallowCopyDescriptions(&createdApp.StatusCmd, _statusCmd)
 	createdApp.setupStatusCommand()
 
+	createdApp.shallowCopyDescriptions(&createdApp.HealthCmd, _healthCmd)
+	createdApp.setupHealthCommand()
+
 	createdApp.shallowCopyDescriptions(&createdApp.RecreateCmd, _recreateCmd)
 	createdApp.setupRecreateCommand()
 
 	createdApp.shallowCopyDescriptions(&createdApp.RestartCmd, _restartCmd)
 	createdApp.setupRestartCommand()
 
+	createdApp.shallowCopyDescriptions(&createdApp.UpgradeCmd, _upgradeCmd)
+	createdApp.setupUpgradeCommand()
+
 	createdApp.shallowCopyDescriptions(&createdApp.VersionsCmd, _versionsCmd)
 	createdApp.setupVersionsCommand()
 
+	createdApp.shallowCopyDescriptions(&createdApp.AdoptCmd, _adoptCmd)
+	createdApp.setupAdoptCommand()
+
 	createdApp.shallowCopyDescriptions(&createdApp.ConfigShowCmd, _configShowCmd)
 	createdApp.setupConfigShowCommand()
 
@@ -127,6 +186,39 @@ func GetNewApp(_projectID string,
 	createdApp.shallowCopyDescriptions(&createdApp.KeystoreDestroyCmd, _keystoreDestroyCmd)
 	createdApp.setupKeystoreDestroyCommand()
 
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreImportCmd, _keystoreImportCmd)
+	createdApp.setupKeystoreImportCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreExportCmd, _keystoreExportCmd)
+	createdApp.setupKeystoreExportCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreListCmd, _keystoreListCmd)
+	createdApp.setupKeystoreListCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreShowCmd, _keystoreShowCmd)
+	createdApp.setupKeystoreShowCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreSelectCmd, _keystoreSelectCmd)
+	createdApp.setupKeystoreSelectCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreMigrateCmd, _keystoreMigrateCmd)
+	createdApp.setupKeystoreMigrateCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreRotateCmd, _keystoreRotateCmd)
+	createdApp.setupKeystoreRotateCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreBackupCmd, _keystoreBackupCmd)
+	createdApp.setupKeystoreBackupCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreRestoreCmd, _keystoreRestoreCmd)
+	createdApp.setupKeystoreRestoreCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreSignCmd, _keystoreSignCmd)
+	createdApp.setupKeystoreSignCommand()
+
+	createdApp.shallowCopyDescriptions(&createdApp.KeystoreVerifyCmd, _keystoreVerifyCmd)
+	createdApp.setupKeystoreVerifyCommand()
+
 	return createdApp, nil
 }
 
@@ -152,12 +244,29 @@ func (a *app) setupCreateCommand() {
 			// Extract runtime variables
 			version := a.CreateCmd.getStringFromArgStoreOrDie("version")
 			instanceID := a.CreateCmd.getStringFromArgStoreOrDie("instance-id")
+			labels := a.CreateCmd.getStringToStringFromArgStoreOrDie("label")
+			healthProbe := a.CreateCmd.getStringFromArgStoreOrDie("health-probe")
+			healthPeriod := a.CreateCmd.getDurationFromArgStoreOrDie("health-period")
+			healthTimeout := a.CreateCmd.getDurationFromArgStoreOrDie("health-timeout")
+			keepOnFailure := a.CreateCmd.getBoolFromArgStoreOrDie("keep-on-failure")
 			skipChecksum := a.CreateCmd.getBoolFromArgStoreOrDie("skip-checksum")
 			runtimeArgs := a.CreateCmd.getStringToStringFromArgStoreOrDie("runtime-args")
+			dryRun := a.CreateCmd.getBoolFromArgStoreOrDie("dry-run")
 
 			// Run application
+			if err := validateLabels(labels); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
 			projConfig := a.getProjectConfigOrDie()
 			versionToRun := a.getVersionToRunOrDie(projConfig.UpdatePolicy, version)
+			if dryRun {
+				util.EnableDryRun()
+				log.Info("Dry run: resolved version ", versionToRun.Version, " (runner ", versionToRun.RunnerId, ")")
+			}
+			if instanceID == "auto" {
+				instanceID = a.allocateInstanceIDOrDie(projConfig)
+			}
 			runner := a.getRunnerInstanceOrDie(versionToRun.RunnerId,
 				versionToRun.Version,
 				projConfig.Storage,
@@ -179,10 +288,46 @@ func (a *app) setupCreateCommand() {
 			a.relayDotCreateSubstitutions(versionToRun.RunnerId)
 			a.relayPolygonCreateSubstitutions(versionToRun.RunnerId)
 			a.cpCreateSusbstitutions(versionToRun.RunnerId)
+			a.useSharedKeystoreOrDie(runtimeArgs)
 
+			logPolicy := mergeLogPolicy(projConfig.LogPolicy, a.CreateCmd.getLogPolicyFromArgStoreOrDie())
+			if err := validateLogPolicy(logPolicy); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			addLogPolicyRuntimeArgs(logPolicy, runtimeArgs)
+			secretEnv := a.CreateCmd.addEnvRuntimeArgsOrDie(runtimeArgs)
+			a.validateLimitsOrDie(runtimeArgs)
+
+			a.unlockKeystoreOrDie(runtimeArgs["KeystorePath"], runtimeArgs["KeystorePassPath"])
 			a.doPreRunSanityOrDie(runner)
 			a.doPrepareOrDie(runner)
-			a.doCreateOrDie(runner, runtimeArgs)
+			secretEnvFile := a.writeSecretEnvOrDie(projConfig, instanceID, secretEnv, runtimeArgs)
+			a.doCreateOrDie(runner, runtimeArgs, secretEnvFile)
+			extras := make(map[string]interface{})
+			if len(labels) != 0 {
+				extras["Labels"] = labels
+			}
+			if healthProbe != "" {
+				extras["HealthProbe"] = healthProbe
+			}
+			a.writeResourceExtrasOrDie(projConfig, instanceID, extras)
+			if healthTimeout != 0 {
+				err := a.waitHealthy(runner, instanceID, healthProbe, healthPeriod, healthTimeout)
+				if err != nil {
+					log.Error("Instance ", instanceID, " of project ", a.ProjectID, " did not become healthy: ", err)
+					if keepOnFailure {
+						log.Warning("Keeping instance ", instanceID, " as --keep-on-failure was given")
+					} else {
+						a.removeCreatedInstance(runner, instanceID, secretEnvFile)
+					}
+					os.Exit(1)
+				}
+			}
+			if dryRun {
+				util.PrintPlan()
+				return
+			}
 			if version == "" {
 				projConfig.CurrentVersion = versionToRun.Version
 				a.doUpdateCurrentVersionOrDie(projConfig)
@@ -193,9 +338,17 @@ func (a *app) setupCreateCommand() {
 	a.CreateCmd.ArgStore = make(map[string]interface{})
 
 	a.CreateCmd.ArgStore["version"] = a.CreateCmd.Cmd.Flags().StringP("version", "x", "", "runtime version override")
-	a.CreateCmd.ArgStore["instance-id"] = a.CreateCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id of spawned up resource")
+	a.CreateCmd.ArgStore["instance-id"] = a.CreateCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id of spawned up resource, \"auto\" to allocate next free id")
+	a.CreateCmd.ArgStore["label"] = a.CreateCmd.Cmd.Flags().StringToString("label", map[string]string{}, "labels to attach to spawned up resource, as key=value")
+	a.CreateCmd.ArgStore["health-probe"] = a.CreateCmd.Cmd.Flags().String("health-probe", "", "http url to probe for checking health of spawned up resource")
+	a.CreateCmd.ArgStore["health-period"] = a.CreateCmd.Cmd.Flags().Duration("health-period", 5*time.Second, "period for which spawned up resource has to stay healthy")
+	a.CreateCmd.ArgStore["health-timeout"] = a.CreateCmd.Cmd.Flags().Duration("health-timeout", time.Minute, "maximum time to wait for spawned up resource to become healthy, 0 to not wait")
+	a.CreateCmd.ArgStore["keep-on-failure"] = a.CreateCmd.Cmd.Flags().Bool("keep-on-failure", false, "keep spawned up resource if it does not become healthy, it is destroyed otherwise")
 	a.CreateCmd.ArgStore["skip-checksum"] = a.CreateCmd.Cmd.Flags().BoolP("skip-checksum", "s", false, "skip checksum verification while starting up binaries")
-	a.CreateCmd.ArgStore["runtime-args"] = a.CreateCmd.Cmd.Flags().StringToStringP("runtime-args", "r", map[string]string{}, "runtime arguments while starting up")
+	a.CreateCmd.ArgStore["runtime-args"] = a.CreateCmd.Cmd.Flags().StringToStringP("runtime-args", "r", map[string]string{}, "runtime arguments while starting up. MemoryLimit (e.g. 2G, caps resident memory) and CPUQuota (e.g. 150%) run programs in a systemd scope")
+	a.CreateCmd.ArgStore["dry-run"] = a.CreateCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
+	a.CreateCmd.addLogPolicyFlags("spawned up resource")
+	a.CreateCmd.addEnvFlags()
 }
 
 // Destroy command
@@ -217,37 +370,63 @@ func (a *app) setupDestroyCommand() {
 		Run: func(cmd *cobra.Command, args []string) {
 
 			// Extract runtime variables
-			instanceID := a.DestroyCmd.getStringFromArgStoreOrDie("instance-id")
+			dryRun := a.DestroyCmd.getBoolFromArgStoreOrDie("dry-run")
+			parallel := a.DestroyCmd.getIntFromArgStoreOrDie("parallel")
 
 			// Run application
 			projConfig := a.getProjectConfigOrDie()
-			runnerID, version := a.getResourceMetadataOrDie(projConfig, instanceID)
-			runner := a.getRunnerInstanceOrDie(runnerID,
-				version,
-				projConfig.Storage,
-				struct{}{},
-				true,
-				true,
-				instanceID)
-			a.doPreRunSanityOrDie(runner)
-			a.doDestroyOrDie(runner)
-			a.doPostRunOrDie(runner)
+			if dryRun {
+				util.EnableDryRun()
+			}
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.DestroyCmd, projConfig)
+			a.runOnInstancesOrDie("destroy", instanceIDs, parallel, func(instanceID string) error {
+				r, err := a.getResourceRunner(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				err = r.Destroy()
+				if err != nil {
+					return errors.New("Error while destroying: " + err.Error())
+				}
+				err = r.PostRun()
+				if err != nil {
+					return errors.New("Error while running post run: " + err.Error())
+				}
+				err = util.RemoveFileIfExists(a.getSecretEnvFileLocation(projConfig, instanceID))
+				if err != nil {
+					return errors.New("Error while removing secret environment: " + err.Error())
+				}
+				return runner.ArchiveInstanceKeyfile(projConfig.Storage, a.ProjectID, instanceID)
+			})
+			if dryRun {
+				util.PrintPlan()
+			}
 		},
 	}
 
 	a.DestroyCmd.ArgStore = make(map[string]interface{})
 
-	a.DestroyCmd.ArgStore["instance-id"] = a.DestroyCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id of resource to destroy")
+	a.DestroyCmd.ArgStore["instance-id"] = a.DestroyCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of resource to destroy, comma separated")
+	a.DestroyCmd.ArgStore["selector"] = a.DestroyCmd.Cmd.Flags().StringToString("selector", map[string]string{}, "destroy all resources with matching labels, as key=value")
+	a.DestroyCmd.ArgStore["all"] = a.DestroyCmd.Cmd.Flags().Bool("all", false, "destroy all resources of project")
+	a.DestroyCmd.ArgStore["parallel"] = a.DestroyCmd.Cmd.Flags().Int("parallel", 4, "maximum number of resources to destroy at once")
+	a.DestroyCmd.ArgStore["dry-run"] = a.DestroyCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
 }
 
 // Logs command
 func (a *app) setupLogsCommand() {
-	a.LogsCmd.Cmd = &cobra.Command{
-		Use:   a.LogsCmd.Use,
-		Short: a.LogsCmd.DescShort,
-		Long:  a.LogsCmd.DescLong,
+	a.setupLogsCommandFor(&a.LogsCmd, "")
+}
+
+// setupLogsCommandFor sets up c to tail logs of resources, only of their
+// program if one is given.
+func (a *app) setupLogsCommandFor(c *CommandDetails, program string) {
+	c.Cmd = &cobra.Command{
+		Use:   c.Use,
+		Short: c.DescShort,
+		Long:  c.DescLong,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			additionalTest := a.LogsCmd.AdditionalPreRunTest
+			additionalTest := c.AdditionalPreRunTest
 			err := a.setupDefaultConfigIfNotExists()
 			if err != nil {
 				return err
@@ -259,28 +438,82 @@ func (a *app) setupLogsCommand() {
 		Run: func(cmd *cobra.Command, args []string) {
 
 			// Extract runtime variables
-			instanceID := a.LogsCmd.getStringFromArgStoreOrDie("instance-id")
+			options := runner.LogOptions{
+				Lines:   c.getIntFromArgStoreOrDie("last"),
+				Follow:  c.getBoolFromArgStoreOrDie("follow") && !c.getBoolFromArgStoreOrDie("no-follow"),
+				Stream:  c.getStringFromArgStoreOrDie("stream"),
+				Program: program,
+				Raw:     c.getBoolFromArgStoreOrDie("raw"),
+			}
+			if program == "" {
+				options.Program = c.getStringFromArgStoreOrDie("program")
+			}
+			if options.Stream != "" && options.Stream != "stdout" && options.Stream != "stderr" {
+				log.Error("Invalid stream " + options.Stream + ", expected stdout or stderr")
+				os.Exit(1)
+			}
+			for arg, t := range map[string]*time.Time{"since": &options.Since, "until": &options.Until} {
+				if value := c.getStringFromArgStoreOrDie(arg); value != "" {
+					parsed, err := runner.ParseLogTime(value)
+					if err != nil {
+						log.Error("Invalid --"+arg+": ", err)
+						os.Exit(1)
+					}
+					*t = parsed
+				}
+			}
+			if grep := c.getStringFromArgStoreOrDie("grep"); grep != "" {
+				regex, err := regexp.Compile(grep)
+				if err != nil {
+					log.Error("Invalid --grep regex: ", err)
+					os.Exit(1)
+				}
+				options.Grep = regex
+			}
 
 			// Run application
 			projConfig := a.getProjectConfigOrDie()
-			runnerID, version := a.getResourceMetadataOrDie(projConfig, instanceID)
-			last := a.LogsCmd.getIntFromArgStoreOrDie("last")
-			runner := a.getRunnerInstanceOrDie(runnerID,
-				version,
-				projConfig.Storage,
-				struct{}{},
-				true,
-				true,
-				instanceID)
-			a.doPreRunSanityOrDie(runner)
-			runner.Logs(last)
+			var sources []runner.LogSource
+			for _, instanceID := range a.getTargetInstanceIDsOrDie(c, projConfig) {
+				r, err := a.getResourceRunner(projConfig, instanceID)
+				if err != nil {
+					log.Error("Error while reading logs of instance "+instanceID+": ", err)
+					os.Exit(1)
+				}
+				instanceSources, err := r.LogSources()
+				if err != nil {
+					log.Error("Error while reading logs of instance "+instanceID+": ", err)
+					os.Exit(1)
+				}
+				for _, s := range instanceSources {
+					s.Instance = instanceID
+					sources = append(sources, s)
+				}
+			}
+			err := runner.StreamLogs(runner.FilterLogSources(sources, options), options)
+			if err != nil {
+				log.Error("Error while reading logs: ", err)
+				os.Exit(1)
+			}
 		},
 	}
 
-	a.LogsCmd.ArgStore = make(map[string]interface{})
-
-	a.LogsCmd.ArgStore["instance-id"] = a.LogsCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id of resource to log")
-	a.LogsCmd.ArgStore["last"] = a.LogsCmd.Cmd.Flags().IntP("last", "n", 100, "number of last lines to tail in logfile")
+	c.ArgStore = make(map[string]interface{})
+
+	c.ArgStore["instance-id"] = c.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of resource to log, comma separated")
+	c.ArgStore["selector"] = c.Cmd.Flags().StringToString("selector", map[string]string{}, "log all resources with matching labels, as key=value")
+	c.ArgStore["all"] = c.Cmd.Flags().Bool("all", false, "log all resources of project")
+	c.ArgStore["last"] = c.Cmd.Flags().IntP("last", "n", 100, "number of last lines to show, 0 for all")
+	c.ArgStore["follow"] = c.Cmd.Flags().BoolP("follow", "f", true, "keep following logs for new lines")
+	c.ArgStore["no-follow"] = c.Cmd.Flags().Bool("no-follow", false, "exit after showing existing lines")
+	c.ArgStore["since"] = c.Cmd.Flags().String("since", "", "show lines newer than a timestamp (RFC3339 or 2006-01-02 15:04:05) or a duration such as 1h")
+	c.ArgStore["until"] = c.Cmd.Flags().String("until", "", "show lines older than a timestamp or a duration, implies --no-follow")
+	c.ArgStore["grep"] = c.Cmd.Flags().String("grep", "", "show lines matching regex")
+	c.ArgStore["stream"] = c.Cmd.Flags().String("stream", "", "show only stdout or stderr")
+	if program == "" {
+		c.ArgStore["program"] = c.Cmd.Flags().String("program", "", "show logs of one program of resource, such as relay, geth, bridge, gateway or mevproxy")
+	}
+	c.ArgStore["raw"] = c.Cmd.Flags().Bool("raw", false, "print lines as is, without decoration")
 }
 
 // Status command
@@ -299,29 +532,79 @@ func (a *app) setupStatusCommand() {
 			}
 			return nil
 		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.StatusCmd, projConfig)
+			a.runOnInstancesOrDie("status", instanceIDs, 1, func(instanceID string) error {
+				runner, err := a.getResourceRunner(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				err = runner.Status()
+				if err != nil {
+					return errors.New("Error while fetching status: " + err.Error())
+				}
+				if labels, err := a.getResourceLabels(projConfig, instanceID); err == nil && len(labels) != 0 {
+					log.Info("Labels")
+					util.PrettyPrintKVMap(labelsToKVMap(labels))
+				}
+				return nil
+			})
+		},
+	}
+
+	a.StatusCmd.ArgStore = make(map[string]interface{})
+
+	a.StatusCmd.ArgStore["instance-id"] = a.StatusCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of resource to find status of, comma separated")
+	a.StatusCmd.ArgStore["selector"] = a.StatusCmd.Cmd.Flags().StringToString("selector", map[string]string{}, "find status of all resources with matching labels, as key=value")
+	a.StatusCmd.ArgStore["all"] = a.StatusCmd.Cmd.Flags().Bool("all", false, "find status of all resources of project")
+}
+
+// Health command
+func (a *app) setupHealthCommand() {
+	a.HealthCmd.Cmd = &cobra.Command{
+		Use:   a.HealthCmd.Use,
+		Short: a.HealthCmd.DescShort,
+		Long:  a.HealthCmd.DescLong,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			additionalTest := a.HealthCmd.AdditionalPreRunTest
+			err := a.setupDefaultConfigIfNotExists()
+			if err != nil {
+				return err
+			} else if err == nil && additionalTest != nil {
+				return additionalTest(cmd, args)
+			}
+			return nil
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 
 			// Extract runtime variables
-			instanceID := a.StatusCmd.getStringFromArgStoreOrDie("instance-id")
+			httpProbe := a.HealthCmd.getStringFromArgStoreOrDie("http-probe")
+			probeTimeout := a.HealthCmd.getDurationFromArgStoreOrDie("probe-timeout")
 
 			// Run application
 			projConfig := a.getProjectConfigOrDie()
-			runnerID, version := a.getResourceMetadataOrDie(projConfig, instanceID)
-			runner := a.getRunnerInstanceOrDie(runnerID,
-				version,
-				projConfig.Storage,
-				struct{}{},
-				true,
-				true,
-				instanceID)
-			a.doPreRunSanityOrDie(runner)
-			a.doStatusOrDie(runner)
+			worst := runner.HealthOK
+			for _, instanceID := range a.getTargetInstanceIDsOrDie(&a.HealthCmd, projConfig) {
+				report := a.getHealthReport(projConfig, instanceID, httpProbe, probeTimeout)
+				a.printHealthReport(instanceID, report)
+				if report.Status > worst {
+					worst = report.Status
+				}
+			}
+			os.Exit(int(worst))
 		},
 	}
 
-	a.StatusCmd.ArgStore = make(map[string]interface{})
+	a.HealthCmd.ArgStore = make(map[string]interface{})
 
-	a.StatusCmd.ArgStore["instance-id"] = a.StatusCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id of resource to find status of")
+	a.HealthCmd.ArgStore["instance-id"] = a.HealthCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of resource to check health of, comma separated")
+	a.HealthCmd.ArgStore["selector"] = a.HealthCmd.Cmd.Flags().StringToString("selector", map[string]string{}, "check health of all resources with matching labels, as key=value")
+	a.HealthCmd.ArgStore["all"] = a.HealthCmd.Cmd.Flags().Bool("all", false, "check health of all resources of project")
+	a.HealthCmd.ArgStore["http-probe"] = a.HealthCmd.Cmd.Flags().String("http-probe", "", "http url to probe, overrides probe set during create")
+	a.HealthCmd.ArgStore["probe-timeout"] = a.HealthCmd.Cmd.Flags().Duration("probe-timeout", 2*time.Second, "timeout for every network probe")
 }
 
 // Recreate command
@@ -343,26 +626,43 @@ func (a *app) setupRecreateCommand() {
 		Run: func(cmd *cobra.Command, args []string) {
 
 			// Extract runtime variables
-			instanceID := a.RecreateCmd.getStringFromArgStoreOrDie("instance-id")
+			dryRun := a.RecreateCmd.getBoolFromArgStoreOrDie("dry-run")
 
 			// Run application
 			projConfig := a.getProjectConfigOrDie()
-			runnerID, version := a.getResourceMetadataOrDie(projConfig, instanceID)
-			runner := a.getRunnerInstanceOrDie(runnerID,
-				version,
-				projConfig.Storage,
-				struct{}{},
-				true,
-				true,
-				instanceID)
-			a.doPreRunSanityOrDie(runner)
-			a.doRecreateOrDie(runner)
+			if dryRun {
+				util.EnableDryRun()
+			}
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.RecreateCmd, projConfig)
+			a.runLifecycleOrDie(&a.RecreateCmd, "recreate", projConfig, instanceIDs, func(instanceID string) error {
+				runner, err := a.getResourceRunner(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				err = a.unlockInstanceKeystore(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				extras, _ := a.getResourceExtras(projConfig, instanceID)
+				err = runner.Recreate()
+				if err != nil {
+					return errors.New("Error while recreating: " + err.Error())
+				}
+				return a.writeResourceExtras(projConfig, instanceID, extras)
+			})
+			if dryRun {
+				util.PrintPlan()
+			}
 		},
 	}
 
 	a.RecreateCmd.ArgStore = make(map[string]interface{})
 
-	a.RecreateCmd.ArgStore["instance-id"] = a.RecreateCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id of resource to recreate")
+	a.RecreateCmd.ArgStore["instance-id"] = a.RecreateCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of resource to recreate, comma separated")
+	a.RecreateCmd.ArgStore["selector"] = a.RecreateCmd.Cmd.Flags().StringToString("selector", map[string]string{}, "recreate all resources with matching labels, as key=value")
+	a.RecreateCmd.ArgStore["all"] = a.RecreateCmd.Cmd.Flags().Bool("all", false, "recreate all resources of project")
+	a.RecreateCmd.addLifecycleFlags("recreate")
+	a.RecreateCmd.ArgStore["dry-run"] = a.RecreateCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
 }
 
 // Restart command
@@ -384,26 +684,135 @@ func (a *app) setupRestartCommand() {
 		Run: func(cmd *cobra.Command, args []string) {
 
 			// Extract runtime variables
-			instanceID := a.RestartCmd.getStringFromArgStoreOrDie("instance-id")
+			dryRun := a.RestartCmd.getBoolFromArgStoreOrDie("dry-run")
 
 			// Run application
 			projConfig := a.getProjectConfigOrDie()
-			runnerID, version := a.getResourceMetadataOrDie(projConfig, instanceID)
-			runner := a.getRunnerInstanceOrDie(runnerID,
-				version,
-				projConfig.Storage,
-				struct{}{},
-				true,
-				true,
-				instanceID)
-			a.doPreRunSanityOrDie(runner)
-			a.doRestartOrDie(runner)
+			if dryRun {
+				util.EnableDryRun()
+			}
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.RestartCmd, projConfig)
+			a.runLifecycleOrDie(&a.RestartCmd, "restart", projConfig, instanceIDs, func(instanceID string) error {
+				runner, err := a.getResourceRunner(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				err = a.unlockInstanceKeystore(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				err = runner.Restart()
+				if err != nil {
+					return errors.New("Error while restarting: " + err.Error())
+				}
+				return nil
+			})
+			if dryRun {
+				util.PrintPlan()
+			}
 		},
 	}
 
 	a.RestartCmd.ArgStore = make(map[string]interface{})
 
-	a.RestartCmd.ArgStore["instance-id"] = a.RestartCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id of resource to restart")
+	a.RestartCmd.ArgStore["instance-id"] = a.RestartCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of resource to restart, comma separated")
+	a.RestartCmd.ArgStore["selector"] = a.RestartCmd.Cmd.Flags().StringToString("selector", map[string]string{}, "restart all resources with matching labels, as key=value")
+	a.RestartCmd.ArgStore["all"] = a.RestartCmd.Cmd.Flags().Bool("all", false, "restart all resources of project")
+	a.RestartCmd.addLifecycleFlags("restart")
+	a.RestartCmd.ArgStore["dry-run"] = a.RestartCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
+}
+
+// Upgrade command
+func (a *app) setupUpgradeCommand() {
+	a.UpgradeCmd.Cmd = &cobra.Command{
+		Use:   a.UpgradeCmd.Use,
+		Short: a.UpgradeCmd.DescShort,
+		Long:  a.UpgradeCmd.DescLong,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			additionalTest := a.UpgradeCmd.AdditionalPreRunTest
+			err := a.setupDefaultConfigIfNotExists()
+			if err != nil {
+				return err
+			} else if err == nil && additionalTest != nil {
+				return additionalTest(cmd, args)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			version := a.UpgradeCmd.getStringFromArgStoreOrDie("version")
+			skipChecksum := a.UpgradeCmd.getBoolFromArgStoreOrDie("skip-checksum")
+			dryRun := a.UpgradeCmd.getBoolFromArgStoreOrDie("dry-run")
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			versionToRun := a.getVersionToRunOrDie(projConfig.UpdatePolicy, version)
+			if dryRun {
+				util.EnableDryRun()
+			}
+			log.Info("Upgrading to version ", versionToRun.Version, " (runner ", versionToRun.RunnerId, ")")
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.UpgradeCmd, projConfig)
+			var prepareLock sync.Mutex
+			a.runLifecycleOrDie(&a.UpgradeCmd, "upgrade", projConfig, instanceIDs, func(instanceID string) error {
+				oldRunner, err := a.getResourceRunner(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				_, oldVersion, _ := a.getResourceMetadata(projConfig, instanceID)
+				if oldVersion == versionToRun.Version {
+					log.Info("Instance ", instanceID, " already runs version ", oldVersion)
+					return nil
+				}
+				runtimeArgs, err := a.getResourceRuntimeArgs(projConfig, instanceID)
+				if err != nil {
+					return errors.New("Error while reading resource: " + err.Error())
+				}
+				err = a.unlockInstanceKeystore(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				extras, _ := a.getResourceExtras(projConfig, instanceID)
+
+				newRunner, err := a.RunnerProvider(versionToRun.RunnerId, versionToRun.Version, projConfig.Storage, versionToRun.RunnerData, false, skipChecksum, instanceID)
+				if err != nil {
+					return errors.New("Error while getting project runner: " + err.Error())
+				}
+				prepareLock.Lock()
+				err = newRunner.Prepare()
+				prepareLock.Unlock()
+				if err != nil {
+					return errors.New("Error while doing preparation: " + err.Error())
+				}
+
+				err = runner.Replace(oldRunner, func() error {
+					return newRunner.Create(runtimeArgs)
+				})
+				if err != nil {
+					return errors.New("Error while upgrading: " + err.Error())
+				}
+				return a.writeResourceExtras(projConfig, instanceID, extras)
+			})
+			if dryRun {
+				util.PrintPlan()
+				return
+			}
+			if version == "" {
+				projConfig.CurrentVersion = versionToRun.Version
+				a.doUpdateCurrentVersionOrDie(projConfig)
+			}
+		},
+	}
+
+	a.UpgradeCmd.ArgStore = make(map[string]interface{})
+
+	a.UpgradeCmd.ArgStore["version"] = a.UpgradeCmd.Cmd.Flags().StringP("version", "x", "", "runtime version to upgrade to")
+	a.UpgradeCmd.ArgStore["instance-id"] = a.UpgradeCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of resource to upgrade, comma separated")
+	a.UpgradeCmd.ArgStore["selector"] = a.UpgradeCmd.Cmd.Flags().StringToString("selector", map[string]string{}, "upgrade all resources with matching labels, as key=value")
+	a.UpgradeCmd.ArgStore["all"] = a.UpgradeCmd.Cmd.Flags().Bool("all", false, "upgrade all resources of project")
+	a.UpgradeCmd.ArgStore["skip-checksum"] = a.UpgradeCmd.Cmd.Flags().BoolP("skip-checksum", "s", false, "skip checksum verification while starting up binaries")
+	a.UpgradeCmd.ArgStore["dry-run"] = a.UpgradeCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
+	a.UpgradeCmd.addLifecycleFlags("upgrade")
 }
 
 // Versions command
@@ -534,6 +943,7 @@ func (a *app) setupConfigModifyCommand() {
 			storage := a.ConfigModifyCmd.getStringFromArgStoreOrDie("storage")
 			runtime := a.ConfigModifyCmd.getStringFromArgStoreOrDie("runtime")
 			forceRuntime := a.ConfigModifyCmd.getBoolFromArgStoreOrDie("force-runtime")
+			serviceUser := a.ConfigModifyCmd.getStringFromArgStoreOrDie("service-user")
 
 			// Run application
 			projectConfigMod := a.getProjectConfigModOrProjectConfigBase()
@@ -569,6 +979,23 @@ func (a *app) setupConfigModifyCommand() {
 				projectConfigMod.Storage = storage
 			}
 
+			if a.ConfigModifyCmd.Cmd.Flags().Changed("service-user") {
+				if serviceUser != "" {
+					if _, err := user.Lookup(serviceUser); err != nil {
+						log.Error("Error while looking up service user: ", err, ", create it using marlinctl service-user setup")
+						os.Exit(1)
+					}
+				}
+				projectConfigMod.ServiceUser = serviceUser
+			}
+
+			logPolicy := mergeLogPolicy(projectConfigMod.LogPolicy, a.ConfigModifyCmd.getLogPolicyFromArgStoreOrDie())
+			if err := validateLogPolicy(logPolicy); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			projectConfigMod.LogPolicy = logPolicy
+
 			if runtime != "" {
 				suitableRuntimes := util.GetRuntimes()
 				if !forceRuntime {
@@ -607,6 +1034,8 @@ func (a *app) setupConfigModifyCommand() {
 	a.ConfigModifyCmd.ArgStore["storage"] = a.ConfigModifyCmd.Cmd.Flags().StringP("storage", "l", "", "Storage location")
 	a.ConfigModifyCmd.ArgStore["runtime"] = a.ConfigModifyCmd.Cmd.Flags().StringP("runtime", "r", "", "Runtime to use")
 	a.ConfigModifyCmd.ArgStore["force-runtime"] = a.ConfigModifyCmd.Cmd.Flags().BoolP("force-runtime", "f", false, "Forcefully set runtime")
+	a.ConfigModifyCmd.ArgStore["service-user"] = a.ConfigModifyCmd.Cmd.Flags().String("service-user", "", "User to run programs of resources created afterwards as, empty for user running marlinctl")
+	a.ConfigModifyCmd.addLogPolicyFlags("resources created afterwards")
 }
 
 // Config Reset command
@@ -735,12 +1164,8 @@ func (a *app) setupKeystoreCreateCommand() {
 				}
 			}
 
-			home, err := util.GetUser()
-			if err == nil {
-				log.Info("creating keystore...")
-				keystoreDir := home.HomeDir + "/.marlin/ctl/storage/projects/" + a.ProjectID + "/common/keystore"
-				err = keystore.Create(keystoreDir, passphrase)
-			}
+			log.Info("creating keystore...")
+			err := keystore.Create(a.getKeystoreDirOrDie(&a.KeystoreCreateCmd), passphrase)
 			if err != nil {
 				log.Error("Error while creating keystore for project "+a.ProjectID+": ", err)
 				os.Exit(1)
@@ -749,6 +1174,7 @@ func (a *app) setupKeystoreCreateCommand() {
 	}
 
 	a.KeystoreCreateCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreCreateCmd.addKeystoreNameFlag()
 	a.KeystoreCreateCmd.ArgStore["pass-path"] = a.KeystoreCreateCmd.Cmd.Flags().StringP("pass-path", "p", "", "path to the passphrase file")
 }
 
@@ -768,15 +1194,31 @@ func (a *app) setupKeystoreDestroyCommand() {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			home, err := util.GetUser()
-			if err == nil {
-				keystoreDir := home.HomeDir + "/.marlin/ctl/storage/projects/" + a.ProjectID + "/common/keystore"
-				err = keystore.Destroy(keystoreDir)
+			address := a.KeystoreDestroyCmd.getStringFromArgStoreOrDie("address")
+			force := a.KeystoreDestroyCmd.getBoolFromArgStoreOrDie("force")
+			keystoreDir := a.getKeystoreDirOrDie(&a.KeystoreDestroyCmd)
+			acc, err := keystore.FindAccount(keystoreDir, address)
+			if err != nil {
+				log.Error("Error while destroying keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
 			}
+			if users := getKeystoreUsersOrDie(acc.Path); len(users) != 0 {
+				for _, instance := range users {
+					log.Error("Account ", acc.Address, " is in use by instance ", instance.InstanceID, " of ", instance.ProjectID)
+				}
+				log.Error("Destroy instances using account, or recreate them with a different keystore, before destroying it")
+				os.Exit(1)
+			}
+			err = keystore.Destroy(keystoreDir, acc.Address, force)
 			if err != nil {
 				log.Error("Error while destroying keystore for project "+a.ProjectID+": ", err)
 				os.Exit(1)
 			}
 		},
 	}
+
+	a.KeystoreDestroyCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreDestroyCmd.addKeystoreNameFlag()
+	a.KeystoreDestroyCmd.ArgStore["address"] = a.KeystoreDestroyCmd.Cmd.Flags().StringP("address", "a", "", "address of account to destroy, default account if not given")
+	a.KeystoreDestroyCmd.ArgStore["force"] = a.KeystoreDestroyCmd.Cmd.Flags().Bool("force", false, "destroy account even if it was not backed up recently")
 }
@@ -0,0 +1,123 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/types"
+	log "github.com/sirupsen/logrus"
+)
+
+func (c *CommandDetails) addEnvFlags() {
+	c.ArgStore["env"] = c.Cmd.Flags().StringArray("env", []string{}, "environment variable to start programs of spawned up resource with, as KEY=VALUE")
+	c.ArgStore["env-file"] = c.Cmd.Flags().String("env-file", "", "file holding environment variables to start programs of spawned up resource with, one KEY=VALUE per line")
+	c.ArgStore["secret-env"] = c.Cmd.Flags().StringSlice("secret-env", []string{}, "names of environment variables whose values are secret, kept out of resource file and supervisor confs")
+}
+
+// addEnvRuntimeArgsOrDie adds environment variables given by --env and
+// --env-file to Environment runtime argument and returns those marked secret
+// by --secret-env, which are written to a file of their own instead.
+func (c *CommandDetails) addEnvRuntimeArgsOrDie(runtimeArgs map[string]string) map[string]string {
+	envFile := c.getStringFromArgStoreOrDie("env-file")
+	envs := c.getStringSliceFromArgStoreOrDie("env")
+	secretKeys := c.getStringSliceFromArgStoreOrDie("secret-env")
+
+	env := make(map[string]string)
+	if envFile != "" {
+		data, err := ioutil.ReadFile(util.ExpandTilde(envFile))
+		if err != nil {
+			log.Error("Error while reading env file: ", err)
+			os.Exit(1)
+		}
+		env, err = util.ParseEnv(string(data))
+		if err != nil {
+			log.Error("Error while parsing env file ", envFile, ": ", err)
+			os.Exit(1)
+		}
+	}
+	for _, e := range envs {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			log.Error("Invalid environment variable ", e, ", expected KEY=VALUE")
+			os.Exit(1)
+		}
+		env[kv[0]] = kv[1]
+	}
+
+	secretEnv := make(map[string]string)
+	for _, k := range secretKeys {
+		v, ok := env[k]
+		if !ok {
+			log.Error("Secret environment variable ", k, " is not given by --env or --env-file")
+			os.Exit(1)
+		}
+		secretEnv[k] = v
+		delete(env, k)
+	}
+	for k := range secretEnv {
+		if err := util.ValidateEnvKey(k); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	}
+
+	if len(env) != 0 {
+		environment := util.FormatEnv(env)
+		if runtimeArgs["Environment"] != "" {
+			environment = runtimeArgs["Environment"] + " " + environment
+		}
+		runtimeArgs["Environment"] = environment
+	}
+	return secretEnv
+}
+
+func (a *app) getSecretEnvFileLocation(projectConfig types.Project, instanceId string) string {
+	return projectConfig.Storage + "/common/project_" + a.ProjectID + "_instance" + instanceId + ".env"
+}
+
+// writeSecretEnvOrDie writes secret environment of a resource about to be
+// created to a file readable only by user its programs run as, and points
+// SecretEnvFile runtime argument to it. Returns location of file written.
+func (a *app) writeSecretEnvOrDie(projectConfig types.Project, instanceId string, secretEnv map[string]string, runtimeArgs map[string]string) string {
+	if len(secretEnv) == 0 {
+		return ""
+	}
+	if util.FileExists(a.getResourceFileLocation(projectConfig, instanceId)) {
+		log.Error("Resource file already exisits, cannot create a new instance: ", a.getResourceFileLocation(projectConfig, instanceId))
+		os.Exit(1)
+	}
+	serviceUser, err := util.GetServiceUser(a.ProjectID)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	location := a.getSecretEnvFileLocation(projectConfig, instanceId)
+	err = util.CreateDirPathIfNotExists(projectConfig.Storage + "/common")
+	if err == nil {
+		err = util.WriteSecretEnvFile(location, secretEnv, serviceUser)
+	}
+	if err != nil {
+		log.Error("Error while writing secret environment: ", err)
+		os.Exit(1)
+	}
+	runtimeArgs["SecretEnvFile"] = location
+	return location
+}
@@ -0,0 +1,200 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/marlinprotocol/ctl2/modules/runner/relay_eth"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// SetupGethCommands sets up commands managing geth run alongside relay (eth)
+// instances by runners which manage geth.
+func (a *app) SetupGethCommands(_statusCmd CommandDetails, _dataDirCmd CommandDetails, _pruneCmd CommandDetails) {
+	a.shallowCopyDescriptions(&a.GethStatusCmd, _statusCmd)
+	a.setupGethStatusCommand()
+
+	a.shallowCopyDescriptions(&a.GethDataDirCmd, _dataDirCmd)
+	a.setupGethDataDirCommand()
+
+	a.shallowCopyDescriptions(&a.GethPruneCmd, _pruneCmd)
+	a.setupGethPruneCommand()
+}
+
+func (a *app) gethPreRunE(c *CommandDetails) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		additionalTest := c.AdditionalPreRunTest
+		err := a.setupDefaultConfigIfNotExists()
+		if err != nil {
+			return err
+		} else if err == nil && additionalTest != nil {
+			return additionalTest(cmd, args)
+		}
+		return nil
+	}
+}
+
+func (c *CommandDetails) addGethTargetFlags(verb string) {
+	c.ArgStore["instance-id"] = c.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of relay whose geth to "+verb+", comma separated")
+	c.ArgStore["selector"] = c.Cmd.Flags().StringToString("selector", map[string]string{}, verb+" geth of all relays with matching labels, as key=value")
+	c.ArgStore["all"] = c.Cmd.Flags().Bool("all", false, verb+" geth of all relays of project")
+}
+
+// Geth status command
+func (a *app) setupGethStatusCommand() {
+	a.GethStatusCmd.Cmd = &cobra.Command{
+		Use:     a.GethStatusCmd.Use,
+		Short:   a.GethStatusCmd.DescShort,
+		Long:    a.GethStatusCmd.DescLong,
+		PreRunE: a.gethPreRunE(&a.GethStatusCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.GethStatusCmd, projConfig)
+			t := util.GetTable()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Instance", "Sync Mode", "Status", "Block", "Highest Block", "Peers"})
+			failed := false
+			for _, instanceID := range instanceIDs {
+				geth, err := relay_eth.GetGeth(projConfig.Storage, instanceID)
+				if err != nil {
+					log.Error("Instance ", instanceID, ": ", err)
+					failed = true
+					continue
+				}
+				status, err := geth.SyncStatus()
+				if err != nil {
+					log.Error("Instance ", geth.InstanceId, ": ", err)
+					failed = true
+					continue
+				}
+				state := "synced"
+				if status.Syncing {
+					state = "syncing"
+					if status.HighestBlock > status.StartingBlock && status.CurrentBlock >= status.StartingBlock {
+						state += fmt.Sprintf(" (%.2f%%)", 100*float64(status.CurrentBlock-status.StartingBlock)/float64(status.HighestBlock-status.StartingBlock))
+					}
+				}
+				t.AppendRow(table.Row{geth.InstanceId, geth.SyncMode, state, status.CurrentBlock, status.HighestBlock, status.Peers})
+			}
+			t.Render()
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	a.GethStatusCmd.ArgStore = make(map[string]interface{})
+
+	a.GethStatusCmd.addGethTargetFlags("show status of")
+}
+
+// Geth datadir command
+func (a *app) setupGethDataDirCommand() {
+	a.GethDataDirCmd.Cmd = &cobra.Command{
+		Use:     a.GethDataDirCmd.Use,
+		Short:   a.GethDataDirCmd.DescShort,
+		Long:    a.GethDataDirCmd.DescLong,
+		PreRunE: a.gethPreRunE(&a.GethDataDirCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.GethDataDirCmd, projConfig)
+			t := util.GetTable()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Instance", "Sync Mode", "Data Directory", "Size"})
+			failed := false
+			for _, instanceID := range instanceIDs {
+				geth, err := relay_eth.GetGeth(projConfig.Storage, instanceID)
+				if err != nil {
+					log.Error("Instance ", instanceID, ": ", err)
+					failed = true
+					continue
+				}
+				size, err := geth.DataDirSize()
+				if err != nil {
+					log.Error("Error while measuring data directory of instance ", geth.InstanceId, ": ", err)
+					failed = true
+					continue
+				}
+				t.AppendRow(table.Row{geth.InstanceId, geth.SyncMode, geth.DataDir, common.StorageSize(size).String()})
+			}
+			t.Render()
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	a.GethDataDirCmd.ArgStore = make(map[string]interface{})
+
+	a.GethDataDirCmd.addGethTargetFlags("show data directory of")
+}
+
+// Geth prune command
+func (a *app) setupGethPruneCommand() {
+	a.GethPruneCmd.Cmd = &cobra.Command{
+		Use:     a.GethPruneCmd.Use,
+		Short:   a.GethPruneCmd.DescShort,
+		Long:    a.GethPruneCmd.DescLong,
+		PreRunE: a.gethPreRunE(&a.GethPruneCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			dryRun := a.GethPruneCmd.getBoolFromArgStoreOrDie("dry-run")
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			if dryRun {
+				util.EnableDryRun()
+			}
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.GethPruneCmd, projConfig)
+			a.runOnInstancesOrDie("geth prune", instanceIDs, 1, func(instanceID string) error {
+				geth, err := relay_eth.GetGeth(projConfig.Storage, instanceID)
+				if err != nil {
+					return err
+				}
+				sizeBefore, _ := geth.DataDirSize()
+				err = geth.Prune()
+				if err != nil {
+					return err
+				}
+				if !dryRun {
+					sizeAfter, _ := geth.DataDirSize()
+					log.Info("Pruned geth of instance ", geth.InstanceId, ": ", common.StorageSize(sizeBefore).String(), " -> ", common.StorageSize(sizeAfter).String())
+				}
+				return nil
+			})
+			if dryRun {
+				util.PrintPlan()
+			}
+		},
+	}
+
+	a.GethPruneCmd.ArgStore = make(map[string]interface{})
+
+	a.GethPruneCmd.addGethTargetFlags("prune")
+	a.GethPruneCmd.ArgStore["dry-run"] = a.GethPruneCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
+}
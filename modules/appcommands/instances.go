@@ -0,0 +1,276 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/types"
+	log "github.com/sirupsen/logrus"
+)
+
+var labelKeyRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+func (a *app) getResourceFileLocation(projectConfig types.Project, instanceId string) string {
+	return projectConfig.Storage + "/common/project_" + a.ProjectID + "_instance" + instanceId + ".resource"
+}
+
+func (a *app) getInstanceIDs(projectConfig types.Project) ([]string, error) {
+	prefix := projectConfig.Storage + "/common/project_" + a.ProjectID + "_instance"
+	files, err := filepath.Glob(prefix + "*.resource")
+	if err != nil {
+		return nil, err
+	}
+	var instanceIDs []string
+	for _, f := range files {
+		instanceIDs = append(instanceIDs, strings.TrimSuffix(strings.TrimPrefix(f, prefix), ".resource"))
+	}
+	sort.Strings(instanceIDs)
+	return instanceIDs, nil
+}
+
+func (a *app) allocateInstanceIDOrDie(projectConfig types.Project) string {
+	instanceIDs, err := a.getInstanceIDs(projectConfig)
+	if err != nil {
+		log.Error("Error while listing instances of project "+a.ProjectID+": ", err)
+		os.Exit(1)
+	}
+	taken := make(map[int]bool)
+	for _, id := range instanceIDs {
+		if n, err := strconv.Atoi(id); err == nil {
+			taken[n] = true
+		}
+	}
+	n := 1
+	for taken[n] {
+		n++
+	}
+	instanceID := fmt.Sprintf("%03d", n)
+	log.Info("Allocated instance id ", instanceID)
+	return instanceID
+}
+
+// forProject returns app managing instances of given project, for operations
+// reaching into other projects such as ones on shared keystores.
+func (a *app) forProject(projectID string) *app {
+	if projectID == a.ProjectID {
+		return a
+	}
+	return &app{ProjectID: projectID, RunnerProvider: projects.RunnerProviders[projectID]}
+}
+
+func (a *app) getResourceLabels(projectConfig types.Project, instanceId string) (map[string]string, error) {
+	file, err := ioutil.ReadFile(a.getResourceFileLocation(projectConfig, instanceId))
+	if err != nil {
+		return nil, err
+	}
+	var resourceLabels = struct {
+		Labels map[string]string `json:"Labels"`
+	}{}
+	err = json.Unmarshal(file, &resourceLabels)
+	if err != nil {
+		return nil, err
+	}
+	return resourceLabels.Labels, nil
+}
+
+// getResourceRuntimeArgs returns runtime arguments which would spawn up a
+// resource identical to an existing one on a different version. Arguments
+// pointing into storage of the version currently run are left out so that
+// runner defaults for the new version apply.
+func (a *app) getResourceRuntimeArgs(projectConfig types.Project, instanceId string) (map[string]string, error) {
+	resData, err := a.getResourceData(projectConfig, instanceId)
+	if err != nil {
+		return nil, err
+	}
+	version, _ := resData["Version"].(string)
+	versionStorage := projectConfig.Storage + "/" + version + "/"
+	runtimeArgs := make(map[string]string)
+	for k, v := range resData {
+		value, ok := v.(string)
+		if !ok || k == "Runner" || k == "Version" || k == "StartTime" || isResourceExtraKey(k) || strings.HasPrefix(value, versionStorage) {
+			continue
+		}
+		runtimeArgs[k] = value
+	}
+	return runtimeArgs, nil
+}
+
+func (a *app) getResourceData(projectConfig types.Project, instanceId string) (map[string]interface{}, error) {
+	file, err := ioutil.ReadFile(a.getResourceFileLocation(projectConfig, instanceId))
+	if err != nil {
+		return nil, err
+	}
+	var resData map[string]interface{}
+	err = json.Unmarshal(file, &resData)
+	return resData, err
+}
+
+// Resource extras are kept in resource files by marlinctl itself rather than
+// by runners, and need to be carried over whenever a runner rewrites them.
+var resourceExtraKeys = []string{"Labels", "HealthProbe"}
+
+func isResourceExtraKey(key string) bool {
+	for _, k := range resourceExtraKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *app) getResourceExtras(projectConfig types.Project, instanceId string) (map[string]interface{}, error) {
+	resData, err := a.getResourceData(projectConfig, instanceId)
+	if err != nil {
+		return nil, err
+	}
+	extras := make(map[string]interface{})
+	for _, k := range resourceExtraKeys {
+		if v, ok := resData[k]; ok {
+			extras[k] = v
+		}
+	}
+	return extras, nil
+}
+
+func (a *app) writeResourceExtras(projectConfig types.Project, instanceId string, extras map[string]interface{}) error {
+	if len(extras) == 0 {
+		return nil
+	}
+	resFileLocation := a.getResourceFileLocation(projectConfig, instanceId)
+	if util.IsDryRun() {
+		util.RecordPlanStep("set resource extras", resFileLocation, fmt.Sprint(extras))
+		return nil
+	}
+	resData, err := a.getResourceData(projectConfig, instanceId)
+	if err != nil {
+		return err
+	}
+	for k, v := range extras {
+		resData[k] = v
+	}
+	fileData, err := json.MarshalIndent(resData, "", " ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFile(resFileLocation, fileData, 0644)
+}
+
+func (a *app) writeResourceExtrasOrDie(projectConfig types.Project, instanceId string, extras map[string]interface{}) {
+	err := a.writeResourceExtras(projectConfig, instanceId, extras)
+	if err != nil {
+		log.Error("Error while writing resource file for project "+a.ProjectID+" instance "+instanceId+": ", err)
+		os.Exit(1)
+	}
+}
+
+func validateLabels(labels map[string]string) error {
+	for k := range labels {
+		if !labelKeyRegex.MatchString(k) {
+			return errors.New("Invalid label key: " + k)
+		}
+	}
+	return nil
+}
+
+func matchesSelector(labels map[string]string, selector map[string]string) bool {
+	for k, v := range selector {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// getInstanceIDFlagOrDie returns instance ids given using --instance-id.
+func (c *CommandDetails) getInstanceIDFlagOrDie() []string {
+	var selected []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(c.getStringFromArgStoreOrDie("instance-id"), ",") {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			selected = append(selected, id)
+		}
+	}
+	if len(selected) == 0 {
+		log.Error("No instance id provided")
+		os.Exit(1)
+	}
+	return selected
+}
+
+// getTargetInstanceIDsOrDie resolves instances a command should act upon:
+// every instance with --all, instances matching --selector if one is given,
+// comma separated --instance-id otherwise.
+func (a *app) getTargetInstanceIDsOrDie(c *CommandDetails, projectConfig types.Project) []string {
+	all := c.getBoolFromArgStoreOrDie("all")
+	selector := c.getStringToStringFromArgStoreOrDie("selector")
+	if !all && len(selector) == 0 {
+		return c.getInstanceIDFlagOrDie()
+	}
+
+	instanceIDs, err := a.getInstanceIDs(projectConfig)
+	if err != nil {
+		log.Error("Error while listing instances of project "+a.ProjectID+": ", err)
+		os.Exit(1)
+	}
+	if all && len(selector) == 0 {
+		if len(instanceIDs) == 0 {
+			log.Error("No instances of project " + a.ProjectID + " found")
+			os.Exit(1)
+		}
+		log.Info("Selected instances: ", strings.Join(instanceIDs, ", "))
+		return instanceIDs
+	}
+	var selected []string
+	for _, id := range instanceIDs {
+		labels, err := a.getResourceLabels(projectConfig, id)
+		if err != nil {
+			log.Warning("Skipping instance ", id, ", cannot read labels: ", err)
+			continue
+		}
+		if matchesSelector(labels, selector) {
+			selected = append(selected, id)
+		}
+	}
+	if len(selected) == 0 {
+		log.Error("No instances of project "+a.ProjectID+" match selector ", selector)
+		os.Exit(1)
+	}
+	log.Info("Selected instances: ", strings.Join(selected, ", "))
+	return selected
+}
+
+func labelsToKVMap(labels map[string]string) map[string]interface{} {
+	kvMap := make(map[string]interface{})
+	for k, v := range labels {
+		kvMap[k] = v
+	}
+	return kvMap
+}
@@ -0,0 +1,234 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"os"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/marlinprotocol/ctl2/modules/runner"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// SetupKeyfileCommands sets up commands managing keyfiles gateway instances
+// identify themselves with, generated for chain using gateway executable
+// named generator.
+func (a *app) SetupKeyfileCommands(chain string, generator string, _showCmd CommandDetails, _generateCmd CommandDetails, _importCmd CommandDetails, _rotateCmd CommandDetails) {
+	a.shallowCopyDescriptions(&a.KeyfileShowCmd, _showCmd)
+	a.setupKeyfileShowCommand()
+
+	a.shallowCopyDescriptions(&a.KeyfileGenerateCmd, _generateCmd)
+	a.setupKeyfileGenerateCommand(chain, generator)
+
+	a.shallowCopyDescriptions(&a.KeyfileImportCmd, _importCmd)
+	a.setupKeyfileImportCommand()
+
+	a.shallowCopyDescriptions(&a.KeyfileRotateCmd, _rotateCmd)
+	a.setupKeyfileRotateCommand(chain)
+}
+
+func (a *app) keyfilePreRunE(c *CommandDetails) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		additionalTest := c.AdditionalPreRunTest
+		err := a.setupDefaultConfigIfNotExists()
+		if err != nil {
+			return err
+		} else if err == nil && additionalTest != nil {
+			return additionalTest(cmd, args)
+		}
+		return nil
+	}
+}
+
+func logKeyfile(instanceID string, keyfile runner.Keyfile) {
+	if util.IsDryRun() {
+		return
+	}
+	log.Info("Keyfile of instance ", instanceID, " written to ", keyfile.Location, ", node id ", keyfile.NodeId)
+}
+
+// Keyfile show command
+func (a *app) setupKeyfileShowCommand() {
+	a.KeyfileShowCmd.Cmd = &cobra.Command{
+		Use:     a.KeyfileShowCmd.Use,
+		Short:   a.KeyfileShowCmd.DescShort,
+		Long:    a.KeyfileShowCmd.DescLong,
+		PreRunE: a.keyfilePreRunE(&a.KeyfileShowCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.KeyfileShowCmd, projConfig)
+			t := util.GetTable()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Instance", "Keyfile", "Node ID"})
+			failed := false
+			for _, instanceID := range instanceIDs {
+				keyfile, err := runner.GetInstanceKeyfile(projConfig.Storage, a.ProjectID, instanceID)
+				if err != nil {
+					log.Error("Instance ", instanceID, ": ", err)
+					failed = true
+					continue
+				}
+				t.AppendRow(table.Row{instanceID, keyfile.Location, keyfile.NodeId})
+			}
+			t.Render()
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	a.KeyfileShowCmd.ArgStore = make(map[string]interface{})
+
+	a.KeyfileShowCmd.ArgStore["instance-id"] = a.KeyfileShowCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) whose keyfile to show, comma separated")
+	a.KeyfileShowCmd.ArgStore["selector"] = a.KeyfileShowCmd.Cmd.Flags().StringToString("selector", map[string]string{}, "show keyfile of all instances with matching labels, as key=value")
+	a.KeyfileShowCmd.ArgStore["all"] = a.KeyfileShowCmd.Cmd.Flags().Bool("all", false, "show keyfile of all instances of project")
+}
+
+// Keyfile generate command
+func (a *app) setupKeyfileGenerateCommand(chain string, generator string) {
+	a.KeyfileGenerateCmd.Cmd = &cobra.Command{
+		Use:     a.KeyfileGenerateCmd.Use,
+		Short:   a.KeyfileGenerateCmd.DescShort,
+		Long:    a.KeyfileGenerateCmd.DescLong,
+		PreRunE: a.keyfilePreRunE(&a.KeyfileGenerateCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			dryRun := a.KeyfileGenerateCmd.getBoolFromArgStoreOrDie("dry-run")
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			if dryRun {
+				util.EnableDryRun()
+			}
+			executable := projConfig.Storage + "/" + projConfig.CurrentVersion + "/" + generator
+			for _, instanceID := range a.KeyfileGenerateCmd.getInstanceIDFlagOrDie() {
+				keyfile, err := runner.GenerateInstanceKeyfile(projConfig.Storage, a.ProjectID, chain, executable, instanceID)
+				if err != nil {
+					log.Error("Error while generating keyfile of instance ", instanceID, ": ", err)
+					os.Exit(1)
+				}
+				logKeyfile(instanceID, keyfile)
+			}
+			if dryRun {
+				util.PrintPlan()
+			}
+		},
+	}
+
+	a.KeyfileGenerateCmd.ArgStore = make(map[string]interface{})
+
+	a.KeyfileGenerateCmd.ArgStore["instance-id"] = a.KeyfileGenerateCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) to generate keyfile for, comma separated")
+	a.KeyfileGenerateCmd.ArgStore["dry-run"] = a.KeyfileGenerateCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
+}
+
+// Keyfile import command
+func (a *app) setupKeyfileImportCommand() {
+	a.KeyfileImportCmd.Cmd = &cobra.Command{
+		Use:     a.KeyfileImportCmd.Use,
+		Short:   a.KeyfileImportCmd.DescShort,
+		Long:    a.KeyfileImportCmd.DescLong,
+		PreRunE: a.keyfilePreRunE(&a.KeyfileImportCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			src := util.ExpandTilde(a.KeyfileImportCmd.getStringFromArgStoreOrDie("file"))
+			dryRun := a.KeyfileImportCmd.getBoolFromArgStoreOrDie("dry-run")
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			if dryRun {
+				util.EnableDryRun()
+			}
+			for _, instanceID := range a.KeyfileImportCmd.getInstanceIDFlagOrDie() {
+				keyfile, err := runner.ImportInstanceKeyfile(projConfig.Storage, a.ProjectID, instanceID, src)
+				if err != nil {
+					log.Error("Error while importing keyfile of instance ", instanceID, ": ", err)
+					os.Exit(1)
+				}
+				logKeyfile(instanceID, keyfile)
+			}
+			if dryRun {
+				util.PrintPlan()
+			}
+		},
+	}
+
+	a.KeyfileImportCmd.ArgStore = make(map[string]interface{})
+
+	a.KeyfileImportCmd.ArgStore["instance-id"] = a.KeyfileImportCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) to import keyfile for, comma separated")
+	a.KeyfileImportCmd.ArgStore["file"] = a.KeyfileImportCmd.Cmd.Flags().String("file", "", "keyfile to import")
+	a.KeyfileImportCmd.ArgStore["dry-run"] = a.KeyfileImportCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
+	a.KeyfileImportCmd.Cmd.MarkFlagRequired("file")
+}
+
+// Keyfile rotate command
+func (a *app) setupKeyfileRotateCommand(chain string) {
+	a.KeyfileRotateCmd.Cmd = &cobra.Command{
+		Use:     a.KeyfileRotateCmd.Use,
+		Short:   a.KeyfileRotateCmd.DescShort,
+		Long:    a.KeyfileRotateCmd.DescLong,
+		PreRunE: a.keyfilePreRunE(&a.KeyfileRotateCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			src := util.ExpandTilde(a.KeyfileRotateCmd.getStringFromArgStoreOrDie("file"))
+			dryRun := a.KeyfileRotateCmd.getBoolFromArgStoreOrDie("dry-run")
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			if dryRun {
+				util.EnableDryRun()
+			}
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.KeyfileRotateCmd, projConfig)
+			if src != "" && len(instanceIDs) > 1 {
+				log.Error("--file cannot be given when replacing keyfiles of more than one instance, instances would share node id")
+				os.Exit(1)
+			}
+			a.runOnInstancesOrDie("keyfile rotate", instanceIDs, 1, func(instanceID string) error {
+				r, err := a.getResourceRunner(projConfig, instanceID)
+				if err != nil {
+					return err
+				}
+				old, _ := runner.GetInstanceKeyfile(projConfig.Storage, a.ProjectID, instanceID)
+				keyfile, err := runner.RotateKeyfile(r, projConfig.Storage, a.ProjectID, chain, instanceID, src)
+				if err != nil {
+					return err
+				}
+				if old.NodeId != "" && !dryRun {
+					log.Info("Node id of instance ", instanceID, ": ", old.NodeId, " -> ", keyfile.NodeId)
+				}
+				return nil
+			})
+			if dryRun {
+				util.PrintPlan()
+			}
+		},
+	}
+
+	a.KeyfileRotateCmd.ArgStore = make(map[string]interface{})
+
+	a.KeyfileRotateCmd.ArgStore["instance-id"] = a.KeyfileRotateCmd.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) whose keyfile to replace, comma separated")
+	a.KeyfileRotateCmd.ArgStore["selector"] = a.KeyfileRotateCmd.Cmd.Flags().StringToString("selector", map[string]string{}, "replace keyfile of all instances with matching labels, as key=value")
+	a.KeyfileRotateCmd.ArgStore["all"] = a.KeyfileRotateCmd.Cmd.Flags().Bool("all", false, "replace keyfile of all instances of project")
+	a.KeyfileRotateCmd.ArgStore["file"] = a.KeyfileRotateCmd.Cmd.Flags().String("file", "", "keyfile to import instead of generating a new one, only when replacing keyfile of a single instance")
+	a.KeyfileRotateCmd.ArgStore["dry-run"] = a.KeyfileRotateCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
+}
@@ -0,0 +1,778 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/marlinprotocol/ctl2/modules/keystore"
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/runner"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var privateKeyRegex = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{64}$`)
+
+func (a *app) keystorePreRunE(c *CommandDetails) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		additionalTest := c.AdditionalPreRunTest
+		err := a.setupDefaultConfigIfNotExists()
+		if err != nil {
+			return err
+		} else if err == nil && additionalTest != nil {
+			return additionalTest(cmd, args)
+		}
+		return nil
+	}
+}
+
+// Keystore import command
+func (a *app) setupKeystoreImportCommand() {
+	a.KeystoreImportCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreImportCmd.Use,
+		Short:   a.KeystoreImportCmd.DescShort,
+		Long:    a.KeystoreImportCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreImportCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			from := a.KeystoreImportCmd.getStringFromArgStoreOrDie("from")
+			makeDefault := a.KeystoreImportCmd.getBoolFromArgStoreOrDie("default")
+
+			// Run application
+			var key []byte
+			if util.FileExists(from) {
+				var err error
+				key, err = ioutil.ReadFile(from)
+				if err != nil {
+					log.Error("Error while reading ", from, ": ", err)
+					os.Exit(1)
+				}
+			} else if privateKeyRegex.MatchString(from) {
+				log.Warning("Private key given on command line may be left behind in shell history, prefer passing a file")
+				key = []byte(from)
+			} else {
+				log.Error("--from has to be a JSON keystore file, a file holding a hex encoded private key or a hex encoded private key")
+				os.Exit(1)
+			}
+
+			var passphrase, newPassphrase string
+			if json.Valid(key) {
+				passphrase = a.KeystoreImportCmd.readPassphraseOrDie("from-pass-path", "Enter passphrase of keystore being imported")
+				newPassphrase = passphrase
+				if a.KeystoreImportCmd.Cmd.Flags().Changed("pass-path") {
+					newPassphrase = a.KeystoreImportCmd.readPassphraseOrDie("pass-path", "")
+				}
+			} else {
+				newPassphrase = a.KeystoreImportCmd.readPassphraseOrDie("pass-path", "Enter passphrase to encrypt imported key with")
+			}
+
+			keystoreDir := a.getKeystoreDirOrDie(&a.KeystoreImportCmd)
+			acc, err := keystore.Import(keystoreDir, key, passphrase, newPassphrase)
+			if err != nil {
+				log.Error("Error while importing keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+			if makeDefault && !acc.Default {
+				if err := keystore.SelectAccount(keystoreDir, acc.Address); err != nil {
+					log.Error("Error while selecting account: ", err)
+					os.Exit(1)
+				}
+				log.Info("Account ", acc.Address, " is now used by default")
+			}
+		},
+	}
+
+	a.KeystoreImportCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreImportCmd.addKeystoreNameFlag()
+	a.KeystoreImportCmd.ArgStore["from"] = a.KeystoreImportCmd.Cmd.Flags().String("from", "", "JSON keystore file, or file holding hex encoded private key, to import")
+	a.KeystoreImportCmd.ArgStore["from-pass-path"] = a.KeystoreImportCmd.Cmd.Flags().String("from-pass-path", "", "path to the passphrase file of JSON keystore being imported")
+	a.KeystoreImportCmd.ArgStore["pass-path"] = a.KeystoreImportCmd.Cmd.Flags().StringP("pass-path", "p", "", "path to the passphrase file to store imported account with")
+	a.KeystoreImportCmd.ArgStore["default"] = a.KeystoreImportCmd.Cmd.Flags().Bool("default", false, "use imported account by default")
+	a.KeystoreImportCmd.Cmd.MarkFlagRequired("from")
+}
+
+// Keystore export command
+func (a *app) setupKeystoreExportCommand() {
+	a.KeystoreExportCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreExportCmd.Use,
+		Short:   a.KeystoreExportCmd.DescShort,
+		Long:    a.KeystoreExportCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreExportCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			address := a.KeystoreExportCmd.getStringFromArgStoreOrDie("address")
+			output := a.KeystoreExportCmd.getStringFromArgStoreOrDie("output")
+
+			// Run application
+			var newPassphrase string
+			if a.KeystoreExportCmd.Cmd.Flags().Changed("pass-path") {
+				newPassphrase = a.KeystoreExportCmd.readPassphraseOrDie("pass-path", "")
+			}
+			data, err := keystore.Export(a.getKeystoreDirOrDie(&a.KeystoreExportCmd), address, newPassphrase)
+			if err != nil {
+				log.Error("Error while exporting keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+			if output == "" {
+				fmt.Println(string(data))
+				return
+			}
+			if err := ioutil.WriteFile(output, data, 0600); err != nil {
+				log.Error("Error while writing ", output, ": ", err)
+				os.Exit(1)
+			}
+			log.Info("Exported keystore to ", output)
+		},
+	}
+
+	a.KeystoreExportCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreExportCmd.addKeystoreNameFlag()
+	a.KeystoreExportCmd.ArgStore["address"] = a.KeystoreExportCmd.Cmd.Flags().StringP("address", "a", "", "address of account to export, default account if not given")
+	a.KeystoreExportCmd.ArgStore["output"] = a.KeystoreExportCmd.Cmd.Flags().StringP("output", "o", "", "file to write encrypted JSON keystore to, stdout if not given")
+	a.KeystoreExportCmd.ArgStore["pass-path"] = a.KeystoreExportCmd.Cmd.Flags().StringP("pass-path", "p", "", "path to the passphrase file to encrypt exported keystore with, passphrase of account if not given")
+}
+
+// Keystore list command
+func (a *app) setupKeystoreListCommand() {
+	a.KeystoreListCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreListCmd.Use,
+		Short:   a.KeystoreListCmd.DescShort,
+		Long:    a.KeystoreListCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreListCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			name := a.KeystoreListCmd.getStringFromArgStoreOrDie("name")
+
+			// Run application
+			keystores := []string{name}
+			if name == "" {
+				shared, err := keystore.SharedNames()
+				if err != nil {
+					log.Warning("Cannot list shared keystores: ", err)
+				}
+				keystores = append(keystores, shared...)
+			}
+			t := util.GetTable()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Keystore", "Address", "Default", "Keystore Path"})
+			var found bool
+			for _, k := range keystores {
+				var keystoreDir string
+				var err error
+				if k == "" {
+					keystoreDir, err = keystore.Dir(a.ProjectID)
+				} else {
+					keystoreDir, err = keystore.SharedDir(k)
+				}
+				if err != nil {
+					log.Error("Error while locating keystore: ", err)
+					os.Exit(1)
+				}
+				for _, acc := range keystore.ListAccounts(keystoreDir) {
+					keystoreName := k
+					if keystoreName == "" {
+						keystoreName = "(" + a.ProjectID + ")"
+					}
+					t.AppendRow(table.Row{keystoreName, acc.Address, acc.Default, acc.Path})
+					found = true
+				}
+			}
+			if !found {
+				log.Info("No keystore found for project ", a.ProjectID)
+				return
+			}
+			t.Render()
+		},
+	}
+
+	a.KeystoreListCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreListCmd.addKeystoreNameFlag()
+}
+
+// Keystore show command
+func (a *app) setupKeystoreShowCommand() {
+	a.KeystoreShowCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreShowCmd.Use,
+		Short:   a.KeystoreShowCmd.DescShort,
+		Long:    a.KeystoreShowCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreShowCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			address := a.KeystoreShowCmd.getStringFromArgStoreOrDie("address")
+
+			// Run application
+			acc, err := keystore.FindAccount(a.getKeystoreDirOrDie(&a.KeystoreShowCmd), address)
+			if err != nil {
+				log.Error("Error while reading keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+			var usedBy []string
+			for _, instance := range getKeystoreUsersOrDie(acc.Path) {
+				usedBy = append(usedBy, instance.ProjectID+" "+instance.InstanceID)
+			}
+
+			t := util.GetTable()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Key", "Value"})
+			t.AppendRow(table.Row{"Address", acc.Address})
+			t.AppendRow(table.Row{"Default", acc.Default})
+			t.AppendRow(table.Row{"KeystorePath", acc.Path})
+			t.AppendRow(table.Row{"KeystorePassPath", acc.PassPath})
+			t.AppendRow(table.Row{"Instances", usedBy})
+			if record, ok := keystore.LastBackup(acc.Path); ok {
+				t.AppendRow(table.Row{"LastBackup", record.Time.Local().Format(time.RFC3339) + " " + record.Archive})
+			} else {
+				t.AppendRow(table.Row{"LastBackup", "never"})
+			}
+			t.Render()
+		},
+	}
+
+	a.KeystoreShowCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreShowCmd.addKeystoreNameFlag()
+	a.KeystoreShowCmd.ArgStore["address"] = a.KeystoreShowCmd.Cmd.Flags().StringP("address", "a", "", "address of account to show, default account if not given")
+}
+
+// Keystore select command
+func (a *app) setupKeystoreSelectCommand() {
+	a.KeystoreSelectCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreSelectCmd.Use,
+		Short:   a.KeystoreSelectCmd.DescShort,
+		Long:    a.KeystoreSelectCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreSelectCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			address := a.KeystoreSelectCmd.getStringFromArgStoreOrDie("address")
+
+			// Run application
+			err := keystore.SelectAccount(a.getKeystoreDirOrDie(&a.KeystoreSelectCmd), address)
+			if err != nil {
+				log.Error("Error while selecting account for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+			log.Info("Account ", address, " is now used by default, instances pick it up when created again")
+		},
+	}
+
+	a.KeystoreSelectCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreSelectCmd.addKeystoreNameFlag()
+	a.KeystoreSelectCmd.ArgStore["address"] = a.KeystoreSelectCmd.Cmd.Flags().StringP("address", "a", "", "address of account to use by default")
+	a.KeystoreSelectCmd.Cmd.MarkFlagRequired("address")
+}
+
+// getKeystoreDirOrDie returns directory of keystore named by --name of
+// command, or keystore of project if no name was given.
+func (a *app) getKeystoreDirOrDie(c *CommandDetails) string {
+	var keystoreDir string
+	var err error
+	if name := c.getStringFromArgStoreOrDie("name"); name != "" {
+		keystoreDir, err = keystore.SharedDir(name)
+	} else {
+		keystoreDir, err = keystore.Dir(a.ProjectID)
+	}
+	if err != nil {
+		log.Error("Error while locating keystore for project "+a.ProjectID+": ", err)
+		os.Exit(1)
+	}
+	return keystoreDir
+}
+
+func (c *CommandDetails) addKeystoreNameFlag() {
+	c.ArgStore["name"] = c.Cmd.Flags().String("name", "", "name of shared keystore usable by any project, keystore of project if not given")
+}
+
+// getKeystoreUsersOrDie returns instances of any project using keystore.
+func getKeystoreUsersOrDie(keystorePath string) []projects.Instance {
+	instances, err := projects.GetInstances()
+	if err != nil {
+		log.Error("Error while listing instances: ", err)
+		os.Exit(1)
+	}
+	var users []projects.Instance
+	for _, instance := range instances {
+		if instance.GetString("KeystorePath") == keystorePath {
+			users = append(users, instance)
+		}
+	}
+	return users
+}
+
+// readPassphraseOrDie reads passphrase from file given by flag, or prompts
+// for it if flag was not given.
+func (c *CommandDetails) readPassphraseOrDie(flag string, prompt string) string {
+	if c.Cmd.Flags().Changed(flag) {
+		passphrase, err := util.ReadStringFromFile(c.getStringFromArgStoreOrDie(flag))
+		if err != nil {
+			log.Error("Error while reading passphrase file", err)
+			os.Exit(1)
+		}
+		return passphrase
+	}
+	log.Info(prompt)
+	fmt.Printf("Passphrase:")
+	passphrase, err := util.ReadInputPasswordLine()
+	fmt.Println()
+	if err != nil {
+		log.Error("Error while reading passphrase", err)
+		os.Exit(1)
+	}
+	return passphrase
+}
+
+// Keystore migrate-secret command
+func (a *app) setupKeystoreMigrateCommand() {
+	a.KeystoreMigrateCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreMigrateCmd.Use,
+		Short:   a.KeystoreMigrateCmd.DescShort,
+		Long:    a.KeystoreMigrateCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreMigrateCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			address := a.KeystoreMigrateCmd.getStringFromArgStoreOrDie("address")
+			secret := keystore.Secret{
+				Backend: a.KeystoreMigrateCmd.getStringFromArgStoreOrDie("backend"),
+				Command: a.KeystoreMigrateCmd.getStringFromArgStoreOrDie("command"),
+				Env:     a.KeystoreMigrateCmd.getStringFromArgStoreOrDie("env"),
+			}
+
+			// Run application
+			acc, err := keystore.FindAccount(a.getKeystoreDirOrDie(&a.KeystoreMigrateCmd), address)
+			if err != nil {
+				log.Error("Error while reading keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+			oldPassPath := acc.PassPath
+			err = keystore.MigrateSecret(acc.Path, secret)
+			if err != nil {
+				log.Error("Error while migrating passphrase of ", acc.Address, ": ", err)
+				os.Exit(1)
+			}
+			newPassPath := keystore.PassPath(acc.Path)
+			log.Info("Passphrase of ", acc.Address, " is now kept in ", secret.Backend)
+
+			// Point instances using keystore at new passphrase location
+			var updated bool
+			for _, instance := range getKeystoreUsersOrDie(acc.Path) {
+				if instance.GetString("KeystorePassPath") != oldPassPath {
+					log.Warning("Instance ", instance.InstanceID, " of ", instance.ProjectID, " uses passphrase file ", instance.GetString("KeystorePassPath"), ", leaving it untouched")
+					continue
+				}
+				err = a.forProject(instance.ProjectID).repointKeystorePassPath(instance.Project, instance.InstanceID, acc.Path, newPassPath)
+				if err != nil {
+					log.Error("Error while updating instance ", instance.InstanceID, " of ", instance.ProjectID, ": ", err, ", plain passphrase file was kept")
+					os.Exit(1)
+				}
+				log.Info("Instance ", instance.InstanceID, " of ", instance.ProjectID, " now reads passphrase from ", newPassPath)
+				updated = true
+			}
+			if updated {
+				if err := util.SupervisorRereadUpdate(); err != nil {
+					log.Error(err)
+					os.Exit(1)
+				}
+			}
+
+			if secret.Backend == keystore.SecretBackendFile {
+				if oldPassPath != newPassPath {
+					err = util.RemoveFileIfExists(oldPassPath)
+				}
+			} else {
+				err = keystore.RemovePassphraseFile(acc.Path)
+				log.Info("Passphrase is written to ", newPassPath, " on tmpfs when instances are created, recreated or restarted; restart instances after a reboot")
+			}
+			if err != nil {
+				log.Error("Error while removing old passphrase file: ", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	a.KeystoreMigrateCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreMigrateCmd.addKeystoreNameFlag()
+	a.KeystoreMigrateCmd.ArgStore["address"] = a.KeystoreMigrateCmd.Cmd.Flags().StringP("address", "a", "", "address of account whose passphrase to migrate, default account if not given")
+	a.KeystoreMigrateCmd.ArgStore["backend"] = a.KeystoreMigrateCmd.Cmd.Flags().String("backend", keystore.SecretBackendFile, "backend to keep passphrase in, one of "+strings.Join(keystore.SecretBackends, ", "))
+	a.KeystoreMigrateCmd.ArgStore["command"] = a.KeystoreMigrateCmd.Cmd.Flags().String("command", "", "command printing passphrase, for command backend, e.g. \"pass show marlin/beacon\"")
+	a.KeystoreMigrateCmd.ArgStore["env"] = a.KeystoreMigrateCmd.Cmd.Flags().String("env", "", "environment variable holding passphrase, for env backend")
+}
+
+// repointKeystorePassPath makes instance read passphrase of keystore from
+// passPath, rewriting its resource and supervisor confs.
+func (a *app) repointKeystorePassPath(projConfig types.Project, instanceID string, keystorePath string, passPath string) error {
+	err := keystore.Unlock(keystorePath, passPath)
+	if err != nil {
+		return err
+	}
+	r, err := a.getResourceRunner(projConfig, instanceID)
+	if err != nil {
+		return err
+	}
+	return runner.SetKeystorePassPath(r, projConfig.Storage, a.ProjectID, instanceID, passPath)
+}
+
+// unlockInstanceKeystore makes passphrase of keystore used by instance
+// available to its programs.
+func (a *app) unlockInstanceKeystore(projConfig types.Project, instanceID string) error {
+	resData, err := a.getResourceData(projConfig, instanceID)
+	if err != nil {
+		return err
+	}
+	keystorePath, _ := resData["KeystorePath"].(string)
+	passPath, _ := resData["KeystorePassPath"].(string)
+	if keystorePath == "" || passPath == "" {
+		return nil
+	}
+	return a.unlockKeystore(keystorePath, passPath)
+}
+
+func (a *app) unlockKeystoreOrDie(keystorePath string, passPath string) {
+	if keystorePath == "" || passPath == "" {
+		return
+	}
+	err := a.unlockKeystore(keystorePath, passPath)
+	if err != nil {
+		log.Error("Error while unlocking keystore ", keystorePath, ": ", err)
+		os.Exit(1)
+	}
+}
+
+func (a *app) unlockKeystore(keystorePath string, passPath string) error {
+	err := a.checkKeystoreSharing(keystorePath)
+	if err != nil {
+		return err
+	}
+	err = keystore.Unlock(keystorePath, passPath)
+	if err != nil {
+		return err
+	}
+	return a.grantKeystore(keystorePath, passPath)
+}
+
+// checkKeystoreSharing refuses keystores used by instances of projects whose
+// programs run as a user other than programs of project, as keystores are
+// readable only by the user they are handed to.
+func (a *app) checkKeystoreSharing(keystorePath string) error {
+	instances, err := projects.GetInstances()
+	if err != nil {
+		return errors.New("Error while listing instances: " + err.Error())
+	}
+	usr, err := util.GetServiceUser(a.ProjectID)
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		if instance.ProjectID == a.ProjectID || instance.GetString("KeystorePath") != keystorePath {
+			continue
+		}
+		other, err := util.GetServiceUser(instance.ProjectID)
+		if err != nil {
+			return err
+		}
+		if other.Uid != usr.Uid {
+			return errors.New("Keystore is used by instance " + instance.InstanceID + " of " + instance.ProjectID + " whose programs run as " + other.Username +
+				" instead of " + usr.Username + ", projects sharing a keystore have to run as the same service user")
+		}
+	}
+	return nil
+}
+
+// grantKeystore hands keystore over to service user of project, if project
+// runs its programs as one.
+func (a *app) grantKeystore(keystorePath string, passPath string) error {
+	if !util.HasServiceUser(a.ProjectID) {
+		return nil
+	}
+	serviceUser, err := util.GetServiceUser(a.ProjectID)
+	if err != nil {
+		return err
+	}
+	return keystore.Grant(keystorePath, passPath, serviceUser)
+}
+
+// Keystore rotate-passphrase command
+func (a *app) setupKeystoreRotateCommand() {
+	a.KeystoreRotateCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreRotateCmd.Use,
+		Short:   a.KeystoreRotateCmd.DescShort,
+		Long:    a.KeystoreRotateCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreRotateCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			address := a.KeystoreRotateCmd.getStringFromArgStoreOrDie("address")
+
+			// Run application
+			newPassphrase := a.KeystoreRotateCmd.readPassphraseOrDie("pass-path", "Enter new passphrase of keystore")
+			acc, err := keystore.RotatePassphrase(a.getKeystoreDirOrDie(&a.KeystoreRotateCmd), address, newPassphrase)
+			if err != nil {
+				log.Error("Error while rotating passphrase of keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+
+			// Restart instances using keystore so that they pick up new passphrase
+			instanceIDs := make(map[string][]string)
+			projectConfigs := make(map[string]types.Project)
+			var projectIDs []string
+			for _, instance := range getKeystoreUsersOrDie(acc.Path) {
+				if _, ok := instanceIDs[instance.ProjectID]; !ok {
+					projectIDs = append(projectIDs, instance.ProjectID)
+				}
+				instanceIDs[instance.ProjectID] = append(instanceIDs[instance.ProjectID], instance.InstanceID)
+				projectConfigs[instance.ProjectID] = instance.Project
+			}
+			for _, projectID := range projectIDs {
+				p, projConfig := a.forProject(projectID), projectConfigs[projectID]
+				p.runLifecycleOrDie(&a.KeystoreRotateCmd, "restart", projConfig, instanceIDs[projectID], func(instanceID string) error {
+					runner, err := p.getResourceRunner(projConfig, instanceID)
+					if err != nil {
+						return err
+					}
+					err = p.unlockInstanceKeystore(projConfig, instanceID)
+					if err != nil {
+						return err
+					}
+					return runner.Restart()
+				})
+			}
+		},
+	}
+
+	a.KeystoreRotateCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreRotateCmd.addKeystoreNameFlag()
+	a.KeystoreRotateCmd.ArgStore["address"] = a.KeystoreRotateCmd.Cmd.Flags().StringP("address", "a", "", "address of account whose passphrase to rotate, default account if not given")
+	a.KeystoreRotateCmd.ArgStore["pass-path"] = a.KeystoreRotateCmd.Cmd.Flags().StringP("pass-path", "p", "", "path to the file holding new passphrase")
+	a.KeystoreRotateCmd.addLifecycleFlags("restart")
+}
+
+// Keystore backup command
+func (a *app) setupKeystoreBackupCommand() {
+	a.KeystoreBackupCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreBackupCmd.Use,
+		Short:   a.KeystoreBackupCmd.DescShort,
+		Long:    a.KeystoreBackupCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreBackupCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			address := a.KeystoreBackupCmd.getStringFromArgStoreOrDie("address")
+			output := a.KeystoreBackupCmd.getStringFromArgStoreOrDie("output")
+
+			// Run application
+			passphrase := a.KeystoreBackupCmd.readPassphraseOrDie("pass-path", "Enter passphrase to encrypt backup with")
+			list, err := keystore.Backup(a.getKeystoreDirOrDie(&a.KeystoreBackupCmd), address, output, passphrase)
+			if err != nil {
+				log.Error("Error while backing up keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+			for _, acc := range list {
+				log.Info("Backed up account ", acc.Address, " to ", output)
+			}
+			log.Warning("Backup holds passphrases of accounts, keep it and its passphrase apart and safe")
+		},
+	}
+
+	a.KeystoreBackupCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreBackupCmd.addKeystoreNameFlag()
+	a.KeystoreBackupCmd.ArgStore["address"] = a.KeystoreBackupCmd.Cmd.Flags().StringP("address", "a", "", "address of account to back up, all accounts if not given")
+	a.KeystoreBackupCmd.ArgStore["output"] = a.KeystoreBackupCmd.Cmd.Flags().StringP("output", "o", "", "file to write encrypted backup to")
+	a.KeystoreBackupCmd.ArgStore["pass-path"] = a.KeystoreBackupCmd.Cmd.Flags().StringP("pass-path", "p", "", "path to the passphrase file to encrypt backup with")
+	a.KeystoreBackupCmd.Cmd.MarkFlagRequired("output")
+}
+
+// Keystore restore command
+func (a *app) setupKeystoreRestoreCommand() {
+	a.KeystoreRestoreCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreRestoreCmd.Use,
+		Short:   a.KeystoreRestoreCmd.DescShort,
+		Long:    a.KeystoreRestoreCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreRestoreCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			from := a.KeystoreRestoreCmd.getStringFromArgStoreOrDie("from")
+
+			// Run application
+			data, err := ioutil.ReadFile(from)
+			if err != nil {
+				log.Error("Error while reading ", from, ": ", err)
+				os.Exit(1)
+			}
+			passphrase := a.KeystoreRestoreCmd.readPassphraseOrDie("pass-path", "Enter passphrase backup was encrypted with")
+			list, err := keystore.Restore(a.getKeystoreDirOrDie(&a.KeystoreRestoreCmd), data, passphrase)
+			for _, acc := range list {
+				log.Info("Restored account ", acc.Address)
+			}
+			if err != nil {
+				log.Error("Error while restoring keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+			if len(list) == 0 {
+				log.Info("Nothing to restore, all accounts in backup are already in keystore")
+			}
+		},
+	}
+
+	a.KeystoreRestoreCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreRestoreCmd.addKeystoreNameFlag()
+	a.KeystoreRestoreCmd.ArgStore["from"] = a.KeystoreRestoreCmd.Cmd.Flags().String("from", "", "backup file to restore accounts from")
+	a.KeystoreRestoreCmd.ArgStore["pass-path"] = a.KeystoreRestoreCmd.Cmd.Flags().StringP("pass-path", "p", "", "path to the passphrase file backup was encrypted with")
+	a.KeystoreRestoreCmd.Cmd.MarkFlagRequired("from")
+}
+
+// useSharedKeystoreOrDie points instance being created at default account of
+// shared keystore given using --keystore.
+func (a *app) useSharedKeystoreOrDie(runtimeArgs map[string]string) {
+	if _, ok := a.CreateCmd.ArgStore["keystore"]; !ok || !a.CreateCmd.Cmd.Flags().Changed("keystore") {
+		return
+	}
+	if a.CreateCmd.Cmd.Flags().Changed("keystore-path") || a.CreateCmd.Cmd.Flags().Changed("keystore-pass-path") {
+		log.Error("--keystore cannot be used together with --keystore-path or --keystore-pass-path")
+		os.Exit(1)
+	}
+	name := a.CreateCmd.getStringFromArgStoreOrDie("keystore")
+	keystorePath, passPath, err := keystore.GetSharedKeystoreDetails(name)
+	if err != nil {
+		log.Error("Error while reading shared keystore: ", err)
+		os.Exit(1)
+	}
+	runtimeArgs["KeystorePath"] = keystorePath
+	runtimeArgs["KeystorePassPath"] = passPath
+	log.Info("Using account of shared keystore ", name, " at ", keystorePath)
+}
+
+// Keystore sign command
+func (a *app) setupKeystoreSignCommand() {
+	a.KeystoreSignCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreSignCmd.Use,
+		Short:   a.KeystoreSignCmd.DescShort,
+		Long:    a.KeystoreSignCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreSignCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			address := a.KeystoreSignCmd.getStringFromArgStoreOrDie("address")
+
+			// Run application
+			message := a.KeystoreSignCmd.readMessageOrDie()
+			acc, signature, err := keystore.Sign(a.getKeystoreDirOrDie(&a.KeystoreSignCmd), address, message)
+			if err != nil {
+				log.Error("Error while signing with keystore for project "+a.ProjectID+": ", err)
+				os.Exit(1)
+			}
+			log.Info("Signed by ", acc.Address)
+			fmt.Println(hexutil.Encode(signature))
+		},
+	}
+
+	a.KeystoreSignCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreSignCmd.addKeystoreNameFlag()
+	a.KeystoreSignCmd.ArgStore["address"] = a.KeystoreSignCmd.Cmd.Flags().StringP("address", "a", "", "address of account to sign with, default account if not given")
+	a.KeystoreSignCmd.addMessageFlags("sign")
+}
+
+// Keystore verify command
+func (a *app) setupKeystoreVerifyCommand() {
+	a.KeystoreVerifyCmd.Cmd = &cobra.Command{
+		Use:     a.KeystoreVerifyCmd.Use,
+		Short:   a.KeystoreVerifyCmd.DescShort,
+		Long:    a.KeystoreVerifyCmd.DescLong,
+		PreRunE: a.keystorePreRunE(&a.KeystoreVerifyCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			address := a.KeystoreVerifyCmd.getStringFromArgStoreOrDie("address")
+			signatureHex := a.KeystoreVerifyCmd.getStringFromArgStoreOrDie("signature")
+
+			// Run application
+			message := a.KeystoreVerifyCmd.readMessageOrDie()
+			signature, err := hexutil.Decode(signatureHex)
+			if err != nil {
+				log.Error("Signature has to be 0x prefixed hex: ", err)
+				os.Exit(1)
+			}
+			signer, err := keystore.Recover(message, signature)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			if address == "" {
+				acc, err := keystore.FindAccount(a.getKeystoreDirOrDie(&a.KeystoreVerifyCmd), "")
+				if err != nil {
+					log.Error("Error while reading keystore for project "+a.ProjectID+": ", err, ", give expected signer using --address")
+					os.Exit(1)
+				}
+				address = acc.Address
+			} else if !common.IsHexAddress(address) {
+				log.Error("Invalid address: ", address)
+				os.Exit(1)
+			}
+			if signer != common.HexToAddress(address).Hex() {
+				log.Error("Signature is not valid for ", common.HexToAddress(address).Hex(), ", message was signed by ", signer)
+				os.Exit(1)
+			}
+			log.Info("Signature is valid, message was signed by ", signer)
+		},
+	}
+
+	a.KeystoreVerifyCmd.ArgStore = make(map[string]interface{})
+	a.KeystoreVerifyCmd.addKeystoreNameFlag()
+	a.KeystoreVerifyCmd.ArgStore["address"] = a.KeystoreVerifyCmd.Cmd.Flags().StringP("address", "a", "", "address expected to have signed message, default account of keystore if not given")
+	a.KeystoreVerifyCmd.ArgStore["signature"] = a.KeystoreVerifyCmd.Cmd.Flags().String("signature", "", "0x prefixed hex encoded signature to verify")
+	a.KeystoreVerifyCmd.addMessageFlags("verify")
+	a.KeystoreVerifyCmd.Cmd.MarkFlagRequired("signature")
+}
+
+func (c *CommandDetails) addMessageFlags(verb string) {
+	c.ArgStore["message"] = c.Cmd.Flags().String("message", "", "message to "+verb)
+	c.ArgStore["file"] = c.Cmd.Flags().String("file", "", "file holding message to "+verb+", read as is")
+}
+
+// readMessageOrDie returns message given using either --message or --file.
+func (c *CommandDetails) readMessageOrDie() []byte {
+	if c.Cmd.Flags().Changed("message") == c.Cmd.Flags().Changed("file") {
+		log.Error("Message has to be given using exactly one of --message and --file")
+		os.Exit(1)
+	}
+	if c.Cmd.Flags().Changed("message") {
+		return []byte(c.getStringFromArgStoreOrDie("message"))
+	}
+	file := c.getStringFromArgStoreOrDie("file")
+	message, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Error("Error while reading ", file, ": ", err)
+		os.Exit(1)
+	}
+	return message
+}
@@ -0,0 +1,50 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"os"
+	"strings"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// validateLimitsOrDie validates resource limits and working directories given
+// as runtime arguments before anything is downloaded or started, runners
+// normalize them while creating resources.
+func (a *app) validateLimitsOrDie(runtimeArgs map[string]string) {
+	values := make(map[string]string)
+	for k, v := range runtimeArgs {
+		if util.IsLimitField(k) || strings.HasSuffix(k, "RunDir") {
+			values[k] = v
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	serviceUser, err := util.GetServiceUser(a.ProjectID)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	_, err = util.ValidateLimits(values, serviceUser)
+	if err != nil {
+		log.Error("Invalid runtime arguments: ", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/types"
+)
+
+func (c *CommandDetails) addLogPolicyFlags(scope string) {
+	c.ArgStore["log-dir"] = c.Cmd.Flags().String("log-dir", "", "directory to write logs of "+scope+" to (default "+util.DefaultLogDir+")")
+	c.ArgStore["log-max-bytes"] = c.Cmd.Flags().String("log-max-bytes", "", "size at which logs of "+scope+" are rotated, such as 50MB (default "+util.DefaultLogMaxBytes+")")
+	c.ArgStore["log-backups"] = c.Cmd.Flags().String("log-backups", "", "number of rotated logs of "+scope+" to keep (default "+util.DefaultLogBackups+")")
+	c.ArgStore["log-compress"] = c.Cmd.Flags().String("log-compress", "", "compress rotated logs of "+scope+" using logrotate, true or false (default false)")
+}
+
+func (c *CommandDetails) getLogPolicyFromArgStoreOrDie() types.LogPolicy {
+	return types.LogPolicy{
+		Dir:      util.ExpandTilde(c.getStringFromArgStoreOrDie("log-dir")),
+		MaxBytes: c.getStringFromArgStoreOrDie("log-max-bytes"),
+		Backups:  c.getStringFromArgStoreOrDie("log-backups"),
+		Compress: c.getStringFromArgStoreOrDie("log-compress"),
+	}
+}
+
+// mergeLogPolicy overrides fields of base with fields set in override.
+func mergeLogPolicy(base types.LogPolicy, override types.LogPolicy) types.LogPolicy {
+	if override.Dir != "" {
+		base.Dir = override.Dir
+	}
+	if override.MaxBytes != "" {
+		base.MaxBytes = override.MaxBytes
+	}
+	if override.Backups != "" {
+		base.Backups = override.Backups
+	}
+	if override.Compress != "" {
+		base.Compress = override.Compress
+	}
+	return base
+}
+
+func validateLogPolicy(policy types.LogPolicy) error {
+	resolved := mergeLogPolicy(types.LogPolicy{
+		Dir:      util.DefaultLogDir,
+		MaxBytes: util.DefaultLogMaxBytes,
+		Backups:  util.DefaultLogBackups,
+		Compress: "false",
+	}, policy)
+	return util.ValidateLogConfig(resolved.Dir, resolved.MaxBytes, resolved.Backups, resolved.Compress)
+}
+
+// addLogPolicyRuntimeArgs adds fields set in policy to runtime arguments,
+// leaving alone those given as runtime arguments explicitly.
+func addLogPolicyRuntimeArgs(policy types.LogPolicy, runtimeArgs map[string]string) {
+	for k, v := range map[string]string{
+		"LogDir":      policy.Dir,
+		"LogMaxBytes": policy.MaxBytes,
+		"LogBackups":  policy.Backups,
+		"LogCompress": policy.Compress,
+	} {
+		if _, ok := runtimeArgs[k]; !ok && v != "" {
+			runtimeArgs[k] = v
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appcommands
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/marlinprotocol/ctl2/modules/registry"
+	"github.com/marlinprotocol/ctl2/modules/runner/gateway_polygonbor"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// SetupMevProxyCommands sets up commands managing MEV proxy run alongside
+// gateway (bor) instances, leaving gateway running.
+func (a *app) SetupMevProxyCommands(_statusCmd CommandDetails, _restartCmd CommandDetails, _reconfigureCmd CommandDetails, _logsCmd CommandDetails) {
+	a.shallowCopyDescriptions(&a.MevProxyStatusCmd, _statusCmd)
+	a.setupMevProxyStatusCommand()
+
+	a.shallowCopyDescriptions(&a.MevProxyRestartCmd, _restartCmd)
+	a.setupMevProxyRestartCommand()
+
+	a.shallowCopyDescriptions(&a.MevProxyReconfigureCmd, _reconfigureCmd)
+	a.setupMevProxyReconfigureCommand()
+
+	a.shallowCopyDescriptions(&a.MevProxyLogsCmd, _logsCmd)
+	a.setupLogsCommandFor(&a.MevProxyLogsCmd, "mevproxy")
+}
+
+func (a *app) mevProxyPreRunE(c *CommandDetails) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		additionalTest := c.AdditionalPreRunTest
+		err := a.setupDefaultConfigIfNotExists()
+		if err != nil {
+			return err
+		} else if err == nil && additionalTest != nil {
+			return additionalTest(cmd, args)
+		}
+		return nil
+	}
+}
+
+func (c *CommandDetails) addMevProxyTargetFlags(verb string) {
+	c.ArgStore["instance-id"] = c.Cmd.Flags().StringP("instance-id", "i", "001", "instance-id(s) of gateway whose MEV proxy to "+verb+", comma separated")
+	c.ArgStore["selector"] = c.Cmd.Flags().StringToString("selector", map[string]string{}, verb+" MEV proxy of all gateways with matching labels, as key=value")
+	c.ArgStore["all"] = c.Cmd.Flags().Bool("all", false, verb+" MEV proxy of all gateways of project")
+}
+
+// MEV proxy status command
+func (a *app) setupMevProxyStatusCommand() {
+	a.MevProxyStatusCmd.Cmd = &cobra.Command{
+		Use:     a.MevProxyStatusCmd.Use,
+		Short:   a.MevProxyStatusCmd.DescShort,
+		Long:    a.MevProxyStatusCmd.DescLong,
+		PreRunE: a.mevProxyPreRunE(&a.MevProxyStatusCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.MevProxyStatusCmd, projConfig)
+			t := util.GetTable()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Instance", "Program", "State", "Uptime", "Listen Address", "Bundle Address", "Chain ID"})
+			failed := false
+			for _, instanceID := range instanceIDs {
+				proxy, err := gateway_polygonbor.GetMevProxy(projConfig.Storage, instanceID)
+				if err != nil {
+					log.Error("Instance ", instanceID, ": ", err)
+					failed = true
+					continue
+				}
+				if !proxy.Enabled() {
+					t.AppendRow(table.Row{proxy.InstanceId, "-", "DISABLED", "-", "-", "-", "-"})
+					continue
+				}
+				state, uptime := "UNKNOWN", "-"
+				infos, err := util.SupervisorProgramInfos([]string{proxy.Program})
+				if err != nil {
+					log.Warning(err)
+				} else if info, ok := infos[proxy.Program]; ok {
+					state = info.State
+					if info.Pid != 0 {
+						uptime = info.Uptime.String()
+					}
+				}
+				chainID := "unreachable"
+				if id, err := gateway_polygonbor.CheckBundleAddr(proxy.BundleAddr); err != nil {
+					log.Warning("Instance ", proxy.InstanceId, ": ", err)
+				} else {
+					chainID = strconv.FormatUint(id, 10)
+				}
+				t.AppendRow(table.Row{proxy.InstanceId, proxy.Program, state, uptime, proxy.ListenAddr, proxy.BundleAddr, chainID})
+			}
+			t.Render()
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	a.MevProxyStatusCmd.ArgStore = make(map[string]interface{})
+
+	a.MevProxyStatusCmd.addMevProxyTargetFlags("show status of")
+}
+
+// MEV proxy restart command
+func (a *app) setupMevProxyRestartCommand() {
+	a.MevProxyRestartCmd.Cmd = &cobra.Command{
+		Use:     a.MevProxyRestartCmd.Use,
+		Short:   a.MevProxyRestartCmd.DescShort,
+		Long:    a.MevProxyRestartCmd.DescLong,
+		PreRunE: a.mevProxyPreRunE(&a.MevProxyRestartCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			parallel := a.MevProxyRestartCmd.getIntFromArgStoreOrDie("parallel")
+
+			// Run application
+			projConfig := a.getProjectConfigOrDie()
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.MevProxyRestartCmd, projConfig)
+			a.runOnInstancesOrDie("mevproxy restart", instanceIDs, parallel, func(instanceID string) error {
+				proxy, err := gateway_polygonbor.GetMevProxy(projConfig.Storage, instanceID)
+				if err != nil {
+					return err
+				}
+				return proxy.Restart()
+			})
+		},
+	}
+
+	a.MevProxyRestartCmd.ArgStore = make(map[string]interface{})
+
+	a.MevProxyRestartCmd.addMevProxyTargetFlags("restart")
+	a.MevProxyRestartCmd.ArgStore["parallel"] = a.MevProxyRestartCmd.Cmd.Flags().Int("parallel", 4, "maximum number of MEV proxies to restart at once")
+}
+
+// MEV proxy reconfigure command
+func (a *app) setupMevProxyReconfigureCommand() {
+	a.MevProxyReconfigureCmd.Cmd = &cobra.Command{
+		Use:     a.MevProxyReconfigureCmd.Use,
+		Short:   a.MevProxyReconfigureCmd.DescShort,
+		Long:    a.MevProxyReconfigureCmd.DescLong,
+		PreRunE: a.mevProxyPreRunE(&a.MevProxyReconfigureCmd),
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Extract runtime variables
+			enable := a.MevProxyReconfigureCmd.getBoolFromArgStoreOrDie("enable")
+			disable := a.MevProxyReconfigureCmd.getBoolFromArgStoreOrDie("disable")
+			skipChecksum := a.MevProxyReconfigureCmd.getBoolFromArgStoreOrDie("skip-checksum")
+			dryRun := a.MevProxyReconfigureCmd.getBoolFromArgStoreOrDie("dry-run")
+			changes := make(map[string]string)
+			for flag, field := range map[string]string{"listen-addr": "MevProxyListenAddr", "bundle-addr": "MevProxyBundleAddr", "subgraph-path": "SubgraphPath"} {
+				if cmd.Flags().Changed(flag) {
+					changes[field] = a.MevProxyReconfigureCmd.getStringFromArgStoreOrDie(flag)
+				}
+			}
+
+			// Run application
+			if enable && disable {
+				log.Error("--enable and --disable cannot be given together")
+				os.Exit(1)
+			}
+			if len(changes) == 0 && !enable && !disable {
+				log.Error("Nothing to reconfigure")
+				os.Exit(1)
+			}
+			projConfig := a.getProjectConfigOrDie()
+			if dryRun {
+				util.EnableDryRun()
+			}
+			instanceIDs := a.getTargetInstanceIDsOrDie(&a.MevProxyReconfigureCmd, projConfig)
+			a.runOnInstancesOrDie("mevproxy reconfigure", instanceIDs, 1, func(instanceID string) error {
+				proxy, err := gateway_polygonbor.GetMevProxy(projConfig.Storage, instanceID)
+				if err != nil {
+					return err
+				}
+				enabled := (proxy.Enabled() || enable) && !disable
+				if !enabled && len(changes) != 0 {
+					log.Warning("MEV proxy of instance ", instanceID, " is disabled, changes take effect once it is enabled")
+				}
+				var runnerData interface{}
+				if enabled && !proxy.Enabled() {
+					_, version, err := a.getResourceMetadata(projConfig, instanceID)
+					if err != nil {
+						return err
+					}
+					projectVersion, err := registry.GlobalRegistry.GetVersionToRun(a.ProjectID, "", version)
+					if err != nil {
+						return errors.New("Error while fetching version " + version + " from registry: " + err.Error())
+					}
+					runnerData = projectVersion.RunnerData
+				}
+				return proxy.Reconfigure(changes, enabled, runnerData, skipChecksum)
+			})
+			if dryRun {
+				util.PrintPlan()
+			}
+		},
+	}
+
+	a.MevProxyReconfigureCmd.ArgStore = make(map[string]interface{})
+
+	a.MevProxyReconfigureCmd.addMevProxyTargetFlags("reconfigure")
+	a.MevProxyReconfigureCmd.ArgStore["listen-addr"] = a.MevProxyReconfigureCmd.Cmd.Flags().StringP("listen-addr", "m", "", "endpoint to recieve MEV bundles on")
+	a.MevProxyReconfigureCmd.ArgStore["bundle-addr"] = a.MevProxyReconfigureCmd.Cmd.Flags().StringP("bundle-addr", "j", "", "polygon bor JSON RPC endpoint")
+	a.MevProxyReconfigureCmd.ArgStore["subgraph-path"] = a.MevProxyReconfigureCmd.Cmd.Flags().StringP("subgraph-path", "g", "", "subgraph url")
+	a.MevProxyReconfigureCmd.ArgStore["enable"] = a.MevProxyReconfigureCmd.Cmd.Flags().Bool("enable", false, "run MEV proxy if it was disabled, downloading it if needed")
+	a.MevProxyReconfigureCmd.ArgStore["disable"] = a.MevProxyReconfigureCmd.Cmd.Flags().Bool("disable", false, "stop and remove MEV proxy, leaving gateway running")
+	a.MevProxyReconfigureCmd.ArgStore["skip-checksum"] = a.MevProxyReconfigureCmd.Cmd.Flags().BoolP("skip-checksum", "s", false, "skip checksum verification of MEV proxy downloaded when enabling it")
+	a.MevProxyReconfigureCmd.ArgStore["dry-run"] = a.MevProxyReconfigureCmd.Cmd.Flags().Bool("dry-run", false, "show actions to be taken without making any changes")
+}
@@ -2,7 +2,10 @@
 
 package appcommands
 
-import "github.com/marlinprotocol/ctl2/modules/util"
+import (
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
 
 // ----------------- RELAY ETH -------------------------------------
 
@@ -21,9 +24,20 @@ func (a *app) relayEthCreateSubstitutions(runnerID string) {
 		runtimeArgs["Address"] = a.CreateCmd.getStringFromArgStoreOrDie("address")
 		runtimeArgs["Name"] = a.CreateCmd.getStringFromArgStoreOrDie("name")
 		runtimeArgs["SyncMode"] = a.CreateCmd.getStringFromArgStoreOrDie("sync-mode")
+		runtimeArgs["GethPprofAddr"] = a.CreateCmd.getStringFromArgStoreOrDie("geth-pprof-addr")
+		runtimeArgs["GethPort"] = a.CreateCmd.getStringFromArgStoreOrDie("geth-port")
+		runtimeArgs["GethPprofPort"] = a.CreateCmd.getStringFromArgStoreOrDie("geth-pprof-port")
 
 		a.CreateCmd.ArgStore["runtime-args"] = runtimeArgs
 	}
+
+	if runnerID == "linux-amd64.supervisor.runner03" {
+		for _, flag := range []string{"sync-mode", "geth-pprof-addr", "geth-port", "geth-pprof-port"} {
+			if a.CreateCmd.Cmd.Flags().Changed(flag) {
+				log.Warning("--", flag, " is ignored, ", runnerID, " does not manage geth")
+			}
+		}
+	}
 }
 
 // --------------------- BEACON ------------------------------------
@@ -87,6 +101,9 @@ func (a *app) gatewayPolygonBorCreateSubstitutions(runnerID string) {
 		runtimeArgs["MevProxyListenAddr"] = a.CreateCmd.getStringFromArgStoreOrDie("mevproxy-listen-addr")
 		runtimeArgs["MevProxyBundleAddr"] = a.CreateCmd.getStringFromArgStoreOrDie("mevproxy-bundle-addr")
 		runtimeArgs["SubgraphPath"] = a.CreateCmd.getStringFromArgStoreOrDie("subgraph-path")
+		if a.CreateCmd.getBoolFromArgStoreOrDie("disable-mevproxy") {
+			runtimeArgs["MevProxyProgram"] = ""
+		}
 		a.CreateCmd.ArgStore["runtime-args"] = runtimeArgs
 	}
 }
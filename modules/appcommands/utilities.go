@@ -21,6 +21,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/marlinprotocol/ctl2/modules/keystore"
 	"github.com/marlinprotocol/ctl2/modules/registry"
@@ -115,7 +116,7 @@ func (a *app) getVersionToRunOrDie(updatePolicy string, version string) registry
 }
 
 func (a *app) getResourceMetadata(projectConfig types.Project, instanceId string) (string, string, error) {
-	resFileLocation := projectConfig.Storage + "/common/project_" + a.ProjectID + "_instance" + instanceId + ".resource"
+	resFileLocation := a.getResourceFileLocation(projectConfig, instanceId)
 	if _, err := os.Stat(resFileLocation); os.IsNotExist(err) {
 		return "", "", errors.New("Cannot locate resource: " + resFileLocation)
 	}
@@ -169,51 +170,30 @@ func (a *app) doPrepareOrDie(r runner.Runner) {
 	}
 }
 
-func (a *app) doCreateOrDie(r runner.Runner, runtimeArgs map[string]string) {
+func (a *app) doCreateOrDie(r runner.Runner, runtimeArgs map[string]string, secretEnvFile string) {
 	err := r.Create(runtimeArgs)
 	if err != nil {
+		if secretEnvFile != "" {
+			util.RemoveFileIfExists(secretEnvFile)
+		}
 		log.Error("Error while creating application for project "+a.ProjectID+": ", err)
 		os.Exit(1)
 	}
 }
 
-func (a *app) doDestroyOrDie(r runner.Runner) {
+// removeCreatedInstance destroys an instance which was just created,
+// leaving keyfiles it may have generated for a later attempt.
+func (a *app) removeCreatedInstance(r runner.Runner, instanceID string, secretEnvFile string) {
+	log.Info("Removing instance ", instanceID, " of project ", a.ProjectID)
 	err := r.Destroy()
-	if err != nil {
-		log.Error("Error while destroying for project "+a.ProjectID+": ", err)
-		os.Exit(1)
-	}
-}
-
-func (a *app) doStatusOrDie(r runner.Runner) {
-	err := r.Status()
-	if err != nil {
-		log.Error("Error while fetching status for project "+a.ProjectID+": ", err)
-		os.Exit(1)
+	if err == nil {
+		err = r.PostRun()
 	}
-}
-
-func (a *app) doRecreateOrDie(r runner.Runner) {
-	err := r.Recreate()
-	if err != nil {
-		log.Error("Error while recreating for project "+a.ProjectID+": ", err)
-		os.Exit(1)
-	}
-}
-
-func (a *app) doRestartOrDie(r runner.Runner) {
-	err := r.Restart()
-	if err != nil {
-		log.Error("Error while restarting for project "+a.ProjectID+": ", err)
-		os.Exit(1)
+	if err == nil && secretEnvFile != "" {
+		err = util.RemoveFileIfExists(secretEnvFile)
 	}
-}
-
-func (a *app) doPostRunOrDie(r runner.Runner) {
-	err := r.PostRun()
 	if err != nil {
-		log.Error("Error while running post run for project "+a.ProjectID+": ", err)
-		os.Exit(1)
+		log.Error("Error while removing instance ", instanceID, ", inspect manually: ", err)
 	}
 }
 
@@ -286,6 +266,16 @@ func (c *CommandDetails) getBoolFromArgStoreOrDie(key string) bool {
 	return false
 }
 
+func (c *CommandDetails) getDurationFromArgStoreOrDie(key string) time.Duration {
+	if v, ok := c.ArgStore[key]; ok {
+		return *(v.(*time.Duration))
+	} else {
+		log.Error("Cannot find key " + key + " in argstore. Aborting")
+		os.Exit(1)
+	}
+	return 0
+}
+
 func (c *CommandDetails) getStringToStringFromArgStoreOrDie(key string) map[string]string {
 	if v, ok := c.ArgStore[key]; ok {
 		return *(v.(*map[string]string))
@@ -0,0 +1,479 @@
+package doctor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marlinprotocol/ctl2/modules/keystore"
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/registry"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/types"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultSupervisorSocket = "/run/supervisor.sock"
+	registryStaleAfter      = 24 * time.Hour
+)
+
+// supervisordConfs are locations supervisord reads its configuration from,
+// in order it looks for them.
+var supervisordConfs = []string{"/etc/supervisor/supervisord.conf", "/etc/supervisord.conf"}
+
+type Status string
+
+const (
+	StatusOK   Status = "OK"
+	StatusWarn Status = "WARN"
+	StatusFail Status = "FAIL"
+)
+
+// Result is outcome of a single check, along with what can be done about it
+// when check did not pass.
+type Result struct {
+	Check  string
+	Status Status
+	Detail string
+	Fix    string
+}
+
+// keystoreProjects are projects which sign messages using a keystore.
+var keystoreProjects = map[string]bool{
+	"beacon":             true,
+	"gateway_cosmos":     true,
+	"gateway_dot":        true,
+	"gateway_iris":       true,
+	"gateway_near":       true,
+	"gateway_polygonbor": true,
+}
+
+// Run runs all checks of environment marlinctl runs resources in.
+func Run() []Result {
+	var results []Result
+	results = append(results, checkRuntimes()...)
+	results = append(results, checkSupervisorSocket())
+	results = append(results, checkSupervisorConfDir())
+	results = append(results, checkRegistry()...)
+
+	instances, err := projects.GetInstances()
+	if err != nil {
+		return append(results, Result{"resources", StatusFail, err.Error(), "Inspect or remove the resource file named in error"})
+	}
+	results = append(results, checkChecksums(instances)...)
+	results = append(results, checkKeystores(instances)...)
+	results = append(results, checkServiceUsers(instances)...)
+	results = append(results, checkSupervisorConfs(instances)...)
+	return results
+}
+
+// HasFailures tells if any of results failed.
+func HasFailures(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRuntimes() []Result {
+	usedRuntimes := make(map[string]bool)
+	for _, projectID := range projects.GetProjectIDs() {
+		if projectConfig, err := projects.GetProjectConfig(projectID); err == nil {
+			usedRuntimes[projectConfig.Runtime] = true
+		}
+	}
+
+	var runtimes []string
+	available := util.GetRuntimes()
+	for r := range available {
+		runtimes = append(runtimes, r)
+	}
+	sort.Strings(runtimes)
+
+	var results []Result
+	for _, r := range runtimes {
+		result := Result{Check: "runtime " + r, Status: StatusOK, Detail: "available"}
+		if !available[r] {
+			result.Status = StatusWarn
+			result.Detail = "not available"
+			if usedRuntimes[r] {
+				result.Status = StatusFail
+				result.Detail = "not available, but configured for projects"
+			}
+			switch {
+			case strings.HasSuffix(r, ".supervisor"):
+				result.Fix = "Install supervisor, for example: sudo apt install supervisor"
+			case strings.HasSuffix(r, ".systemd"):
+				result.Fix = "Run marlinctl on a host booted with systemd"
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// getSupervisorSocket returns socket supervisord listens on as set by file=
+// under [unix_http_server] in its configuration.
+func getSupervisorSocket() string {
+	for _, location := range supervisordConfs {
+		data, err := ioutil.ReadFile(location)
+		if err != nil {
+			continue
+		}
+		section := ""
+		for _, line := range strings.Split(string(data), "\n") {
+			if i := strings.Index(line, ";"); i != -1 {
+				line = line[:i]
+			}
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+				section = strings.TrimSpace(line[1 : len(line)-1])
+				continue
+			}
+			kv := strings.SplitN(line, "=", 2)
+			if section == "unix_http_server" && len(kv) == 2 && strings.TrimSpace(kv[0]) == "file" {
+				return strings.TrimSpace(kv[1])
+			}
+		}
+		break
+	}
+	return defaultSupervisorSocket
+}
+
+func checkSupervisorSocket() Result {
+	supervisorSocket := getSupervisorSocket()
+	result := Result{Check: "supervisor socket", Status: StatusOK, Detail: supervisorSocket + " is accessible"}
+	stat, err := os.Stat(supervisorSocket)
+	if err != nil {
+		result.Status = StatusFail
+		result.Detail = supervisorSocket + " not found, supervisord is not running"
+		result.Fix = "Start supervisord: sudo systemctl start supervisor"
+		return result
+	}
+	conn, err := net.Dial("unix", supervisorSocket)
+	if err != nil {
+		result.Status = StatusFail
+		result.Detail = "Cannot connect to " + supervisorSocket + " (mode " + stat.Mode().Perm().String() + "): " + err.Error()
+		result.Fix = "Run marlinctl as root, or set chmod/chown of [unix_http_server] in supervisord.conf to allow your user"
+		return result
+	}
+	conn.Close()
+	return result
+}
+
+func checkSupervisorConfDir() Result {
+	result := Result{Check: "supervisor conf dir", Status: StatusOK, Detail: util.SupervisorConfDir + " is writable"}
+	f, err := ioutil.TempFile(util.SupervisorConfDir, ".marlinctl-doctor-")
+	if err != nil {
+		result.Status = StatusFail
+		result.Detail = "Cannot write to " + util.SupervisorConfDir + ": " + err.Error()
+		result.Fix = "Run marlinctl as root or grant your user write access to " + util.SupervisorConfDir
+		if _, err := os.Stat(util.SupervisorConfDir); os.IsNotExist(err) {
+			result.Fix = "Install supervisor, which includes confs from " + util.SupervisorConfDir
+		}
+		return result
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return result
+}
+
+func checkRegistry() []Result {
+	var results []Result
+
+	freshness := Result{Check: "registry freshness", Status: StatusOK}
+	lastSync := viper.GetTime("last_registry_sync")
+	if lastSync.IsZero() {
+		freshness.Status = StatusFail
+		freshness.Detail = "registry was never synced"
+		freshness.Fix = "Run marlinctl --registry-sync"
+	} else if age := time.Since(lastSync); age > registryStaleAfter {
+		freshness.Status = StatusWarn
+		freshness.Detail = "last synced " + age.Truncate(time.Minute).String() + " ago"
+		freshness.Fix = "Run marlinctl --registry-sync"
+	} else {
+		freshness.Detail = "last synced " + age.Truncate(time.Second).String() + " ago"
+	}
+	results = append(results, freshness)
+
+	projectIDs := append([]string{types.ProjectID_marlinctl}, projects.GetProjectIDs()...)
+	for _, r := range registry.GlobalRegistry {
+		if !r.Enabled {
+			continue
+		}
+		result := Result{Check: "registry " + r.Name, Status: StatusOK, Detail: "releases of all configured projects are readable"}
+		if _, err := os.Stat(r.Local); err != nil {
+			result.Status = StatusFail
+			result.Detail = "local copy " + r.Local + " missing"
+			result.Fix = "Run marlinctl --registry-sync"
+			results = append(results, result)
+			continue
+		}
+		var broken []string
+		for _, projectID := range projectIDs {
+			releaseFile := r.Local + "/projects/" + projectID + "/releases.json"
+			data, err := ioutil.ReadFile(releaseFile)
+			if os.IsNotExist(err) {
+				continue
+			}
+			releasesJson := types.ReleaseJSON{}
+			if err == nil {
+				err = json.Unmarshal(data, &releasesJson)
+			}
+			if err != nil || releasesJson.JSONVersion != 1 {
+				broken = append(broken, releaseFile)
+			}
+		}
+		if len(broken) != 0 {
+			result.Status = StatusFail
+			result.Detail = "unreadable releases: " + strings.Join(broken, ", ")
+			result.Fix = "Remove " + r.Local + " and run marlinctl --registry-sync"
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func checkChecksums(instances []projects.Instance) []Result {
+	var results []Result
+	for _, instance := range instances {
+		name := instance.ProjectID + " instance " + instance.InstanceID
+		fix := "Run marlinctl " + projects.CommandPaths[instance.ProjectID] + " recreate -i " + instance.InstanceID
+		result := Result{Check: "checksums " + name, Status: StatusOK, Detail: "binaries match registry"}
+		projectVersion, err := registry.GlobalRegistry.GetVersionToRun(instance.ProjectID, "", instance.GetString("Version"))
+		if err != nil {
+			result.Status = StatusWarn
+			result.Detail = "Cannot find version " + instance.GetString("Version") + " in registry: " + err.Error()
+			result.Fix = "Run marlinctl --registry-sync, or upgrade instance to a published version"
+			results = append(results, result)
+			continue
+		}
+		var mismatches []string
+		for exe, err := range instance.VerifyChecksums(projectVersion.RunnerData) {
+			if err != nil {
+				mismatches = append(mismatches, exe+": "+err.Error())
+			}
+		}
+		sort.Strings(mismatches)
+		if len(mismatches) != 0 {
+			result.Status = StatusFail
+			result.Detail = strings.Join(mismatches, "; ")
+			result.Fix = fix
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func checkKeystores(instances []projects.Instance) []Result {
+	var results []Result
+	for _, projectID := range projects.GetProjectIDs() {
+		if !keystoreProjects[projectID] {
+			continue
+		}
+		command := "marlinctl " + projects.CommandPaths[projectID] + " keystore"
+		keystorePath, passPath, err := keystore.GetKeystoreDetails(projectID)
+		if err != nil {
+			results = append(results, Result{
+				Check:  "keystore " + projectID,
+				Status: StatusWarn,
+				Detail: "no default keystore, instances need --keystore-path",
+				Fix:    "Run " + command + " create",
+			})
+			continue
+		}
+		owner, _ := util.GetServiceUser(projectID)
+		results = append(results, checkKeystore("keystore "+projectID, keystorePath, passPath, owner, command, ""))
+	}
+
+	names, err := keystore.SharedNames()
+	if err != nil {
+		results = append(results, Result{Check: "shared keystores", Status: StatusWarn, Detail: err.Error()})
+	}
+	for _, name := range names {
+		keystorePath, passPath, err := keystore.GetSharedKeystoreDetails(name)
+		if err != nil {
+			results = append(results, Result{Check: "keystore " + name, Status: StatusWarn, Detail: err.Error()})
+			continue
+		}
+		results = append(results, checkKeystore("keystore "+name, keystorePath, passPath, nil, sharedKeystoreCommand(keystorePath, instances), " --name "+name))
+	}
+
+	for _, instance := range instances {
+		check := "keystore " + instance.ProjectID + " instance " + instance.InstanceID
+		var missing []string
+		for _, key := range []string{"KeystorePath", "KeystorePassPath"} {
+			location := instance.GetString(key)
+			if location == "" {
+				continue
+			}
+			if _, err := os.Stat(location); err != nil {
+				missing = append(missing, location)
+			}
+		}
+		passPath := instance.GetString("KeystorePassPath")
+		if len(missing) != 0 {
+			fix := "Restore keystore files or recreate instance with a valid --keystore-path"
+			if len(missing) == 1 && missing[0] == passPath && passPath == keystore.PassPath(instance.GetString("KeystorePath")) {
+				fix = "Run marlinctl " + projects.CommandPaths[instance.ProjectID] + " restart -i " + instance.InstanceID + " to unlock passphrase again, it is lost on reboot"
+			}
+			results = append(results, Result{
+				Check:  check,
+				Status: StatusFail,
+				Detail: "missing " + strings.Join(missing, ", "),
+				Fix:    fix,
+			})
+		} else if passPath != "" {
+			owner, _ := util.GetServiceUser(instance.ProjectID)
+			if err := keystore.CheckPassphraseFile(passPath, owner); err != nil {
+				results = append(results, Result{
+					Check:  check,
+					Status: StatusFail,
+					Detail: "insecure passphrase file: " + err.Error(),
+					Fix:    "Run chmod 600 on it, or marlinctl " + projects.CommandPaths[instance.ProjectID] + " keystore migrate-secret",
+				})
+			}
+		}
+	}
+	return results
+}
+
+// sharedKeystoreCommand returns keystore command of a project using shared
+// keystore, any project's keystore command manages shared keystores.
+func sharedKeystoreCommand(keystorePath string, instances []projects.Instance) string {
+	for _, instance := range instances {
+		if instance.GetString("KeystorePath") == keystorePath && keystoreProjects[instance.ProjectID] {
+			return "marlinctl " + projects.CommandPaths[instance.ProjectID] + " keystore"
+		}
+	}
+	return "marlinctl <project> keystore"
+}
+
+// checkKeystore checks that passphrase of keystore is in place and readable
+// only by its owner.
+func checkKeystore(check string, keystorePath string, passPath string, owner *user.User, command string, flags string) Result {
+	result := Result{Check: check, Status: StatusOK, Detail: "default keystore present"}
+	if secret, err := keystore.GetSecret(keystorePath); err != nil {
+		result.Status = StatusFail
+		result.Detail = err.Error()
+		result.Fix = "Run " + command + " migrate-secret" + flags + " to store passphrase again"
+	} else if secret.Backend != keystore.SecretBackendFile {
+		result.Detail = "passphrase kept in " + secret.Backend
+	} else if _, err := os.Stat(passPath); err != nil {
+		result.Status = StatusFail
+		result.Detail = "passphrase file " + passPath + " missing"
+		result.Fix = "Restore keystore using " + command + " restore" + flags + ", or recreate it using keystore destroy and keystore create"
+	} else if err := keystore.CheckPassphraseFile(passPath, owner); err != nil {
+		result.Status = StatusFail
+		result.Detail = "insecure passphrase file: " + err.Error()
+		result.Fix = "Run chmod 600 on it, or " + command + " migrate-secret" + flags
+	}
+	return result
+}
+
+// checkServiceUsers checks that service users of projects exist and can
+// reach binaries and keystores of instances they run.
+func checkServiceUsers(instances []projects.Instance) []Result {
+	var results []Result
+	for _, projectID := range projects.GetProjectIDs() {
+		if !util.HasServiceUser(projectID) {
+			continue
+		}
+		serviceUser, err := util.GetServiceUser(projectID)
+		if err != nil {
+			results = append(results, Result{
+				Check:  "service user " + projectID,
+				Status: StatusFail,
+				Detail: err.Error(),
+				Fix:    "Run marlinctl service-user setup --project " + projectID,
+			})
+			continue
+		}
+		result := Result{Check: "service user " + projectID, Status: StatusOK, Detail: "programs run as " + serviceUser.Username}
+		for _, instance := range instances {
+			if instance.ProjectID != projectID {
+				continue
+			}
+			var locations []string
+			for _, location := range instance.Executables() {
+				locations = append(locations, location)
+			}
+			locations = append(locations, instance.GetString("KeystorePath"), instance.GetString("KeystorePassPath"))
+			for _, location := range locations {
+				if location == "" {
+					continue
+				}
+				if _, err := util.CheckTraversable(location, serviceUser); err != nil && !os.IsNotExist(err) {
+					result.Status = StatusFail
+					result.Detail = "instance " + instance.InstanceID + ": " + err.Error()
+					result.Fix = "Run marlinctl service-user setup --project " + projectID + " --allow-traverse, or move storage using marlinctl " + projects.CommandPaths[projectID] + " config modify --storage"
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func checkSupervisorConfs(instances []projects.Instance) []Result {
+	var results []Result
+	confs := util.SupervisorConfPrograms()
+	claimed := make(map[string]bool)
+
+	for _, instance := range instances {
+		var missing []string
+		for _, prg := range instance.Programs() {
+			if conf, ok := confs[prg]; ok {
+				claimed[conf] = true
+			} else {
+				missing = append(missing, prg)
+			}
+		}
+		if len(missing) != 0 {
+			results = append(results, Result{
+				Check:  "resource " + instance.ProjectID + " instance " + instance.InstanceID,
+				Status: StatusFail,
+				Detail: "no supervisor conf for programs " + strings.Join(missing, ", "),
+				Fix:    "Run marlinctl reconcile --fix, or remove " + instance.ResourceFile + " if instance is gone",
+			})
+		}
+	}
+
+	orphaned := make(map[string]bool)
+	for _, conf := range confs {
+		if !claimed[conf] && (projects.IsManagedSupervisorConf(conf) || projects.IsRunnerNamedSupervisorConf(conf)) {
+			orphaned[conf] = true
+		}
+	}
+	var orphanedConfs []string
+	for conf := range orphaned {
+		orphanedConfs = append(orphanedConfs, conf)
+	}
+	sort.Strings(orphanedConfs)
+	for _, conf := range orphanedConfs {
+		result := Result{
+			Check:  "supervisor conf " + conf,
+			Status: StatusWarn,
+			Detail: "no resource file refers to programs of conf",
+			Fix:    "Run marlinctl reconcile --fix",
+		}
+		if !projects.IsManagedSupervisorConf(conf) {
+			result.Detail = "conf not written by marlinctl and no resource file refers to its programs"
+			result.Fix = "Adopt its programs using marlinctl <project> adopt, or remove it"
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		results = append(results, Result{"supervisor confs", StatusOK, "resource files and supervisor confs agree", ""})
+	}
+	return results
+}
@@ -0,0 +1,290 @@
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/registry"
+	"github.com/marlinprotocol/ctl2/modules/runner"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const registrySyncInterval = 15 * time.Minute
+const stateRefreshInterval = time.Minute
+
+type checksumCacheEntry struct {
+	modTime  time.Time
+	size     int64
+	checksum string
+	ok       bool
+}
+
+// Exporter serves metrics of instances managed by marlinctl in prometheus
+// text exposition format.
+type Exporter struct {
+	mu             sync.Mutex
+	lastSync       time.Time
+	lastSyncTry    time.Time
+	ownSync        time.Time
+	versionCache   map[string]registry.ProjectVersion
+	checksumCache  map[string]checksumCacheEntry
+	registryErrors map[string]bool
+}
+
+func NewExporter() *Exporter {
+	return &Exporter{
+		versionCache:   make(map[string]registry.ProjectVersion),
+		checksumCache:  make(map[string]checksumCacheEntry),
+		registryErrors: make(map[string]bool),
+	}
+}
+
+// Start keeps state and registry used by scrapes fresh in background, so
+// that scrapes only read them.
+func (e *Exporter) Start() {
+	go func() {
+		for {
+			e.refresh()
+			time.Sleep(stateRefreshInterval)
+		}
+	}()
+}
+
+// refresh re-reads state, which other marlinctl invocations own and which is
+// never written, and syncs registry when it is stale. Registry lookups
+// cached by scrapes are dropped once registry was synced since.
+func (e *Exporter) refresh() {
+	e.mu.Lock()
+	err := viper.ReadInConfig()
+	if err != nil {
+		log.Warning("Error while reading state, using state read earlier: ", err)
+	}
+	stale := time.Since(e.lastRegistrySync()) >= registrySyncInterval && time.Since(e.lastSyncTry) >= registrySyncInterval
+	e.mu.Unlock()
+
+	if stale {
+		e.lastSyncTry = time.Now()
+		err := registry.GlobalRegistry.Sync()
+		if err != nil {
+			log.Error("Error while syncing registry: " + err.Error())
+		} else {
+			e.mu.Lock()
+			e.ownSync = time.Now()
+			e.mu.Unlock()
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	lastSync := e.lastRegistrySync()
+	if !lastSync.Equal(e.lastSync) {
+		e.lastSync = lastSync
+		e.versionCache = make(map[string]registry.ProjectVersion)
+		e.registryErrors = make(map[string]bool)
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	m := newMetricWriter()
+	start := time.Now()
+	e.collect(m)
+	m.gauge("marlinctl_exporter_scrape_duration_seconds", "Time taken to collect metrics.", nil, time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(m.String()))
+}
+
+func (e *Exporter) collect(m *metricWriter) {
+	lastSyncTimestamp := 0.0
+	if !e.lastSync.IsZero() {
+		lastSyncTimestamp = float64(e.lastSync.Unix())
+	}
+	m.gauge("marlinctl_last_registry_sync_timestamp_seconds", "Unix time of last registry sync, 0 if never synced.", nil, lastSyncTimestamp)
+
+	instances, err := projects.GetInstances()
+	if err != nil {
+		log.Error("Error while listing instances: ", err)
+		m.gauge("marlinctl_exporter_up", "Whether instances could be listed.", nil, 0)
+		return
+	}
+	m.gauge("marlinctl_exporter_up", "Whether instances could be listed.", nil, 1)
+
+	for _, instance := range instances {
+		e.collectInstance(m, instance)
+	}
+}
+
+func (e *Exporter) collectInstance(m *metricWriter, instance projects.Instance) {
+	labels := []string{"project", instance.ProjectID, "instance", instance.InstanceID}
+	version := instance.GetString("Version")
+
+	var report runner.HealthReport
+	r, err := instance.Runner()
+	if err == nil {
+		report, err = r.Health(runner.HealthOptions{HTTPProbe: instance.GetString("HealthProbe")})
+	}
+	if err != nil {
+		log.Warning("Error while fetching health of ", instance.ProjectID, " instance ", instance.InstanceID, ": ", err)
+		report.Status = runner.HealthUnknown
+	}
+
+	up := 1.0
+	if len(report.Programs) == 0 {
+		up = 0
+	}
+	for _, p := range report.Programs {
+		programLabels := append(labels[:len(labels):len(labels)], "program", p.Program)
+		running := 0.0
+		if p.State == "RUNNING" {
+			running = 1
+		} else {
+			up = 0
+		}
+		m.gauge("marlinctl_program_up", "Whether program is in RUNNING state.", programLabels, running)
+		m.gauge("marlinctl_program_state", "Supervisor state of program.", append(programLabels, "state", p.State), 1)
+		m.gauge("marlinctl_program_uptime_seconds", "Uptime of program as reported by supervisor.", programLabels, p.Uptime.Seconds())
+		if p.Restarts >= 0 {
+			m.gauge("marlinctl_program_restarts", "Number of restarts of program as recorded in supervisor log.", programLabels, float64(p.Restarts))
+		}
+	}
+	m.gauge("marlinctl_instance_up", "Whether every program of instance is RUNNING.", labels, up)
+	m.gauge("marlinctl_instance_health_status", "Health of instance, 0 ok, 1 warning, 2 critical, 3 unknown.", labels, float64(report.Status))
+
+	latest, latestErr := e.getVersion(instance.ProjectID, "")
+	latestVersion := latest.Version
+	if latestErr != nil {
+		latestVersion = "unknown"
+	}
+	m.gauge("marlinctl_instance_version_info", "Version run by instance along with latest eligible version in registry.",
+		append(labels[:len(labels):len(labels)], "version", version, "latest_version", latestVersion), 1)
+	if latestErr == nil {
+		outdated := 0.0
+		if version != latest.Version {
+			outdated = 1
+		}
+		m.gauge("marlinctl_instance_version_outdated", "Whether instance runs a version other than latest eligible version.", labels, outdated)
+	}
+
+	current, err := e.getVersion(instance.ProjectID, version)
+	if err != nil {
+		return
+	}
+	runnerData, _ := current.RunnerData.(map[string]interface{})
+	for name, location := range instance.Executables() {
+		checksum, ok := runnerData[name+"_checksum"].(string)
+		if !ok {
+			continue
+		}
+		value := 0.0
+		if e.checksumOK(location, checksum) {
+			value = 1
+		}
+		m.gauge("marlinctl_executable_checksum_ok", "Whether executable matches checksum published in registry.",
+			append(labels[:len(labels):len(labels)], "executable", name), value)
+	}
+}
+
+// getVersion returns registry entry for a version of project, or latest
+// eligible version if version is empty. Results are cached until next
+// registry sync.
+func (e *Exporter) getVersion(projectID string, version string) (registry.ProjectVersion, error) {
+	key := projectID + "@" + version
+	if v, ok := e.versionCache[key]; ok {
+		return v, nil
+	}
+	if e.registryErrors[key] {
+		return registry.ProjectVersion{}, fmt.Errorf("version %s of %s not found in registry", version, projectID)
+	}
+	v, err := registry.GlobalRegistry.GetVersionToRun(projectID, "", version)
+	if err != nil {
+		e.registryErrors[key] = true
+		return v, err
+	}
+	e.versionCache[key] = v
+	return v, nil
+}
+
+// checksumOK verifies checksum of an executable, reusing earlier result as
+// long as the executable has not changed on disk.
+func (e *Exporter) checksumOK(location string, checksum string) bool {
+	stat, err := os.Stat(location)
+	if err != nil {
+		return false
+	}
+	if c, ok := e.checksumCache[location]; ok && c.modTime.Equal(stat.ModTime()) && c.size == stat.Size() && c.checksum == checksum {
+		return c.ok
+	}
+	ok := util.VerifyChecksum(location, checksum) == nil
+	e.checksumCache[location] = checksumCacheEntry{stat.ModTime(), stat.Size(), checksum, ok}
+	return ok
+}
+
+// lastRegistrySync returns time registry was last synced, either by
+// exporter itself or by any other marlinctl invocation. Time of own syncs is
+// kept in memory only, as writing state could undo changes made to it since
+// it was read.
+func (e *Exporter) lastRegistrySync() time.Time {
+	lastSync := viper.GetTime("last_registry_sync")
+	if e.ownSync.After(lastSync) {
+		return e.ownSync
+	}
+	return lastSync
+}
+
+type metricWriter struct {
+	families map[string][]string
+	help     map[string]string
+}
+
+func newMetricWriter() *metricWriter {
+	return &metricWriter{make(map[string][]string), make(map[string]string)}
+}
+
+// gauge records a sample of a gauge, labels are given as key value pairs.
+func (m *metricWriter) gauge(name string, help string, labels []string, value float64) {
+	m.help[name] = help
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"=\""+escapeLabelValue(labels[i+1])+"\"")
+	}
+	sample := name
+	if len(pairs) != 0 {
+		sample += "{" + strings.Join(pairs, ",") + "}"
+	}
+	m.families[name] = append(m.families[name], fmt.Sprintf("%s %g", sample, value))
+}
+
+func (m *metricWriter) String() string {
+	var names []string
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, m.help[name])
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, sample := range m.families[name] {
+			b.WriteString(sample + "\n")
+		}
+	}
+	return b.String()
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
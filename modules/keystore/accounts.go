@@ -0,0 +1,171 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package keystore
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethKeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/marlinprotocol/ctl2/modules/util"
+)
+
+// defaultAccountFile holds address of account used by a project when no
+// account is asked for explicitly.
+const defaultAccountFile = "default"
+
+var keystoreNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+type Account struct {
+	Address  string
+	Path     string
+	PassPath string
+	Default  bool
+}
+
+// Dir returns keystore directory of project.
+func Dir(projectId string) (string, error) {
+	home, err := util.GetUser()
+	if err != nil {
+		return "", err
+	}
+	return home.HomeDir + "/.marlin/ctl/storage/projects/" + projectId + "/common/keystore", nil
+}
+
+// SharedDir returns directory of named keystore, which instances of any
+// project can use.
+func SharedDir(name string) (string, error) {
+	if !keystoreNameRegex.MatchString(name) {
+		return "", errors.New("Invalid keystore name " + name + ", use letters, digits, '.', '_' and '-'")
+	}
+	root, err := sharedRoot()
+	if err != nil {
+		return "", err
+	}
+	return root + "/" + name, nil
+}
+
+// SharedNames lists named keystores.
+func SharedNames() ([]string, error) {
+	root, err := sharedRoot()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && keystoreNameRegex.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func sharedRoot() (string, error) {
+	home, err := util.GetUser()
+	if err != nil {
+		return "", err
+	}
+	return home.HomeDir + "/.marlin/ctl/storage/keystores", nil
+}
+
+// ListAccounts lists accounts held in keystore directory, marking the one
+// used by default.
+func ListAccounts(keystoreDir string) []Account {
+	kstore := ethKeystore.NewKeyStore(keystoreDir, ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
+	defaultAccount := defaultAccount(keystoreDir, kstore.Accounts())
+	var list []Account
+	for _, acc := range kstore.Accounts() {
+		list = append(list, Account{
+			Address:  acc.Address.Hex(),
+			Path:     acc.URL.Path,
+			PassPath: PassPath(acc.URL.Path),
+			Default:  acc.Address == defaultAccount.Address,
+		})
+	}
+	return list
+}
+
+// FindAccount finds account with given address in keystore directory, or
+// the default account if address is empty.
+func FindAccount(keystoreDir string, address string) (Account, error) {
+	list := ListAccounts(keystoreDir)
+	if len(list) == 0 {
+		return Account{}, errors.New("no existing keystore found")
+	}
+	if address == "" {
+		for _, acc := range list {
+			if acc.Default {
+				return acc, nil
+			}
+		}
+	}
+	if !common.IsHexAddress(address) {
+		return Account{}, errors.New("Invalid address: " + address)
+	}
+	for _, acc := range list {
+		if acc.Address == common.HexToAddress(address).Hex() {
+			return acc, nil
+		}
+	}
+	return Account{}, errors.New("No account with address " + address + " in keystore")
+}
+
+// SelectAccount makes account with given address default account of
+// keystore directory.
+func SelectAccount(keystoreDir string, address string) error {
+	acc, err := FindAccount(keystoreDir, address)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(keystoreDir, defaultAccountFile), []byte(acc.Address+"\n"), 0644)
+}
+
+// defaultAccount returns account selected as default, falling back to first
+// account if none was selected or selected account is gone.
+func defaultAccount(keystoreDir string, list []accounts.Account) accounts.Account {
+	if len(list) == 0 {
+		return accounts.Account{}
+	}
+	selected, err := util.ReadStringFromFile(filepath.Join(keystoreDir, defaultAccountFile))
+	if err == nil {
+		for _, acc := range list {
+			if acc.Address == common.HexToAddress(strings.TrimSpace(selected)) {
+				return acc
+			}
+		}
+	}
+	return list[0]
+}
+
+func clearDefaultAccount(keystoreDir string, address string) error {
+	selected, err := util.ReadStringFromFile(filepath.Join(keystoreDir, defaultAccountFile))
+	if err != nil || common.HexToAddress(strings.TrimSpace(selected)).Hex() != address {
+		return nil
+	}
+	return os.Remove(filepath.Join(keystoreDir, defaultAccountFile))
+}
@@ -0,0 +1,257 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package keystore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ethKeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// BackupMaxAge is how old latest backup of an account may be for it to be
+// destroyed without --force.
+const BackupMaxAge = 7 * 24 * time.Hour
+
+const backupVersion = 1
+
+// backupArchive is the on disk format of keystore backups. Payload is a
+// gzipped tarball of keystore files, their passphrases and default account,
+// encrypted the same way keys of JSON keystores are.
+type backupArchive struct {
+	Version  int
+	Created  time.Time
+	Accounts []string
+	Crypto   ethKeystore.CryptoJSON
+}
+
+// BackupRecord tells when an account was last backed up and where to.
+type BackupRecord struct {
+	Time    time.Time
+	Archive string
+}
+
+// Backup writes account with given address, or all accounts if address is
+// empty, along with their passphrases into an archive at output encrypted
+// using passphrase.
+func Backup(keystoreDir string, address string, output string, passphrase string) ([]Account, error) {
+	if passphrase == "" {
+		return nil, errors.New("Backup passphrase cannot be empty")
+	}
+	list := ListAccounts(keystoreDir)
+	if len(list) == 0 {
+		return nil, errors.New("no existing keystore found")
+	}
+	if address != "" {
+		acc, err := FindAccount(keystoreDir, address)
+		if err != nil {
+			return nil, err
+		}
+		list = []Account{acc}
+	}
+
+	var payload bytes.Buffer
+	gw := gzip.NewWriter(&payload)
+	tw := tar.NewWriter(gw)
+	archive := backupArchive{Version: backupVersion, Created: time.Now().UTC()}
+	for _, acc := range list {
+		key, err := ioutil.ReadFile(acc.Path)
+		if err != nil {
+			return nil, err
+		}
+		accPassphrase, err := ReadPassphrase(acc.Path)
+		if err != nil {
+			return nil, errors.New("cannot read passphrase of " + acc.Address + ": " + err.Error())
+		}
+		name := filepath.Base(acc.Path)
+		if err := addToTar(tw, name, key); err != nil {
+			return nil, err
+		}
+		if err := addToTar(tw, name+"-pass", []byte(accPassphrase)); err != nil {
+			return nil, err
+		}
+		if acc.Default {
+			if err := addToTar(tw, defaultAccountFile, []byte(acc.Address+"\n")); err != nil {
+				return nil, err
+			}
+		}
+		archive.Accounts = append(archive.Accounts, acc.Address)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	archive.Crypto, err = ethKeystore.EncryptDataV3(payload.Bytes(), []byte(passphrase), ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
+	if err != nil {
+		return nil, errors.New("Error while encrypting backup: " + err.Error())
+	}
+	data, err := json.MarshalIndent(archive, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(output, data, 0600); err != nil {
+		return nil, errors.New("Error while writing backup: " + err.Error())
+	}
+
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return nil, err
+	}
+	record, err := json.MarshalIndent(BackupRecord{Time: archive.Created, Archive: output}, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	for _, acc := range list {
+		if err := ioutil.WriteFile(acc.Path+"-backup", record, 0600); err != nil {
+			return nil, errors.New("Error while recording backup of " + acc.Address + ": " + err.Error())
+		}
+	}
+	if err := util.ChownRmarlinctlDir(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Restore adds accounts held in backup archive to keystore directory.
+// Accounts already in keystore are left untouched. Restored passphrases are
+// kept in plain files, like for imported accounts.
+func Restore(keystoreDir string, data []byte, passphrase string) ([]Account, error) {
+	var archive backupArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, errors.New("Not a keystore backup: " + err.Error())
+	}
+	if archive.Version != backupVersion {
+		return nil, errors.New("Unsupported keystore backup version")
+	}
+	payload, err := ethKeystore.DecryptDataV3(archive.Crypto, passphrase)
+	if err != nil {
+		return nil, errors.New("Error while decrypting backup: " + err.Error())
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.New("Error while reading backup: " + err.Error())
+		}
+		files[header.Name], err = ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, errors.New("Error while reading backup: " + err.Error())
+		}
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hadAccounts := len(ListAccounts(keystoreDir)) != 0
+	var restored []Account
+	for _, name := range names {
+		key := files[name]
+		if name == defaultAccountFile || strings.HasSuffix(name, "-pass") {
+			continue
+		}
+		var k struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(key, &k); err != nil {
+			return restored, errors.New("Error while reading " + name + " from backup: " + err.Error())
+		}
+		if acc, err := FindAccount(keystoreDir, k.Address); err == nil {
+			log.Warning("Account ", acc.Address, " is already in keystore, skipping")
+			continue
+		}
+		accPassphrase := string(files[name+"-pass"])
+		acc, err := Import(keystoreDir, key, accPassphrase, accPassphrase)
+		if err != nil {
+			return restored, err
+		}
+		restored = append(restored, acc)
+	}
+
+	if selected, ok := files[defaultAccountFile]; ok && !hadAccounts && len(restored) != 0 {
+		if err := SelectAccount(keystoreDir, strings.TrimSpace(string(selected))); err != nil {
+			return restored, err
+		}
+	}
+	return restored, nil
+}
+
+// LastBackup returns record of latest backup of keystore, if any.
+func LastBackup(keystorePath string) (BackupRecord, bool) {
+	data, err := ioutil.ReadFile(keystorePath + "-backup")
+	if err != nil {
+		return BackupRecord{}, false
+	}
+	var record BackupRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return BackupRecord{}, false
+	}
+	return record, true
+}
+
+// checkRecentBackup tells if keystore was backed up within BackupMaxAge to
+// an archive which is still in place.
+func checkRecentBackup(acc Account) error {
+	record, ok := LastBackup(acc.Path)
+	if !ok {
+		return errors.New("Account " + acc.Address + " was never backed up")
+	}
+	if time.Since(record.Time) > BackupMaxAge {
+		return errors.New("Latest backup of account " + acc.Address + " is older than " + BackupMaxAge.String())
+	}
+	if !util.FileExists(record.Archive) {
+		return errors.New("Latest backup of account " + acc.Address + " at " + record.Archive + " is gone")
+	}
+	return nil
+}
+
+func addToTar(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
@@ -0,0 +1,77 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPrivateKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+func importTestAccount(t *testing.T, keystoreDir string, passphrase string) Account {
+	acc, err := Import(keystoreDir, []byte(testPrivateKey), "", passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return acc
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	acc := importTestAccount(t, filepath.Join(dir, "keystore"), "account passphrase")
+	output := filepath.Join(dir, "backup.json")
+
+	if _, err := Backup(filepath.Join(dir, "keystore"), "", output, ""); err == nil {
+		t.Error("Backup accepted an empty passphrase")
+	}
+	backedUp, err := Backup(filepath.Join(dir, "keystore"), "", output, "backup passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backedUp) != 1 || backedUp[0].Address != acc.Address {
+		t.Fatalf("Backup backed up %+v, expected %s", backedUp, acc.Address)
+	}
+	record, ok := LastBackup(acc.Path)
+	if !ok || record.Archive != output {
+		t.Errorf("LastBackup = %+v, %v, expected archive %s", record, ok, output)
+	}
+	if err := checkRecentBackup(acc); err != nil {
+		t.Error(err)
+	}
+
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "account passphrase") {
+		t.Error("Backup holds account passphrase in plain text")
+	}
+	restoreDir := filepath.Join(dir, "restored")
+	if _, err := Restore(restoreDir, data, "wrong passphrase"); err == nil {
+		t.Error("Restore accepted a wrong passphrase")
+	}
+	restored, err := Restore(restoreDir, data, "backup passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || restored[0].Address != acc.Address {
+		t.Fatalf("Restore restored %+v, expected %s", restored, acc.Address)
+	}
+	passphrase, err := ReadPassphrase(restored[0].Path)
+	if err != nil || passphrase != "account passphrase" {
+		t.Errorf("Passphrase of restored account = %q, %v", passphrase, err)
+	}
+	list := ListAccounts(restoreDir)
+	if len(list) != 1 || !list[0].Default {
+		t.Errorf("Accounts after restore = %+v, expected restored account to be default", list)
+	}
+
+	restored, err = Restore(restoreDir, data, "backup passphrase")
+	if err != nil || len(restored) != 0 {
+		t.Errorf("Restoring again restored %+v, %v, expected accounts in keystore to be skipped", restored, err)
+	}
+	if _, err := Restore(restoreDir, []byte("not a backup"), "backup passphrase"); err == nil {
+		t.Error("Restore accepted data which is not a backup")
+	}
+}
@@ -38,7 +38,7 @@ func Create(keystoreDirPath string, passphrase string) error {
 
 	log.Info("created new keysore with address ", kstore.Accounts()[0].Address)
 
-	if err := ioutil.WriteFile(kstore.Accounts()[0].URL.Path+"-pass", []byte(passphrase), 0644); err != nil {
+	if err := ioutil.WriteFile(kstore.Accounts()[0].URL.Path+"-pass", []byte(passphrase), 0600); err != nil {
 		log.Error("error in writing password file ", err)
 		if err := kstore.Delete(kstore.Accounts()[0], passphrase); err != nil {
 			log.Error("error while deleting previous keystore", err)
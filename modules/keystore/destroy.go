@@ -17,33 +17,43 @@ package keystore
 
 import (
 	"errors"
-	"io/ioutil"
-	"os"
-	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	ethKeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/marlinprotocol/ctl2/modules/util"
 	log "github.com/sirupsen/logrus"
 )
 
-func Destroy(keystoreDir string) error {
+func Destroy(keystoreDir string, address string, force bool) error {
 
-	kstore := ethKeystore.NewKeyStore(keystoreDir, ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
-	if len(kstore.Accounts()) == 0 {
-		return errors.New("No keystore found")
+	acc, err := FindAccount(keystoreDir, address)
+	if err != nil {
+		return err
 	}
-	keystorePassPath := kstore.Accounts()[0].URL.Path + "-pass"
-	passBytes, err := ioutil.ReadFile(keystorePassPath)
+	if err := checkRecentBackup(acc); err != nil {
+		if !force {
+			return errors.New(err.Error() + ", run keystore backup first or use --force to destroy anyway")
+		}
+		log.Warning(err, ", destroying anyway")
+	}
+	kstore := ethKeystore.NewKeyStore(keystoreDir, ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
+	passphrase, err := ReadPassphrase(acc.Path)
 	if err != nil {
-		return errors.New("cannot read keystore password file at path " + keystorePassPath)
+		return errors.New("cannot read keystore passphrase: " + err.Error())
+	}
+	if err := kstore.Delete(accounts.Account{Address: common.HexToAddress(acc.Address)}, passphrase); err != nil {
+		return err
+	}
+	if err := removeSecret(acc.Path); err != nil {
+		return err
 	}
-	passphrase := string(passBytes)
-	passphrase = strings.TrimSuffix(passphrase, "\n")
-	if err := kstore.Delete(kstore.Accounts()[0], passphrase); err != nil {
+	if err := util.RemoveFileIfExists(acc.Path + "-backup"); err != nil {
 		return err
 	}
-	if err := os.Remove(keystorePassPath); err != nil {
+	if err := clearDefaultAccount(keystoreDir, acc.Address); err != nil {
 		return err
 	}
-	log.Info("successfully deleted keystore")
+	log.Info("successfully deleted keystore with address ", acc.Address)
 	return nil
 }
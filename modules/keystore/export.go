@@ -0,0 +1,43 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package keystore
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethKeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Export returns account with given address, or default account, as
+// encrypted JSON keystore. Key is encrypted using newPassphrase, or using
+// passphrase it is stored with if newPassphrase is empty.
+func Export(keystoreDir string, address string, newPassphrase string) ([]byte, error) {
+	acc, err := FindAccount(keystoreDir, address)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := ReadPassphrase(acc.Path)
+	if err != nil {
+		return nil, errors.New("cannot read keystore passphrase: " + err.Error())
+	}
+	if newPassphrase == "" {
+		newPassphrase = passphrase
+	}
+	kstore := ethKeystore.NewKeyStore(keystoreDir, ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
+	return kstore.Export(accounts.Account{Address: common.HexToAddress(acc.Address)}, passphrase, newPassphrase)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethKeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Import adds an existing account to keystore directory. Key is either an
+// encrypted JSON keystore, which is decrypted using passphrase, or a hex
+// encoded private key. Account is stored encrypted with newPassphrase, which
+// is written alongside it like for created keystores.
+func Import(keystoreDir string, key []byte, passphrase string, newPassphrase string) (Account, error) {
+	kstore := ethKeystore.NewKeyStore(keystoreDir, ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
+	hadAccounts := len(kstore.Accounts()) != 0
+
+	var acc accounts.Account
+	var err error
+	if json.Valid(key) {
+		acc, err = kstore.Import(key, passphrase, newPassphrase)
+	} else {
+		privateKey, keyErr := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(string(key)), "0x"))
+		if keyErr != nil {
+			return Account{}, errors.New("Key is neither a JSON keystore nor a hex encoded private key: " + keyErr.Error())
+		}
+		acc, err = kstore.ImportECDSA(privateKey, newPassphrase)
+	}
+	if err != nil {
+		return Account{}, errors.New("Error while importing account: " + err.Error())
+	}
+
+	if err := ioutil.WriteFile(acc.URL.Path+"-pass", []byte(newPassphrase), 0600); err != nil {
+		if err := kstore.Delete(acc, newPassphrase); err != nil {
+			log.Error("error while deleting imported account ", err)
+		}
+		return Account{}, errors.New("Error while writing passphrase file: " + err.Error())
+	}
+	log.Info("imported account with address ", acc.Address.Hex())
+
+	if !hadAccounts {
+		if err := SelectAccount(keystoreDir, acc.Address.Hex()); err != nil {
+			return Account{}, err
+		}
+	}
+	if err := util.ChownRmarlinctlDir(); err != nil {
+		return Account{}, err
+	}
+	return FindAccount(keystoreDir, acc.Address.Hex())
+}
@@ -18,27 +18,46 @@ package keystore
 import (
 	"errors"
 
-	ethKeystore "github.com/ethereum/go-ethereum/accounts/keystore"
-	"github.com/marlinprotocol/ctl2/modules/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
-// returns keystore and keystorePass file path if exists at default location, else return error
+// returns keystore and keystorePass file path of default account if exists at default location, else return error
 func GetKeystoreDetails(projectId string) (string, string, error) {
-	home, err := util.GetUser()
+	keystoreDir, err := Dir(projectId)
 	if err != nil {
 		return "", "", err
 	}
-	kstore := ethKeystore.NewKeyStore(home.HomeDir+"/.marlin/ctl/storage/projects/"+projectId+"/common/keystore", ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
-	if len(kstore.Accounts()) == 0 {
-		return "", "", errors.New("no existing keystore found")
+	acc, err := FindAccount(keystoreDir, "")
+	if err != nil {
+		return "", "", err
 	}
-	return kstore.Accounts()[0].URL.Path, kstore.Accounts()[0].URL.Path + "-pass", nil
+	return acc.Path, acc.PassPath, nil
+}
+
+// returns keystore and keystorePass file path of default account of named keystore
+func GetSharedKeystoreDetails(name string) (string, string, error) {
+	keystoreDir, err := SharedDir(name)
+	if err != nil {
+		return "", "", err
+	}
+	acc, err := FindAccount(keystoreDir, "")
+	if err != nil {
+		return "", "", errors.New("keystore " + name + ": " + err.Error())
+	}
+	return acc.Path, acc.PassPath, nil
 }
 
 func KeystoreCheck(cmd *cobra.Command, projectId string) error {
-	if !cmd.Flags().Changed("keystore-path") {
+	if cmd.Flags().Changed("keystore") {
+		name, _ := cmd.Flags().GetString("keystore")
+		_, _, err := GetSharedKeystoreDetails(name)
+		if err != nil {
+			log.Error(err)
+			log.Error("Please create keystore " + name + " using keystore create --name " + name)
+			return err
+		}
+	} else if !cmd.Flags().Changed("keystore-path") {
 		_, _, err := GetKeystoreDetails(projectId)
 		if err != nil {
 			log.Error(err)
@@ -0,0 +1,97 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package keystore
+
+import (
+	"errors"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethKeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// RotatePassphrase re-encrypts account with given address, or default
+// account, using newPassphrase and stores newPassphrase in backend current
+// passphrase is kept in. New passphrase is staged before key is re-encrypted
+// so that key and stored passphrase never disagree.
+func RotatePassphrase(keystoreDir string, address string, newPassphrase string) (Account, error) {
+	acc, err := FindAccount(keystoreDir, address)
+	if err != nil {
+		return Account{}, err
+	}
+	s, err := GetSecret(acc.Path)
+	if err != nil {
+		return Account{}, err
+	}
+	if s.Backend == SecretBackendCommand || s.Backend == SecretBackendEnv {
+		return Account{}, errors.New("Passphrase kept in " + s.Backend + " cannot be changed by marlinctl, move it to another backend using keystore migrate-secret first")
+	}
+	passphrase, err := s.read(acc.Path)
+	if err != nil {
+		return Account{}, errors.New("cannot read keystore passphrase: " + err.Error())
+	}
+	if newPassphrase == "" {
+		return Account{}, errors.New("New passphrase cannot be empty")
+	}
+
+	var staged, location string
+	switch s.Backend {
+	case SecretBackendFile:
+		location = acc.Path + "-pass"
+		staged = location + ".new"
+		err = writeSecretFile(staged, []byte(newPassphrase))
+	case SecretBackendSystemdCreds:
+		location = acc.Path + "-pass.cred"
+		staged = location + ".new"
+		err = runWithInput(newPassphrase, "systemd-creds", "encrypt", "--name="+secretName(acc.Path), "-", staged)
+	}
+	if err != nil {
+		util.RemoveFileIfExists(staged)
+		return Account{}, errors.New("Error while staging new passphrase: " + err.Error())
+	}
+
+	kstore := ethKeystore.NewKeyStore(keystoreDir, ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
+	ethAcc := accounts.Account{Address: common.HexToAddress(acc.Address)}
+	if err := kstore.Update(ethAcc, passphrase, newPassphrase); err != nil {
+		util.RemoveFileIfExists(staged)
+		return Account{}, errors.New("Error while re-encrypting keystore: " + err.Error())
+	}
+
+	if staged != "" {
+		err = os.Rename(staged, location)
+	} else {
+		err = runWithInput(newPassphrase, "keyctl", "padd", "user", secretName(acc.Path), "@u")
+	}
+	if err != nil {
+		if err := kstore.Update(ethAcc, newPassphrase, passphrase); err != nil {
+			log.Error("Error while re-encrypting keystore with old passphrase: ", err)
+		}
+		util.RemoveFileIfExists(staged)
+		return Account{}, errors.New("Error while storing new passphrase: " + err.Error())
+	}
+
+	// Programs read passphrases not kept in a file from tmpfs
+	if s.Backend != SecretBackendFile && util.FileExists(acc.PassPath) {
+		if err := Unlock(acc.Path, acc.PassPath); err != nil {
+			return Account{}, err
+		}
+	}
+	log.Info("rotated passphrase of keystore with address ", acc.Address)
+	return acc, nil
+}
@@ -0,0 +1,319 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+)
+
+// Backends passphrases of keystores can be kept in.
+const (
+	SecretBackendFile         = "file"
+	SecretBackendSystemdCreds = "systemd-creds"
+	SecretBackendKeyring      = "keyring"
+	SecretBackendCommand      = "command"
+	SecretBackendEnv          = "env"
+)
+
+var SecretBackends = []string{SecretBackendFile, SecretBackendSystemdCreds, SecretBackendKeyring, SecretBackendCommand, SecretBackendEnv}
+
+// runtimeSecretDir holds passphrases of keystores not kept in a file for
+// programs to read, written when instances using them are started. Lives on
+// tmpfs so that passphrases never reach disk.
+const runtimeSecretDir = "/run/marlinctl/keystore"
+
+// Secret describes where passphrase of a keystore is kept. It is stored next
+// to keystore as <keystore>-secret, keystores without one keep passphrase in
+// plain file <keystore>-pass.
+type Secret struct {
+	Backend string
+	Command string `json:",omitempty"`
+	Env     string `json:",omitempty"`
+}
+
+func GetSecret(keystorePath string) (Secret, error) {
+	data, err := ioutil.ReadFile(keystorePath + "-secret")
+	if os.IsNotExist(err) {
+		return Secret{Backend: SecretBackendFile}, nil
+	} else if err != nil {
+		return Secret{}, err
+	}
+	var s Secret
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Secret{}, errors.New("Error while reading " + keystorePath + "-secret: " + err.Error())
+	}
+	return s, nil
+}
+
+// PassPath returns passphrase file programs using keystore are given.
+func PassPath(keystorePath string) string {
+	if s, err := GetSecret(keystorePath); err == nil && s.Backend != SecretBackendFile {
+		return runtimeSecretDir + "/" + filepath.Base(keystorePath) + "-pass"
+	}
+	return keystorePath + "-pass"
+}
+
+// ReadPassphrase reads passphrase of keystore from backend it is kept in.
+func ReadPassphrase(keystorePath string) (string, error) {
+	s, err := GetSecret(keystorePath)
+	if err != nil {
+		return "", err
+	}
+	return s.read(keystorePath)
+}
+
+// Unlock writes passphrase of keystore to passPath for programs to read, if
+// passphrase is not kept in a file already and passPath is where programs
+// expect it.
+func Unlock(keystorePath string, passPath string) error {
+	s, err := GetSecret(keystorePath)
+	if err != nil || s.Backend == SecretBackendFile || passPath != PassPath(keystorePath) {
+		return err
+	}
+	passphrase, err := s.read(keystorePath)
+	if err != nil {
+		return errors.New("Error while reading passphrase from " + s.Backend + ": " + err.Error())
+	}
+	return writeSecretFile(passPath, []byte(passphrase))
+}
+
+// MigrateSecret moves passphrase of keystore into backend described by s.
+// Plain passphrase file is left in place for RemovePassphraseFile to remove
+// once nothing refers to it any more.
+func MigrateSecret(keystorePath string, s Secret) error {
+	passphrase, err := ReadPassphrase(keystorePath)
+	if err != nil {
+		return errors.New("Error while reading current passphrase: " + err.Error())
+	}
+	switch s.Backend {
+	case SecretBackendFile:
+		if err := writeSecretFile(keystorePath+"-pass", []byte(passphrase)); err != nil {
+			return err
+		}
+		return util.RemoveFileIfExists(keystorePath + "-secret")
+	case SecretBackendSystemdCreds:
+		err = runWithInput(passphrase, "systemd-creds", "encrypt", "--name="+secretName(keystorePath), "-", keystorePath+"-pass.cred")
+	case SecretBackendKeyring:
+		err = runWithInput(passphrase, "keyctl", "padd", "user", secretName(keystorePath), "@u")
+	case SecretBackendCommand:
+		if s.Command == "" {
+			return errors.New("Command printing passphrase has to be given for command backend")
+		}
+	case SecretBackendEnv:
+		if s.Env == "" {
+			return errors.New("Environment variable holding passphrase has to be given for env backend")
+		}
+	default:
+		return errors.New("Unknown secret backend " + s.Backend + ", use one of " + strings.Join(SecretBackends, ", "))
+	}
+	if err != nil {
+		return errors.New("Error while storing passphrase in " + s.Backend + ": " + err.Error())
+	}
+
+	stored, err := s.read(keystorePath)
+	if err != nil {
+		return errors.New("Error while reading passphrase back from " + s.Backend + ": " + err.Error())
+	}
+	if stored != passphrase {
+		return errors.New("Passphrase read back from " + s.Backend + " does not match passphrase of keystore")
+	}
+	data, err := json.MarshalIndent(s, "", " ")
+	if err != nil {
+		return err
+	}
+	return writeSecretFile(keystorePath+"-secret", data)
+}
+
+// RemovePassphraseFile overwrites and removes plain passphrase file of a
+// keystore whose passphrase was migrated to another backend.
+func RemovePassphraseFile(keystorePath string) error {
+	location := keystorePath + "-pass"
+	stat, err := os.Stat(location)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(location, make([]byte, stat.Size()), 0600); err != nil {
+		return err
+	}
+	return os.Remove(location)
+}
+
+// removeSecret removes passphrase of keystore from backend it is kept in.
+func removeSecret(keystorePath string) error {
+	s, err := GetSecret(keystorePath)
+	if err != nil {
+		return err
+	}
+	switch s.Backend {
+	case SecretBackendSystemdCreds:
+		err = util.RemoveFileIfExists(keystorePath + "-pass.cred")
+	case SecretBackendKeyring:
+		if id, searchErr := exec.Command("keyctl", "search", "@u", "user", secretName(keystorePath)).Output(); searchErr == nil {
+			err = exec.Command("keyctl", "unlink", strings.TrimSpace(string(id)), "@u").Run()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := util.RemoveFileIfExists(runtimeSecretDir + "/" + filepath.Base(keystorePath) + "-pass"); err != nil {
+		return err
+	}
+	if err := util.RemoveFileIfExists(keystorePath + "-secret"); err != nil {
+		return err
+	}
+	return RemovePassphraseFile(keystorePath)
+}
+
+// CheckPassphraseFile tells if passphrase file can be read by anyone but
+// owner, who has to be the user programs using it run as if given.
+func CheckPassphraseFile(location string, owner *user.User) error {
+	stat, err := os.Stat(location)
+	if err != nil {
+		return err
+	}
+	if stat.Mode().Perm()&0077 != 0 {
+		return errors.New(location + " is accessible by group or others (mode " + stat.Mode().Perm().String() + ")")
+	}
+	if owner == nil {
+		return nil
+	}
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok && strconv.Itoa(int(sys.Uid)) != owner.Uid {
+		return errors.New(location + " is owned by uid " + strconv.Itoa(int(sys.Uid)) + " instead of " + owner.Username)
+	}
+	return nil
+}
+
+// Grant hands keystore and its passphrase file over to user programs using
+// them run as, leaving them readable by nobody else. Passphrase file not
+// unlocked yet is skipped.
+func Grant(keystorePath string, passPath string, owner *user.User) error {
+	for _, location := range []string{filepath.Dir(keystorePath), keystorePath, passPath} {
+		if err := util.ChownToUser(location, owner); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.New("Error while handing " + location + " to " + owner.Username + ": " + err.Error())
+		}
+	}
+	for _, location := range []string{keystorePath, passPath} {
+		if _, err := util.CheckTraversable(location, owner); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s Secret) read(keystorePath string) (string, error) {
+	var out []byte
+	var err error
+	switch s.Backend {
+	case SecretBackendFile:
+		return util.ReadStringFromFile(keystorePath + "-pass")
+	case SecretBackendSystemdCreds:
+		out, err = exec.Command("systemd-creds", "decrypt", "--name="+secretName(keystorePath), keystorePath+"-pass.cred", "-").Output()
+	case SecretBackendKeyring:
+		out, err = exec.Command("keyctl", "search", "@u", "user", secretName(keystorePath)).Output()
+		if err == nil {
+			out, err = exec.Command("keyctl", "pipe", strings.TrimSpace(string(out))).Output()
+		}
+	case SecretBackendCommand:
+		out, err = exec.Command("/bin/sh", "-c", s.Command).Output()
+	case SecretBackendEnv:
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", errors.New("Environment variable " + s.Env + " is not set")
+		}
+		return value, nil
+	default:
+		return "", errors.New("Unknown secret backend " + s.Backend)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func secretName(keystorePath string) string {
+	return "marlinctl-" + strings.ToLower(filepath.Base(keystorePath))
+}
+
+func runWithInput(input string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.New(err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// writeSecretFile writes data readable only by owner of file it replaces, or
+// user marlinctl runs programs as for new files. Directories created for it
+// can be entered but not listed by others, so that service users can reach
+// secrets handed to them.
+func writeSecretFile(location string, data []byte) error {
+	if util.IsDryRun() {
+		util.RecordPlanStep("write secret", location, "")
+		return nil
+	}
+	owner, err := util.GetUser()
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(owner.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(owner.Gid)
+	if err != nil {
+		return err
+	}
+	if stat, err := os.Stat(location); err == nil {
+		if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(sys.Uid), int(sys.Gid)
+		}
+	}
+	if !util.FileExists(filepath.Dir(location)) {
+		if err := os.MkdirAll(filepath.Dir(location), 0711); err != nil {
+			return err
+		}
+		if err := os.Chown(filepath.Dir(location), uid, gid); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile(location, data, 0600); err != nil {
+		return err
+	}
+	// ioutil.WriteFile keeps mode of existing files
+	if err := os.Chmod(location, 0600); err != nil {
+		return err
+	}
+	return os.Chown(location, uid, gid)
+}
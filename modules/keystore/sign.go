@@ -0,0 +1,68 @@
+/*
+Copyright © 2020 MARLIN TEAM <info@marlin.pro>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package keystore
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethKeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Sign signs message with account with given address, or default account, as
+// an EIP-191 personal message, the way personal_sign of ethereum nodes does.
+// Recovery id of signature is 27 or 28.
+func Sign(keystoreDir string, address string, message []byte) (Account, []byte, error) {
+	acc, err := FindAccount(keystoreDir, address)
+	if err != nil {
+		return Account{}, nil, err
+	}
+	passphrase, err := ReadPassphrase(acc.Path)
+	if err != nil {
+		return Account{}, nil, errors.New("cannot read keystore passphrase: " + err.Error())
+	}
+	kstore := ethKeystore.NewKeyStore(keystoreDir, ethKeystore.StandardScryptN, ethKeystore.StandardScryptP)
+	signature, err := kstore.SignHashWithPassphrase(accounts.Account{Address: common.HexToAddress(acc.Address)}, passphrase, accounts.TextHash(message))
+	if err != nil {
+		return Account{}, nil, errors.New("Error while signing message: " + err.Error())
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return acc, signature, nil
+}
+
+// Recover returns address of account which signed message as an EIP-191
+// personal message. Recovery id of signature may be either 0 or 1, or 27 or
+// 28.
+func Recover(message []byte, signature []byte) (string, error) {
+	if len(signature) != crypto.SignatureLength {
+		return "", errors.New("Signature has to be 65 bytes long")
+	}
+	sig := make([]byte, len(signature))
+	copy(sig, signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	if sig[crypto.RecoveryIDOffset] > 1 {
+		return "", errors.New("Invalid recovery id of signature")
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(message), sig)
+	if err != nil {
+		return "", errors.New("Error while recovering signer: " + err.Error())
+	}
+	return crypto.PubkeyToAddress(*pub).Hex(), nil
+}
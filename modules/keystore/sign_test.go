@@ -0,0 +1,68 @@
+package keystore
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSignRecover(t *testing.T) {
+	keystoreDir := filepath.Join(t.TempDir(), "keystore")
+	acc := importTestAccount(t, keystoreDir, "account passphrase")
+	message := []byte("marlin")
+
+	signer, signature, err := Sign(keystoreDir, "", message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Address != acc.Address {
+		t.Errorf("Sign used %s, expected default account %s", signer.Address, acc.Address)
+	}
+	if v := signature[crypto.RecoveryIDOffset]; v != 27 && v != 28 {
+		t.Errorf("Recovery id of signature = %d, expected 27 or 28", v)
+	}
+
+	// personal_sign signs keccak256 of EIP-191 prefixed message
+	key, err := crypto.HexToECDSA(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := crypto.Sign(accounts.TextHash(message), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected[crypto.RecoveryIDOffset] += 27
+	if !bytes.Equal(signature, expected) {
+		t.Errorf("Sign = %x, expected %x", signature, expected)
+	}
+
+	recovered, err := Recover(message, signature)
+	if err != nil || recovered != acc.Address {
+		t.Errorf("Recover = %s, %v, expected %s", recovered, err, acc.Address)
+	}
+	unadjusted := append([]byte(nil), signature...)
+	unadjusted[crypto.RecoveryIDOffset] -= 27
+	recovered, err = Recover(message, unadjusted)
+	if err != nil || recovered != acc.Address {
+		t.Errorf("Recover with recovery id 0 or 1 = %s, %v, expected %s", recovered, err, acc.Address)
+	}
+	if signature[crypto.RecoveryIDOffset] != expected[crypto.RecoveryIDOffset] {
+		t.Error("Recover modified signature it was given")
+	}
+
+	recovered, err = Recover([]byte("marlin!"), signature)
+	if err == nil && recovered == acc.Address {
+		t.Error("Signature verified for a different message")
+	}
+	if _, err := Recover(message, signature[:64]); err == nil {
+		t.Error("Recover accepted a 64 byte signature")
+	}
+	invalid := append([]byte(nil), signature...)
+	invalid[crypto.RecoveryIDOffset] = 29
+	if _, err := Recover(message, invalid); err == nil {
+		t.Error("Recover accepted recovery id 29")
+	}
+}
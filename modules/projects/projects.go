@@ -0,0 +1,255 @@
+package projects
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/marlinprotocol/ctl2/modules/runner"
+	"github.com/marlinprotocol/ctl2/modules/runner/beacon"
+	"github.com/marlinprotocol/ctl2/modules/runner/cp"
+	"github.com/marlinprotocol/ctl2/modules/runner/gateway_cosmos"
+	"github.com/marlinprotocol/ctl2/modules/runner/gateway_dot"
+	"github.com/marlinprotocol/ctl2/modules/runner/gateway_iris"
+	"github.com/marlinprotocol/ctl2/modules/runner/gateway_near"
+	"github.com/marlinprotocol/ctl2/modules/runner/gateway_polygonbor"
+	"github.com/marlinprotocol/ctl2/modules/runner/relay_cosmos"
+	"github.com/marlinprotocol/ctl2/modules/runner/relay_dot"
+	"github.com/marlinprotocol/ctl2/modules/runner/relay_eth"
+	"github.com/marlinprotocol/ctl2/modules/runner/relay_iris"
+	"github.com/marlinprotocol/ctl2/modules/runner/relay_polygon"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/types"
+	"github.com/spf13/viper"
+)
+
+type RunnerProvider func(runnerId string, version string, storage string, runnerData interface{}, skipRunnerData bool, skipChecksum bool, instanceId string) (runner.Runner, error)
+
+// RunnerProviders maps every project managed by marlinctl to its runners.
+var RunnerProviders = map[string]RunnerProvider{
+	"beacon":             beacon.GetRunnerInstance,
+	"cp":                 cp.GetRunnerInstance,
+	"gateway_cosmos":     gateway_cosmos.GetRunnerInstance,
+	"gateway_dot":        gateway_dot.GetRunnerInstance,
+	"gateway_iris":       gateway_iris.GetRunnerInstance,
+	"gateway_near":       gateway_near.GetRunnerInstance,
+	"gateway_polygonbor": gateway_polygonbor.GetRunnerInstance,
+	"relay_cosmos":       relay_cosmos.GetRunnerInstance,
+	"relay_dot":          relay_dot.GetRunnerInstance,
+	"relay_eth":          relay_eth.GetRunnerInstance,
+	"relay_iris":         relay_iris.GetRunnerInstance,
+	"relay_polygon":      relay_polygon.GetRunnerInstance,
+}
+
+// CommandPaths maps every project managed by marlinctl to its command.
+var CommandPaths = map[string]string{
+	"beacon":             "beacon",
+	"cp":                 "cp",
+	"gateway_cosmos":     "gateway cosmos",
+	"gateway_dot":        "gateway dot",
+	"gateway_iris":       "gateway iris",
+	"gateway_near":       "gateway near",
+	"gateway_polygonbor": "gateway polygon bor",
+	"relay_cosmos":       "relay cosmos",
+	"relay_dot":          "relay dot",
+	"relay_eth":          "relay eth",
+	"relay_iris":         "relay iris",
+	"relay_polygon":      "relay polygon",
+}
+
+var managedSupervisorConfRegex = regexp.MustCompile(`^(beacon|cp|geth|relayeth|(relay|gateway|bridge|mevproxy)_[a-z]+)_?[^/]*\.conf$`)
+
+// IsManagedSupervisorConf tells if a supervisor conf file was written by
+// marlinctl, which heads confs it renders with util.SupervisorConfMarker.
+func IsManagedSupervisorConf(location string) bool {
+	f, err := os.Open(location)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(util.SupervisorConfMarker))
+	_, err = io.ReadFull(f, head)
+	return err == nil && string(head) == util.SupervisorConfMarker
+}
+
+// IsRunnerNamedSupervisorConf tells if a supervisor conf file is named the
+// way runners of marlinctl name supervisor confs they write.
+func IsRunnerNamedSupervisorConf(location string) bool {
+	return managedSupervisorConfRegex.MatchString(filepath.Base(location))
+}
+
+// Instance is a resource spawned up by marlinctl as recorded in its resource
+// file.
+type Instance struct {
+	ProjectID    string
+	InstanceID   string
+	ResourceFile string
+	Project      types.Project
+	Resource     map[string]interface{}
+}
+
+// GetProjectIDs returns ids of projects which have a configuration on disk.
+func GetProjectIDs() []string {
+	var projectIDs []string
+	for projectID := range RunnerProviders {
+		if viper.IsSet(projectID) {
+			projectIDs = append(projectIDs, projectID)
+		}
+	}
+	sort.Strings(projectIDs)
+	return projectIDs
+}
+
+func GetProjectConfig(projectID string) (types.Project, error) {
+	var projectConfig types.Project
+	err := viper.UnmarshalKey(projectID, &projectConfig)
+	return projectConfig, err
+}
+
+func init() {
+	util.InstanceResourceFiles = GetResourceFiles
+}
+
+// GetResourceFiles returns resource files of every instance of every
+// configured project, looked up in storage of each project.
+func GetResourceFiles() ([]string, error) {
+	var resourceFiles []string
+	for _, projectID := range GetProjectIDs() {
+		projectConfig, err := GetProjectConfig(projectID)
+		if err != nil {
+			return nil, errors.New("Error while reading project config for " + projectID + ": " + err.Error())
+		}
+		files, err := filepath.Glob(projectConfig.Storage + "/common/project_" + projectID + "_instance*.resource")
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		resourceFiles = append(resourceFiles, files...)
+	}
+	return resourceFiles, nil
+}
+
+// GetInstances returns every instance of every configured project.
+func GetInstances() ([]Instance, error) {
+	var instances []Instance
+	for _, projectID := range GetProjectIDs() {
+		projectConfig, err := GetProjectConfig(projectID)
+		if err != nil {
+			return nil, errors.New("Error while reading project config for " + projectID + ": " + err.Error())
+		}
+		prefix := projectConfig.Storage + "/common/project_" + projectID + "_instance"
+		files, err := filepath.Glob(prefix + "*.resource")
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			instance := Instance{
+				ProjectID:    projectID,
+				InstanceID:   strings.TrimSuffix(strings.TrimPrefix(f, prefix), ".resource"),
+				ResourceFile: f,
+				Project:      projectConfig,
+			}
+			file, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, errors.New("Error while reading resource file " + f + ": " + err.Error())
+			}
+			err = json.Unmarshal(file, &instance.Resource)
+			if err != nil {
+				return nil, errors.New("Error while decoding resource file " + f + ": " + err.Error())
+			}
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+func (i Instance) GetString(key string) string {
+	v, _ := i.Resource[key].(string)
+	return v
+}
+
+// Programs returns supervisor programs of the instance.
+func (i Instance) Programs() []string {
+	var programs []string
+	for k, v := range i.Resource {
+		if prg, ok := v.(string); ok && prg != "" && strings.HasSuffix(k, "Program") {
+			programs = append(programs, prg)
+		}
+	}
+	sort.Strings(programs)
+	return programs
+}
+
+// Runner returns runner of the instance, without any runner data.
+func (i Instance) Runner() (runner.Runner, error) {
+	provider, ok := RunnerProviders[i.ProjectID]
+	if !ok {
+		return nil, errors.New("Unknown project: " + i.ProjectID)
+	}
+	return provider(i.GetString("Runner"), i.GetString("Version"), i.Project.Storage, struct{}{}, true, true, i.InstanceID)
+}
+
+// Executables maps registry names of executables run by the instance (as
+// used for keys of runner data in registry) to their location on disk.
+func (i Instance) Executables() map[string]string {
+	executables := make(map[string]string)
+	for k, v := range i.Resource {
+		location, ok := v.(string)
+		if !ok || !strings.HasSuffix(k, "Path") || !strings.HasPrefix(location, i.Project.Storage+"/") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimSuffix(k, "Path"), "Executable")
+		executables[strings.ToLower(name)] = location
+	}
+	return executables
+}
+
+// VerifyChecksums verifies executables of the instance against checksums
+// published in registry for the version instance runs. Executables which do
+// not have a published checksum are left out of the returned map.
+func (i Instance) VerifyChecksums(runnerData interface{}) map[string]error {
+	results := make(map[string]error)
+	runnerDataMap, ok := runnerData.(map[string]interface{})
+	if !ok {
+		return results
+	}
+	for name, location := range i.Executables() {
+		checksum, ok := runnerDataMap[name+"_checksum"].(string)
+		if !ok {
+			continue
+		}
+		results[name] = util.VerifyChecksum(location, checksum)
+	}
+	return results
+}
+
+// LogFiles maps names of log files of the instance, including ones rotated
+// out, to their location on disk.
+func (i Instance) LogFiles() (map[string]string, error) {
+	r, err := i.Runner()
+	if err != nil {
+		return nil, err
+	}
+	sources, err := r.LogSources()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, s := range sources {
+		matches, err := filepath.Glob(s.Path + "*")
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			files[filepath.Base(m)] = m
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,230 @@
+package reconcile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/registry"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+type Kind string
+
+// Kinds of drift, in order they are repaired.
+const (
+	MissingBinary   Kind = "missing binary"
+	ConfDrift       Kind = "conf drift"
+	OrphanedConf    Kind = "orphaned conf"
+	UnmanagedConf   Kind = "unmanaged conf"
+	UnknownProgram  Kind = "unknown program"
+	InvalidResource Kind = "invalid resource"
+)
+
+var repairOrder = map[Kind]int{MissingBinary: 0, ConfDrift: 1, OrphanedConf: 2, UnmanagedConf: 3, UnknownProgram: 4, InvalidResource: 5}
+
+// Drift is a difference between resource files of instances and what
+// supervisor is set up to run.
+type Drift struct {
+	Kind       Kind
+	ProjectID  string
+	InstanceID string
+	Target     string
+	Detail     string
+
+	instance projects.Instance
+	expected string
+	programs []string
+}
+
+// Detect finds orphaned supervisor confs, programs of resources unknown to
+// supervisor, confs whose content differs from what the resource renders to
+// and binaries of resources missing from disk. Confs no resource file refers
+// to are orphaned only if marlinctl wrote them, confs named like ones
+// marlinctl writes are reported as unmanaged otherwise.
+func Detect() ([]Drift, error) {
+	instances, err := projects.GetInstances()
+	if err != nil {
+		return nil, errors.New("Error while listing instances: " + err.Error())
+	}
+
+	var allPrograms []string
+	for _, instance := range instances {
+		allPrograms = append(allPrograms, instance.Programs()...)
+	}
+	infos, err := util.SupervisorProgramInfos(allPrograms)
+	if err != nil {
+		return nil, err
+	}
+	confs := util.SupervisorConfPrograms()
+	claimed := make(map[string]bool)
+
+	var drifts []Drift
+	for _, instance := range instances {
+		newDrift := func(kind Kind, target string, detail string) Drift {
+			return Drift{Kind: kind, ProjectID: instance.ProjectID, InstanceID: instance.InstanceID, Target: target, Detail: detail, instance: instance}
+		}
+
+		for _, prg := range instance.Programs() {
+			if conf, ok := confs[prg]; ok {
+				claimed[conf] = true
+			}
+			if _, ok := infos[prg]; !ok {
+				drifts = append(drifts, newDrift(UnknownProgram, prg, "supervisor does not know program"))
+			}
+		}
+
+		var names []string
+		executables := instance.Executables()
+		for name := range executables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, err := os.Stat(executables[name]); err != nil {
+				drifts = append(drifts, newDrift(MissingBinary, executables[name], name+" binary missing"))
+			}
+		}
+
+		rendered, err := renderConfs(instance)
+		if err != nil {
+			drifts = append(drifts, newDrift(InvalidResource, instance.ResourceFile, err.Error()))
+			continue
+		}
+		var locations []string
+		for location := range rendered {
+			locations = append(locations, location)
+			claimed[location] = true
+		}
+		sort.Strings(locations)
+		for _, location := range locations {
+			actual, err := ioutil.ReadFile(location)
+			var detail string
+			if os.IsNotExist(err) {
+				detail = "conf missing"
+			} else if err != nil {
+				detail = "conf unreadable: " + err.Error()
+			} else if string(actual) != rendered[location] && string(actual) != strings.TrimPrefix(rendered[location], util.SupervisorConfMarker) {
+				detail = "conf differs from resource file"
+			} else {
+				continue
+			}
+			drift := newDrift(ConfDrift, location, detail)
+			drift.expected = rendered[location]
+			drifts = append(drifts, drift)
+		}
+	}
+
+	orphaned := make(map[string][]string)
+	for prg, conf := range confs {
+		if !claimed[conf] && (projects.IsManagedSupervisorConf(conf) || projects.IsRunnerNamedSupervisorConf(conf)) {
+			orphaned[conf] = append(orphaned[conf], prg)
+		}
+	}
+	var orphanedConfs []string
+	for conf := range orphaned {
+		orphanedConfs = append(orphanedConfs, conf)
+	}
+	sort.Strings(orphanedConfs)
+	for _, conf := range orphanedConfs {
+		sort.Strings(orphaned[conf])
+		if projects.IsManagedSupervisorConf(conf) {
+			drifts = append(drifts, Drift{Kind: OrphanedConf, Target: conf, Detail: "no resource file refers to conf", programs: orphaned[conf]})
+		} else {
+			drifts = append(drifts, Drift{Kind: UnmanagedConf, Target: conf, Detail: "conf not written by marlinctl, adopt its programs or remove it", programs: orphaned[conf]})
+		}
+	}
+	return drifts, nil
+}
+
+// Repair repairs drifts: missing binaries are downloaded again, confs are
+// rendered again from resource files, orphaned confs are stopped and
+// removed, and supervisor is made to pick up changes. Unmanaged confs are
+// stopped and removed only if removeUnmanaged is set. Invalid resource files
+// are left for the user to fix.
+func Repair(drifts []Drift, removeUnmanaged bool) error {
+	sorted := append([]Drift{}, drifts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return repairOrder[sorted[i].Kind] < repairOrder[sorted[j].Kind]
+	})
+
+	var failed, skipped int
+	downloaded := make(map[string]bool)
+	for _, d := range sorted {
+		var err error
+		switch d.Kind {
+		case MissingBinary:
+			if downloaded[d.instance.ResourceFile] {
+				continue
+			}
+			downloaded[d.instance.ResourceFile] = true
+			err = downloadBinaries(d.instance)
+		case ConfDrift:
+			err = util.WriteFile(d.Target, []byte(d.expected), 0644)
+		case UnmanagedConf:
+			if !removeUnmanaged {
+				log.Warning("Leaving ", d.Kind, " ", d.Target, " in place")
+				skipped++
+				continue
+			}
+			fallthrough
+		case OrphanedConf:
+			if errs := util.SupervisorStop(d.programs); len(errs) != 0 {
+				log.Warning("Programs of ", d.Target, " may not have stopped: ", errs)
+			}
+			err = util.RemoveFileIfExists(d.Target)
+		case UnknownProgram:
+			// picked up by supervisor once confs are in place
+			continue
+		default:
+			err = errors.New("cannot be repaired automatically, inspect " + d.Target)
+		}
+		if err != nil {
+			log.Error("Error while repairing ", d.Kind, " ", d.Target, ": ", err)
+			failed++
+		} else {
+			log.Info("Repaired ", d.Kind, " ", d.Target)
+		}
+	}
+
+	err := util.SupervisorRereadUpdate()
+	if err != nil {
+		return err
+	}
+	if failed != 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(sorted)) + " drifts could not be repaired")
+	}
+	if skipped != 0 {
+		return errors.New(strconv.Itoa(skipped) + " unmanaged confs left in place, use --remove-unmanaged to remove them")
+	}
+	return nil
+}
+
+func renderConfs(instance projects.Instance) (map[string]string, error) {
+	r, err := instance.Runner()
+	if err != nil {
+		return nil, err
+	}
+	return r.SupervisorConfs()
+}
+
+func downloadBinaries(instance projects.Instance) error {
+	provider, ok := projects.RunnerProviders[instance.ProjectID]
+	if !ok {
+		return errors.New("Unknown project: " + instance.ProjectID)
+	}
+	projectVersion, err := registry.GlobalRegistry.GetVersionToRun(instance.ProjectID, "", instance.GetString("Version"))
+	if err != nil {
+		return errors.New("Error while fetching version " + instance.GetString("Version") + " from registry: " + err.Error())
+	}
+	r, err := provider(instance.GetString("Runner"), projectVersion.Version, instance.Project.Storage, projectVersion.RunnerData, false, false, instance.InstanceID)
+	if err != nil {
+		return err
+	}
+	return r.Prepare()
+}
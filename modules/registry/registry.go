@@ -109,8 +109,7 @@ func (c *RegistryConfig) Sync() error {
 				log.Warning("Registry ", work.Registry, " completed with error ", work.Error)
 			}
 		} else {
-			log.Error("Registry ", work.Registry, " failed due to error: ", work.Error, ". Aborting application.")
-			os.Exit(1)
+			return errors.New("Registry " + work.Registry.Name + " failed due to error: " + work.Error.Error())
 		}
 	}
 	elapsed := time.Since(start)
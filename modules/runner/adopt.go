@@ -0,0 +1,280 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+)
+
+var (
+	supervisorSectionRegex = regexp.MustCompile(`^\[program:([^\]]+)\]$`)
+	adoptSentinelRegex     = regexp.MustCompile(`@@(\w+)@@`)
+)
+
+// ParseSupervisorSections returns key value pairs of every [program:x]
+// section of supervisor conf text, keyed by program.
+func ParseSupervisorSections(text string) map[string]map[string]string {
+	sections := make(map[string]map[string]string)
+	var current map[string]string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			current = nil
+			if m := supervisorSectionRegex.FindStringSubmatch(line); m != nil {
+				current = map[string]string{}
+				sections[m[1]] = current
+			}
+			continue
+		}
+		if kv := strings.SplitN(line, "=", 2); current != nil && len(kv) == 2 {
+			current[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return sections
+}
+
+// AdoptSupervisorPrograms fills resource pointed to by resData from supervisor
+// program sections of programs set up outside of marlinctl. Every section is
+// matched against the conf template of runner it fits best, and values are
+// mapped back into resource fields the template renders them from, including
+// flags and arguments of command. Returns settings and flags of sections which
+// could not be mapped to any resource field.
+func AdoptSupervisorPrograms(confs []SupervisorConf, resData interface{}, sections map[string]map[string]string) ([]string, error) {
+	ref := reflect.ValueOf(resData).Elem()
+	sentinels := reflect.New(ref.Type())
+	for i := 0; i < ref.NumField(); i++ {
+		// Limits wrap commands only when set, programs set up outside of
+		// marlinctl are adopted without them.
+		if util.IsLimitField(ref.Type().Field(i).Name) {
+			continue
+		}
+		if sentinels.Elem().Field(i).Kind() == reflect.String {
+			sentinels.Elem().Field(i).SetString("@@" + ref.Type().Field(i).Name + "@@")
+		}
+	}
+
+	var templateSections []map[string]string
+	for _, conf := range confs {
+		var rendered strings.Builder
+		if err := conf.Template.Execute(&rendered, sentinels.Interface()); err != nil {
+			return nil, errors.New("Error while rendering " + conf.Template.Name() + ": " + err.Error())
+		}
+		for program, section := range ParseSupervisorSections(rendered.String()) {
+			section["[program]"] = program
+			templateSections = append(templateSections, section)
+		}
+	}
+
+	var programs []string
+	for program := range sections {
+		programs = append(programs, program)
+	}
+	sort.Strings(programs)
+
+	values := make(map[string]string)
+	var unmapped []string
+	used := make(map[int]bool)
+	for _, program := range programs {
+		section := map[string]string{"[program]": program}
+		for k, v := range sections[program] {
+			section[k] = v
+		}
+		best, bestValues, bestUnmapped := -1, map[string]string{}, []string{}
+		for i, templateSection := range templateSections {
+			if used[i] {
+				continue
+			}
+			v, u := matchSupervisorSection(templateSection, section)
+			if best == -1 || len(v)-len(u) > len(bestValues)-len(bestUnmapped) {
+				best, bestValues, bestUnmapped = i, v, u
+			}
+		}
+		if best == -1 {
+			return nil, errors.New("More programs given than runner runs, cannot adopt " + program)
+		}
+		used[best] = true
+		for field, value := range bestValues {
+			if existing, ok := values[field]; ok && existing != value {
+				return nil, errors.New("Programs disagree on " + field + ": " + existing + " and " + value)
+			}
+			values[field] = value
+		}
+		for _, u := range bestUnmapped {
+			unmapped = append(unmapped, program+": "+u)
+		}
+	}
+	if len(used) != len(templateSections) {
+		return nil, errors.New("Runner runs " + strconv.Itoa(len(templateSections)) + " programs, all of them have to be adopted together")
+	}
+
+	for field, value := range values {
+		if f := ref.FieldByName(field); f.CanSet() && f.Kind() == reflect.String {
+			f.SetString(value)
+		}
+	}
+	return unmapped, nil
+}
+
+// matchSupervisorSection maps values of section to resource fields using a
+// section rendered with sentinels in place of resource fields.
+func matchSupervisorSection(templateSection map[string]string, section map[string]string) (map[string]string, []string) {
+	values := make(map[string]string)
+	var unmapped []string
+	var keys []string
+	for k := range section {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		pattern, ok := templateSection[k]
+		if !ok {
+			unmapped = append(unmapped, k)
+			continue
+		}
+		if k == "command" {
+			unmapped = append(unmapped, matchCommand(pattern, section[k], values)...)
+			continue
+		}
+		if !matchValue(pattern, section[k], values) {
+			unmapped = append(unmapped, k)
+		}
+	}
+	return values, unmapped
+}
+
+// matchValue matches value against pattern holding sentinels and records
+// values of sentinels. Sentinels of fields already known have to match their
+// known values.
+func matchValue(pattern string, value string, values map[string]string) bool {
+	fields := adoptSentinelRegex.FindAllStringSubmatch(pattern, -1)
+	literals := adoptSentinelRegex.Split(pattern, -1)
+	var captured []string
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i, literal := range literals {
+		expr.WriteString(regexp.QuoteMeta(literal))
+		if i >= len(fields) {
+			continue
+		}
+		if known, ok := values[fields[i][1]]; ok {
+			expr.WriteString(regexp.QuoteMeta(known))
+		} else {
+			expr.WriteString("(.*?)")
+			captured = append(captured, fields[i][1])
+		}
+	}
+	expr.WriteString("$")
+	m := regexp.MustCompile(expr.String()).FindStringSubmatch(value)
+	if m == nil {
+		return false
+	}
+	for i, field := range captured {
+		values[field] = m[i+1]
+	}
+	return true
+}
+
+// matchCommand maps arguments and flags of command back into fields using
+// command rendered with sentinels. Flags are matched by name so that their
+// order and presence may differ from template.
+func matchCommand(pattern string, command string, values map[string]string) []string {
+	patternArgs := SplitCommand(pattern)
+	args := SplitCommand(command)
+
+	var positional []string
+	flags := make(map[string]string)
+	for i := 0; i < len(patternArgs); i++ {
+		a := patternArgs[i]
+		if !strings.HasPrefix(a, "-") {
+			positional = append(positional, a)
+			continue
+		}
+		if kv := strings.SplitN(a, "=", 2); len(kv) == 2 {
+			flags[kv[0]+"="] = kv[1]
+		} else if i+1 < len(patternArgs) && !strings.HasPrefix(patternArgs[i+1], "-") {
+			flags[a] = patternArgs[i+1]
+			i++
+		} else {
+			flags[a] = ""
+		}
+	}
+
+	var unmapped []string
+	var argPosition int
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") {
+			if argPosition < len(positional) && matchValue(positional[argPosition], a, values) {
+				argPosition++
+			} else {
+				unmapped = append(unmapped, a)
+			}
+			continue
+		}
+		if kv := strings.SplitN(a, "=", 2); len(kv) == 2 {
+			if p, ok := flags[kv[0]+"="]; ok && matchValue(p, kv[1], values) {
+				continue
+			}
+			if p, ok := flags[kv[0]]; ok && matchValue(p, kv[1], values) {
+				continue
+			}
+			unmapped = append(unmapped, a)
+			continue
+		}
+		p, ok := flags[a]
+		if ok && p == "" {
+			continue
+		}
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			if ok && matchValue(p, args[i], values) {
+				continue
+			}
+			unmapped = append(unmapped, a+" "+args[i])
+			continue
+		}
+		unmapped = append(unmapped, a)
+	}
+	return unmapped
+}
+
+// SplitCommand splits a command line into arguments the way supervisor does,
+// honouring single and double quotes.
+func SplitCommand(command string) []string {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	for _, c := range command {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
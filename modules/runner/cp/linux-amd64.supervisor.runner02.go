@@ -6,16 +6,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"reflect"
-	"regexp"
 	"strings"
-	"sync"
 	"text/template"
 	"time"
 
-	"github.com/hpcloud/tail"
+	"github.com/marlinprotocol/ctl2/modules/runner"
 	"github.com/marlinprotocol/ctl2/modules/util"
 	"github.com/marlinprotocol/ctl2/types"
 	log "github.com/sirupsen/logrus"
@@ -38,17 +34,19 @@ type linux_amd64_supervisor_runner02 struct {
 type runner02resource struct {
 	Runner, Version, StartTime string
 	CpProgram, CpUser, CpRunDir, CpPath, AwsProfile, KeyName, Rpc, Regions, InstanceRates, BandwidthRates, Provider, Contract, ImageBlacklist, ImageWhitelist, AddressBlacklist, AddressWhitelist string
+	LogDir, LogMaxBytes, LogBackups, LogCompress string
+	MemoryLimit, CPUQuota, NofileLimit, Nice, IONice, Environment, SecretEnvFile string
 }
 
 const (
 	runner02cpName               = "control-plane"
 	runner02cpProgramName        = "cp"
-	runner02defaultUser              = "root"
 	runner02supervisorConfFiles      = "/etc/supervisor/conf.d"
 	runner02cpSupervisorConfFile = "cp"
 	runner02logRootDir               = "/var/log/supervisor"
 	runner02oldLogRootDir            = "/var/log/old_logs"
 	runner02projectName              = "control-plane"
+	runner02projectID                = "cp"
 )
 
 func (r *linux_amd64_supervisor_runner02) PreRunSanity() error {
@@ -70,24 +68,7 @@ func (r *linux_amd64_supervisor_runner02) Download() error {
 
 	var cpLocation = dirPath + "/" + runner02cpName
 
-	if _, err := os.Stat(cpLocation); os.IsNotExist(err) {
-		log.Info("Fetching control-plane from upstream for version ", r.Version)
-		util.DownloadFile(cpLocation, r.RunnerData.Cp)
-	}
-	if !r.SkipChecksum {
-		err := util.VerifyChecksum(cpLocation, r.RunnerData.CpChecksum)
-		if err != nil {
-			return errors.New("Error while verifying cp checksum: " + err.Error())
-		} else {
-			log.Debug("Successully verified cp's integrity")
-		}
-	}
-
-	err = os.Chmod(cpLocation, 0755)
-	if err != nil {
-		return err
-	}
-	return nil
+	return util.DownloadExecutable("control-plane", r.Version, r.RunnerData.Cp, r.SkipChecksum, r.RunnerData.CpChecksum, cpLocation)
 }
 
 func (r *linux_amd64_supervisor_runner02) Prepare() error {
@@ -103,18 +84,20 @@ func (r *linux_amd64_supervisor_runner02) Prepare() error {
 }
 
 func (r *linux_amd64_supervisor_runner02) Create(runtimeArgs map[string]string) error {
-	if _, err := os.Stat(GetResourceFileLocation(r.Storage, r.InstanceId)); err == nil {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
 		return errors.New("Resource file already exisits, cannot create a new instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
 	}
-	currentUser, err := util.GetUser()
+	serviceUser, err := util.GetServiceUser(runner02projectID)
 	if err != nil {
 		return err
 	}
 
 	substitutions := runner02resource {
 		"linux-amd64.supervisor.runner02", r.Version, time.Now().Format(time.RFC822Z),
-		runner02cpProgramName + "_" + r.InstanceId, currentUser.Username, currentUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner02cpName,
+		runner02cpProgramName + "_" + r.InstanceId, serviceUser.Username, serviceUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner02cpName,
 		"default", "marlin", "", "ap-south-1", "", "", "", "", "", "", "", "",
+		runner02logRootDir, util.DefaultLogMaxBytes, util.DefaultLogBackups, "false",
+		"", "", "", "", "", "", "",
 	}
 
 	for k, v := range runtimeArgs {
@@ -124,74 +107,44 @@ func (r *linux_amd64_supervisor_runner02) Create(runtimeArgs map[string]string)
 		}
 	}
 
-	log.Info("Running configuration")
-	util.PrettyPrintKVStruct(substitutions)
-
-	gt := template.Must(template.New("cp-template").Parse(util.TrimSpacesEveryLine(`
-		[program:{{.CpProgram}}]
-		process_name={{.CpProgram}}
-		user={{.CpUser}}
-		directory={{.CpRunDir}}
-		command={{.CpExecutablePath}} --profile {{.AwsProfile}} --key-name {{.KeyName}} --rpc {{.Rpc}} --regions {{.Regions}} --rates {{.InstanceRates}} --bandwidth {{.BandwidthRates}} --contract {{.Contract}} --Provider {{.Provider}} --whitelist {{.ImageWhitelist}} --blacklist {{.ImageBlacklist}} --address-blacklist {{.AddressBlacklist}} --address-whitelist {{.AddressWhitelist}}
-		priority=100
-		numprocs=1
-		numprocs_start=1
-		autostart=true
-		autorestart=true
-		stdout_logfile=/var/log/supervisor/{{.CpProgram}}-stdout.log
-		stderr_logfile=/var/log/supervisor/{{.CpProgram}}-stderr.log
-	`)))
-	gFile, err := os.Create(runner02supervisorConfFiles + "/" + runner02cpSupervisorConfFile + r.InstanceId + ".conf")
+	err = util.ApplyLimits(&substitutions, serviceUser)
 	if err != nil {
 		return err
 	}
-	defer gFile.Close()
-	if err := gt.Execute(gFile, substitutions); err != nil {
-		panic(err)
-	}
-
-	_, err = exec.Command("supervisorctl", "reread").Output()
-	if err != nil {
-		return errors.New("Error while supervisorctl reread: " + err.Error())
-	}
 
-	_, err = exec.Command("supervisorctl", "update").Output()
+	tx := &runner.Transaction{}
+	err = tx.Preserve(util.LogRotateConfLocation(runner02projectName + "_" + r.InstanceId))
 	if err != nil {
-		return errors.New("Error while supervisorctl update: " + err.Error())
+		return err
 	}
-
-	_, err = exec.Command("supervisorctl", "start", substitutions.CpProgram).Output()
+	err = util.ApplyLogConfig(runner02projectName+"_"+r.InstanceId, []string{substitutions.CpProgram}, &substitutions)
 	if err != nil {
-		return errors.New("Error while starting proxy: " + err.Error())
+		return tx.Rollback(err)
 	}
-	log.Debug("Trigerred proxy run")
 
-	log.Info("Waiting 2 seconds to poll for status")
-	time.Sleep(2 * time.Second)
+	log.Info("Running configuration")
+	util.PrettyPrintKVStruct(substitutions)
 
-	status, err := exec.Command("supervisorctl", "status").Output()
-	if err != nil {
-		log.Warning("Error while reading supervisor status: " + err.Error())
+	for _, conf := range r.supervisorConfs() {
+		err = tx.WriteSupervisorConf(conf, substitutions)
+		if err != nil {
+			return tx.Rollback(err)
+		}
 	}
-	var supervisorStatus = make(map[string]interface{})
 
-	statusLines := strings.Split(string(status), "\n")
-	var anyStatusLine = false
-	for _, v := range statusLines {
-		if match, err := regexp.MatchString(substitutions.CpProgram, v); err == nil && match {
-			vSplit := strings.Split(v, " ")
-			supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-			anyStatusLine = true
-		}
+	err = tx.SupervisorStart([]string{substitutions.CpProgram})
+	if err != nil {
+		return tx.Rollback(err)
 	}
-	if !anyStatusLine {
-		log.Info("No proceses seem to be running")
-	} else {
-		log.Info("Process status")
-		util.PrettyPrintKVMap(supervisorStatus)
+	util.SupervisorStatusBestEffort([]string{substitutions.CpProgram})
+	err = tx.Do("write resource file", func() error {
+		return r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
+	}, func() error {
+		return util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
+	})
+	if err != nil {
+		return tx.Rollback(err)
 	}
-	r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
-
 	return nil
 }
 
@@ -204,13 +157,7 @@ func (r *linux_amd64_supervisor_runner02) Restart() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
 
-	_, err1 := exec.Command("supervisorctl", "restart", resData.CpProgram).Output()
-
-	if err1 == nil {
-		log.Info("Triggered restart")
-	} else {
-		log.Warning("Triggered restart, however supervisor did return some errors. ", err1.Error())
-	}
+	util.SupervisorRestartProgramBestEffort("cp", resData.CpProgram)
 
 	return nil
 }
@@ -223,16 +170,6 @@ func (r *linux_amd64_supervisor_runner02) Recreate() error {
 	if !available {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
-	err = r.Destroy()
-	if err != nil {
-		return err
-	}
-
-	err = r.PostRun()
-	if err != nil {
-		return err
-	}
-
 	err = r.Prepare()
 	if err != nil {
 		return err
@@ -249,11 +186,9 @@ func (r *linux_amd64_supervisor_runner02) Recreate() error {
 		}
 	}
 
-	err = r.Create(runtimeArgs)
-	if err != nil {
-		return err
-	}
-	return nil
+	return runner.Replace(r, func() error {
+		return r.Create(runtimeArgs)
+	})
 }
 
 func (r *linux_amd64_supervisor_runner02) Destroy() error {
@@ -265,14 +200,10 @@ func (r *linux_amd64_supervisor_runner02) Destroy() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't destroy")
 	}
 
-	_, err = exec.Command("supervisorctl", "stop", resData.CpProgram).Output()
-	if err != nil {
-		return errors.New("Error while stopping cp: " + err.Error())
+	errs := util.SupervisorStop([]string{resData.CpProgram})
+	if len(errs) != 0 {
+		return errors.New(fmt.Sprintf("Error while stopping programs %v", errs))
 	}
-	log.Debug("Trigerred beacon stop")
-
-	log.Info("Waiting 5 seconds for SIGTERM to take effect")
-	time.Sleep(5 * time.Second)
 
 	return nil
 }
@@ -280,23 +211,20 @@ func (r *linux_amd64_supervisor_runner02) Destroy() error {
 func (r *linux_amd64_supervisor_runner02) PostRun() error {
 	var proxyConfig = runner02supervisorConfFiles + "/" + runner02cpSupervisorConfFile + r.InstanceId + ".conf"
 
-	if _, err := os.Stat(proxyConfig); !os.IsNotExist(err) {
-		if err := os.Remove(proxyConfig); err != nil {
-			return err
-		}
+	if err := util.RemoveFileIfExists(proxyConfig); err != nil {
+		return err
 	}
 
-	_, err := exec.Command("supervisorctl", "reread").Output()
-	if err != nil {
-		return errors.New("Error while supervisorctl reread: " + err.Error())
+	if err := util.RemoveLogRotateConf(runner02projectName + "_" + r.InstanceId); err != nil {
+		return err
 	}
 
-	_, err = exec.Command("supervisorctl", "update").Output()
+	err := util.SupervisorRereadUpdate()
 	if err != nil {
-		return errors.New("Error while supervisorctl update: " + err.Error())
+		return err
 	}
 
-	err = os.Remove(GetResourceFileLocation(r.Storage, r.InstanceId))
+	err = util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
 		return errors.New("Error while removing resource file: " + err.Error())
 	}
@@ -325,75 +253,88 @@ func (r *linux_amd64_supervisor_runner02) Status() error {
 	log.Info("Resource information")
 	util.PrettyPrintKVStruct(resData)
 
-	status, err := exec.Command("supervisorctl", "status").Output()
+	util.SupervisorStatusBestEffort([]string{resData.CpProgram})
+
+	return nil
+}
+
+func (r *linux_amd64_supervisor_runner02) Health(options runner.HealthOptions) (runner.HealthReport, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return errors.New("Error while reading supervisor status: " + err.Error())
+		return runner.HealthReport{}, err
+	}
+	if !available {
+		return runner.HealthReport{}, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return health.")
 	}
 
-	var supervisorStatus = make(map[string]interface{})
+	return runner.GetHealth([]string{resData.CpProgram}, resData, options), nil
+}
 
-	statusLines := strings.Split(string(status), "\n")
-	var anyStatusLine = false
-	for _, v := range statusLines {
-		if match, err := regexp.MatchString(runner02cpProgramName+"_"+r.InstanceId, v); err == nil && match {
-			vSplit := strings.Split(v, " ")
-			supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-			anyStatusLine = true
-		}
+func (r *linux_amd64_supervisor_runner02) LogSources() ([]runner.LogSource, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+	if err != nil {
+		return nil, err
 	}
-	if !anyStatusLine {
-		log.Info("No proceses seem to be running")
-	} else {
-		log.Info("Process status")
-		util.PrettyPrintKVMap(supervisorStatus)
+	if !available {
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
 	}
 
-	return nil
+	return runner.GetLogSources(util.LogDirOrDefault(resData.LogDir), map[string]string{"cp": resData.CpProgram}), nil
 }
 
-func (r *linux_amd64_supervisor_runner02) Logs(lines int) error {
+func (r *linux_amd64_supervisor_runner02) SupervisorConfs() (map[string]string, error) {
 	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !available {
-		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
-	}
-	// Check for resource
-	fileSubscriptions := make(map[string]string)
-	err = filepath.Walk(runner02logRootDir, func(path string, f os.FileInfo, _ error) error {
-		if !f.IsDir() {
-			for _, v := range []string{resData.CpProgram + "-stdout.*",
-				resData.CpProgram + "-stderr.*"} {
-				r, err := regexp.MatchString(v, f.Name())
-				if err == nil && r {
-					fileSubscriptions[v[:len(v)-2]] = runner02logRootDir + "/" + f.Name()
-				}
-			}
-		}
-		return nil
-	})
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't render supervisor confs.")
+	}
+
+	return runner.RenderSupervisorConfs(r.supervisorConfs(), &resData)
+}
+
+func (r *linux_amd64_supervisor_runner02) Adopt(sections map[string]map[string]string) ([]string, error) {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
+		return nil, errors.New("Resource file already exisits, cannot adopt into instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
+	}
+
+	resData := runner02resource{Runner: "linux-amd64.supervisor.runner02", Version: r.Version, StartTime: time.Now().Format(time.RFC822Z)}
+	unmapped, err := runner.AdoptSupervisorPrograms(r.supervisorConfs(), &resData, sections)
 	if err != nil {
-		return nil
-	}
-
-	var wg sync.WaitGroup
-	for k, v := range fileSubscriptions {
-		wg.Add(1)
-		go func(filename string, filelocation string) {
-			seeklocation := util.GetFileSeekOffsetLastNLines(filelocation, lines)
-			t, err := tail.TailFile(filelocation, tail.Config{Location: &tail.SeekInfo{Offset: seeklocation}, Follow: true, Logger: tail.DiscardingLogger})
-			if err != nil {
-				fmt.Println(err)
-			}
-			for line := range t.Lines {
-				log.Info(fmt.Sprintf("[%20s] ", filename) + line.Text)
-			}
-			wg.Done()
-		}(k, v)
-	}
-	wg.Wait()
-	return nil
+		return nil, err
+	}
+	util.FillLogConfigDefaults(&resData)
+
+	return unmapped, r.writeResourceToFile(resData, GetResourceFileLocation(r.Storage, r.InstanceId))
+}
+
+func (r *linux_amd64_supervisor_runner02) ManagedFiles() []string {
+	files := []string{GetResourceFileLocation(r.Storage, r.InstanceId), util.LogRotateConfLocation(runner02projectName + "_" + r.InstanceId)}
+	for _, conf := range r.supervisorConfs() {
+		files = append(files, conf.Location)
+	}
+	return files
+}
+
+func (r *linux_amd64_supervisor_runner02) supervisorConfs() []runner.SupervisorConf {
+	gt := template.Must(template.New("cp-template").Parse(util.TrimSpacesEveryLine(`
+		[program:{{.CpProgram}}]
+		process_name={{.CpProgram}}
+		user=` + util.SupervisorUser("CpUser") + `
+		directory={{.CpRunDir}}
+		command=` + util.SupervisorCommandPrefix("CpUser") + `{{.CpPath}} --profile {{.AwsProfile}} --key-name {{.KeyName}} --rpc {{.Rpc}} --regions {{.Regions}} --rates {{.InstanceRates}} --bandwidth {{.BandwidthRates}} --contract {{.Contract}} --Provider {{.Provider}} --whitelist {{.ImageWhitelist}} --blacklist {{.ImageBlacklist}} --address-blacklist {{.AddressBlacklist}} --address-whitelist {{.AddressWhitelist}}` + util.SupervisorEnvironmentTemplate + `
+		priority=100
+		numprocs=1
+		numprocs_start=1
+		autostart=true
+		autorestart=true
+		` + util.SupervisorLogTemplate("CpProgram") + `
+	`)))
+
+	return []runner.SupervisorConf{
+		{Location: runner02supervisorConfFiles + "/" + runner02cpSupervisorConfFile + r.InstanceId + ".conf", Template: gt},
+	}
 }
 
 func (r *linux_amd64_supervisor_runner02) fetchResourceInformation(fileLocation string) (bool, runner02resource, error) {
@@ -428,6 +369,6 @@ func (r *linux_amd64_supervisor_runner02) writeResourceToFile(resData runner02re
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(fileLocation, fileData, 0644)
+	return util.WriteFile(fileLocation, fileData, 0644)
 }
 
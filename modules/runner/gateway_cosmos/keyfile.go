@@ -0,0 +1,8 @@
+package gateway_cosmos
+
+const (
+	// KeyfileChain is chain keyfiles of gateway (cosmos) instances are generated for
+	KeyfileChain = "cosmos"
+	// KeyfileGenerator is gateway executable keyfiles are generated with
+	KeyfileGenerator = runner02gatewayName
+)
@@ -6,16 +6,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"reflect"
-	"regexp"
 	"strings"
-	"sync"
 	"text/template"
 	"time"
 
-	"github.com/hpcloud/tail"
+	"github.com/marlinprotocol/ctl2/modules/runner"
 	"github.com/marlinprotocol/ctl2/modules/util"
 	"github.com/marlinprotocol/ctl2/types"
 	log "github.com/sirupsen/logrus"
@@ -42,7 +38,6 @@ const (
 	runner02bridgeName                = "bridge_cosmos_linux-amd64"
 	runner02gatewayProgramName        = "gateway_cosmos"
 	runner02bridgeProgramName         = "bridge_cosmos"
-	runner02defaultUser               = "root"
 	runner02supervisorConfFiles       = "/etc/supervisor/conf.d"
 	runner02gatewaySupervisorConfFile = "gateway_cosmos"
 	runner02bridgeSupervisorConfFile  = "bridge_cosmos"
@@ -71,39 +66,15 @@ func (r *linux_amd64_supervisor_runner02) Download() error {
 	var gatewayLocation = dirPath + "/" + runner02gatewayName
 	var bridgeLocation = dirPath + "/" + runner02bridgeName
 
-	if _, err := os.Stat(gatewayLocation); os.IsNotExist(err) {
-		log.Info("Fetching gateway from upstream for version ", r.Version)
-		util.DownloadFile(gatewayLocation, r.RunnerData.Gateway)
-	}
-	if !r.SkipChecksum {
-		err := util.VerifyChecksum(gatewayLocation, r.RunnerData.GatewayChecksum)
-		if err != nil {
-			return errors.New("Error while verifying gateway checksum: " + err.Error())
-		} else {
-			log.Debug("Successully verified gateway's integrity")
-		}
-	}
-	if _, err := os.Stat(bridgeLocation); os.IsNotExist(err) {
-		log.Info("Fetching bridge from upstream for version ", r.Version)
-		util.DownloadFile(bridgeLocation, r.RunnerData.Bridge)
-	}
-	if !r.SkipChecksum {
-		err := util.VerifyChecksum(bridgeLocation, r.RunnerData.BridgeChecksum)
-		if err != nil {
-			return errors.New("Error while verifying bridge checksum: " + err.Error())
-		} else {
-			log.Debug("Successully verified bridge's integrity")
-		}
-	}
-
-	err = os.Chmod(gatewayLocation, 0755)
+	err = util.DownloadExecutable("gateway", r.Version, r.RunnerData.Gateway, r.SkipChecksum, r.RunnerData.GatewayChecksum, gatewayLocation)
 	if err != nil {
 		return err
 	}
-	err = os.Chmod(bridgeLocation, 0755)
+	err = util.DownloadExecutable("bridge", r.Version, r.RunnerData.Bridge, r.SkipChecksum, r.RunnerData.BridgeChecksum, bridgeLocation)
 	if err != nil {
 		return err
 	}
+
 	return nil
 }
 
@@ -118,30 +89,6 @@ func (r *linux_amd64_supervisor_runner02) Prepare() error {
 	if err != nil {
 		return err
 	}
-	var keyfileLocation = r.Storage + "/common/keyfile.json"
-	if _, err := os.Stat(keyfileLocation); os.IsNotExist(err) {
-		log.Debug("Creating a new keyfile since none found at " + keyfileLocation)
-		var gatewayLocation = r.Storage + "/" + r.Version + "/" + runner02gatewayName
-		keyFileGenCommand := exec.Command(gatewayLocation, "keyfile", "--chain=cosmos", "--generate", "--filelocation="+keyfileLocation)
-		_, err := keyFileGenCommand.Output()
-		if err != nil {
-			return errors.New("Keyfile generation error: " + err.Error())
-		}
-		log.Debug("New Keyfile generated.")
-	}
-	keyfile, err := os.Open(keyfileLocation)
-	if err != nil {
-		return err
-	}
-	defer keyfile.Close()
-	byteValue, _ := ioutil.ReadAll(keyfile)
-	var keyFileData = struct {
-		NodeId string `json:"IdString"`
-	}{}
-	json.Unmarshal(byteValue, &keyFileData)
-
-	log.Info("Keyfile information")
-	util.PrettyPrintKVStruct(keyFileData)
 
 	err = util.ChownRmarlinctlDir()
 	if err != nil {
@@ -152,19 +99,21 @@ func (r *linux_amd64_supervisor_runner02) Prepare() error {
 }
 
 func (r *linux_amd64_supervisor_runner02) Create(runtimeArgs map[string]string) error {
-	if _, err := os.Stat(GetResourceFileLocation(r.Storage, r.InstanceId)); err == nil {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
 		return errors.New("Resource file already exisits, cannot create a new instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
 	}
 
-	currentUser, err := util.GetUser()
+	serviceUser, err := util.GetServiceUser(runner02projectName)
 	if err != nil {
 		return err
 	}
 
 	substitutions := runner02resource{
 		"linux-amd64.supervisor.runner02", r.Version, time.Now().Format(time.RFC822Z),
-		runner02gatewayProgramName + "_" + r.InstanceId, currentUser.Username, "/", r.Storage + "/" + r.Version + "/" + runner02gatewayName, r.Storage + "/common/keyfile.json", "22400", "127.0.0.1", "22401", "producer",
-		runner02bridgeProgramName + "_" + r.InstanceId, currentUser.Username, "/", r.Storage + "/" + r.Version + "/" + runner02bridgeName, "", "", "", "", "", "", "",
+		runner02gatewayProgramName + "_" + r.InstanceId, serviceUser.Username, "/", r.Storage + "/" + r.Version + "/" + runner02gatewayName, runner.KeyfileLocation(r.Storage, runner02projectName, r.InstanceId), "22400", "127.0.0.1", "22401", "producer",
+		runner02bridgeProgramName + "_" + r.InstanceId, serviceUser.Username, "/", r.Storage + "/" + r.Version + "/" + runner02bridgeName, "", "", "", "", "", "", "",
+		runner02logRootDir, util.DefaultLogMaxBytes, util.DefaultLogBackups, "false",
+		"", "", "", "", "", "", "",
 	}
 
 	for k, v := range runtimeArgs {
@@ -181,104 +130,53 @@ func (r *linux_amd64_supervisor_runner02) Create(runtimeArgs map[string]string)
 	}
 	substitutions.GatewayPort = temp[1]
 
-	log.Info("Running configuration")
-	util.PrettyPrintKVStruct(substitutions)
-
-	gt := template.Must(template.New("gateway-template").Parse(util.TrimSpacesEveryLine(`
-		[program:{{.GatewayProgram}}]
-		process_name={{.GatewayProgram}}
-		user={{.GatewayUser}}
-		directory={{.GatewayRunDir}}
-		command={{.GatewayExecutablePath}} dataconnect --keyfile {{.GatewayKeyfile}} --listenportpeer {{.GatewayListenPortPeer}} --marlinip {{.GatewayMarlinIp}} --marlinport {{.GatewayPort}} --direction {{.GatewayDirection}}
-		priority=100
-		numprocs=1
-		numprocs_start=1
-		autostart=true
-		autorestart=true
-		stdout_logfile=/var/log/supervisor/{{.GatewayProgram}}-stdout.log
-		stderr_logfile=/var/log/supervisor/{{.GatewayProgram}}-stderr.log
-	`)))
-	gFile, err := os.Create(runner02supervisorConfFiles + "/" + runner02gatewaySupervisorConfFile + "_" + r.InstanceId + ".conf")
+	err = util.ApplyLimits(&substitutions, serviceUser)
 	if err != nil {
 		return err
 	}
-	defer gFile.Close()
-	if err := gt.Execute(gFile, substitutions); err != nil {
-		panic(err)
-	}
 
-	bt := template.Must(template.New("bridge-template").Parse(util.TrimSpacesEveryLine(`
-		[program:{{.BridgeProgram}}]
-		process_name={{.BridgeProgram}}
-		user={{.BridgeUser}}
-		directory={{.BridgeRunDir}}
-		command={{.BridgeExecutablePath}} --discovery-addr {{.DiscoveryAddr}} --pubsub-addr {{.PubsubAddr}} {{if .BridgeBootstrapAddr}} --beacon-addr {{.BridgeBootstrapAddr}}{{end}} --listen-addr {{.InternalListenAddr}} {{if .KeystorePath}} --keystore-path {{.KeystorePath}}{{end}} {{if .KeystorePassPath}} --keystore-pass-path {{.KeystorePassPath}} {{end}} --contracts {{.Contracts}}  
-		priority=100
-		numprocs=1
-		numprocs_start=1
-		autostart=true
-		autorestart=true
-		stdout_logfile=/var/log/supervisor/{{.BridgeProgram}}-stdout.log
-		stderr_logfile=/var/log/supervisor/{{.BridgeProgram}}-stderr.log
-	`)))
-	bFile, err := os.Create(runner02supervisorConfFiles + "/" + runner02bridgeSupervisorConfFile + "_" + r.InstanceId + ".conf")
+	tx := &runner.Transaction{}
+	err = tx.Preserve(util.LogRotateConfLocation(runner02projectName + "_" + r.InstanceId))
 	if err != nil {
 		return err
 	}
-	defer bFile.Close()
-	if err := bt.Execute(bFile, substitutions); err != nil {
-		panic(err)
+	err = runner.PrepareKeyfile(tx, substitutions.GatewayKeyfile, runner.KeyfileLocation(r.Storage, runner02projectName, r.InstanceId), KeyfileChain, substitutions.GatewayExecutablePath, serviceUser)
+	if err != nil {
+		return tx.Rollback(err)
 	}
-
-	_, err = exec.Command("supervisorctl", "reread").Output()
+	err = util.ApplyLogConfig(runner02projectName+"_"+r.InstanceId, []string{substitutions.GatewayProgram, substitutions.BridgeProgram}, &substitutions)
 	if err != nil {
-		return errors.New("Error while supervisorctl reread: " + err.Error())
+		return tx.Rollback(err)
 	}
 
-	_, err = exec.Command("supervisorctl", "update").Output()
+	log.Info("Running configuration")
+	util.PrettyPrintKVStruct(substitutions)
+
+	err = util.CheckListenAddresses(GetResourceFileLocation(r.Storage, r.InstanceId), substitutions)
 	if err != nil {
-		return errors.New("Error while supervisorctl update: " + err.Error())
+		return tx.Rollback(err)
 	}
 
-	_, err = exec.Command("supervisorctl", "start", substitutions.BridgeProgram).Output()
-	if err != nil {
-		return errors.New("Error while starting bridge: " + err.Error())
+	for _, conf := range r.supervisorConfs() {
+		err = tx.WriteSupervisorConf(conf, substitutions)
+		if err != nil {
+			return tx.Rollback(err)
+		}
 	}
-	log.Debug("Trigerred bridge run")
 
-	_, err = exec.Command("supervisorctl", "start", substitutions.GatewayProgram).Output()
+	err = tx.SupervisorStart([]string{substitutions.BridgeProgram, substitutions.GatewayProgram})
 	if err != nil {
-		return errors.New("Error while starting bridge: " + err.Error())
+		return tx.Rollback(err)
 	}
-	log.Debug("Trigerred gateway run")
-
-	log.Info("Waiting 10 seconds to poll for status")
-	time.Sleep(10 * time.Second)
-
-	status, err := exec.Command("supervisorctl", "status").Output()
+	util.SupervisorStatusBestEffort([]string{substitutions.GatewayProgram, substitutions.BridgeProgram})
+	err = tx.Do("write resource file", func() error {
+		return r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
+	}, func() error {
+		return util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
+	})
 	if err != nil {
-		log.Warning("Error while reading supervisor status: " + err.Error())
-	} else {
-		var supervisorStatus = make(map[string]interface{})
-
-		statusLines := strings.Split(string(status), "\n")
-		var anyStatusLine = false
-		for _, v := range statusLines {
-			if match, err := regexp.MatchString(runner02gatewayProgramName+"_"+r.InstanceId+"|"+runner02bridgeProgramName+"_"+r.InstanceId, v); err == nil && match {
-				vSplit := strings.Split(v, " ")
-				supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-				anyStatusLine = true
-			}
-		}
-		if !anyStatusLine {
-			log.Info("No proceses seem to be running")
-		} else {
-			log.Info("Process status")
-			util.PrettyPrintKVMap(supervisorStatus)
-		}
+		return tx.Rollback(err)
 	}
-	r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
-
 	return nil
 }
 
@@ -291,14 +189,8 @@ func (r *linux_amd64_supervisor_runner02) Restart() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
 
-	_, err1 := exec.Command("supervisorctl", "restart", resData.GatewayProgram).Output()
-	_, err2 := exec.Command("supervisorctl", "restart", resData.BridgeProgram).Output()
-
-	if err1 == nil && err2 == nil {
-		log.Info("Triggered restart")
-	} else {
-		log.Warning("Triggered restart, however supervisor did return some errors. ", err1.Error(), " ", err2.Error())
-	}
+	util.SupervisorRestartProgramBestEffort("gateway", resData.GatewayProgram)
+	util.SupervisorRestartProgramBestEffort("bridge", resData.BridgeProgram)
 
 	return nil
 }
@@ -311,16 +203,6 @@ func (r *linux_amd64_supervisor_runner02) Recreate() error {
 	if !available {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
-	err = r.Destroy()
-	if err != nil {
-		return err
-	}
-
-	err = r.PostRun()
-	if err != nil {
-		return err
-	}
-
 	err = r.Prepare()
 	if err != nil {
 		return err
@@ -337,11 +219,9 @@ func (r *linux_amd64_supervisor_runner02) Recreate() error {
 		}
 	}
 
-	err = r.Create(runtimeArgs)
-	if err != nil {
-		return err
-	}
-	return nil
+	return runner.Replace(r, func() error {
+		return r.Create(runtimeArgs)
+	})
 }
 
 func (r *linux_amd64_supervisor_runner02) Destroy() error {
@@ -353,26 +233,10 @@ func (r *linux_amd64_supervisor_runner02) Destroy() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't destroy")
 	}
 
-	returned, err := exec.Command("supervisorctl", "stop", resData.GatewayProgram).Output()
-	if err != nil {
-		alreadyDead, err2 := regexp.MatchString("not running", string(returned))
-		if !alreadyDead || err2 != nil {
-			return errors.New("Error while stopping gateway: " + err.Error())
-		}
-	}
-	log.Debug("Trigerred gateway stop")
-
-	returned, err = exec.Command("supervisorctl", "stop", resData.BridgeProgram).Output()
-	if err != nil {
-		alreadyDead, err2 := regexp.MatchString("not running", string(returned))
-		if !alreadyDead || err2 != nil {
-			return errors.New("Error while stopping bridge: " + err.Error())
-		}
+	errs := util.SupervisorStop([]string{resData.GatewayProgram, resData.BridgeProgram})
+	if len(errs) != 0 {
+		return errors.New(fmt.Sprintf("Error while stopping programs %v", errs))
 	}
-	log.Debug("Trigerred bridge stop")
-
-	log.Info("Waiting 5 seconds for SIGTERM to take effect")
-	time.Sleep(5 * time.Second)
 
 	return nil
 }
@@ -381,28 +245,23 @@ func (r *linux_amd64_supervisor_runner02) PostRun() error {
 	var gatewayConfig = runner02supervisorConfFiles + "/" + runner02gatewaySupervisorConfFile + "_" + r.InstanceId + ".conf"
 	var bridgeConfig = runner02supervisorConfFiles + "/" + runner02bridgeSupervisorConfFile + "_" + r.InstanceId + ".conf"
 
-	if _, err := os.Stat(gatewayConfig); !os.IsNotExist(err) {
-		if err := os.Remove(gatewayConfig); err != nil {
-			return err
-		}
+	if err := util.RemoveFileIfExists(gatewayConfig); err != nil {
+		return err
 	}
-	if _, err := os.Stat(bridgeConfig); !os.IsNotExist(err) {
-		if err := os.Remove(bridgeConfig); err != nil {
-			return err
-		}
+	if err := util.RemoveFileIfExists(bridgeConfig); err != nil {
+		return err
 	}
 
-	_, err := exec.Command("supervisorctl", "reread").Output()
-	if err != nil {
-		return errors.New("Error while supervisorctl reread: " + err.Error())
+	if err := util.RemoveLogRotateConf(runner02projectName + "_" + r.InstanceId); err != nil {
+		return err
 	}
 
-	_, err = exec.Command("supervisorctl", "update").Output()
+	err := util.SupervisorRereadUpdate()
 	if err != nil {
-		return errors.New("Error while supervisorctl update: " + err.Error())
+		return err
 	}
 
-	err = os.Remove(GetResourceFileLocation(r.Storage, r.InstanceId))
+	err = util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
 		return errors.New("Error while removing resource file: " + err.Error())
 	}
@@ -428,99 +287,121 @@ func (r *linux_amd64_supervisor_runner02) Status() error {
 	log.Info("Project configuration")
 	util.PrettyPrintKVStruct(projectConfig)
 
-	var keyfileLocation = r.Storage + "/common/keyfile.json"
-	keyfile, err := os.Open(keyfileLocation)
+	keyfile, err := runner.ReadKeyfile(resData.GatewayKeyfile)
 	if err != nil {
-		return err
+		log.Warning(err)
+	} else {
+		log.Info("Keyfile information")
+		util.PrettyPrintKVStruct(keyfile)
 	}
-	defer keyfile.Close()
-	byteValue, _ := ioutil.ReadAll(keyfile)
-	var keyFileData = struct {
-		NodeId string `json:"IdString"`
-	}{}
-	json.Unmarshal(byteValue, &keyFileData)
-
-	log.Info("Keyfile information")
-	util.PrettyPrintKVStruct(keyFileData)
 
 	log.Info("Resource information")
 	util.PrettyPrintKVStruct(resData)
 
-	status, _ := exec.Command("supervisorctl", "status").Output()
+	util.SupervisorStatusBestEffort([]string{resData.GatewayProgram, resData.BridgeProgram})
 
-	var supervisorStatus = make(map[string]interface{})
+	return nil
+}
 
-	statusLines := strings.Split(string(status), "\n")
-	var anyStatusLine = false
-	for _, v := range statusLines {
-		if match, err := regexp.MatchString(runner02gatewayProgramName+"_"+r.InstanceId+"|"+runner02bridgeProgramName+"_"+r.InstanceId, v); err == nil && match {
-			vSplit := strings.Split(v, " ")
-			supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-			anyStatusLine = true
-		}
+func (r *linux_amd64_supervisor_runner02) Health(options runner.HealthOptions) (runner.HealthReport, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+	if err != nil {
+		return runner.HealthReport{}, err
 	}
-	if !anyStatusLine {
-		log.Info("No proceses seem to be running")
-	} else {
-		log.Info("Process status")
-		util.PrettyPrintKVMap(supervisorStatus)
+	if !available {
+		return runner.HealthReport{}, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return health.")
 	}
 
-	return nil
+	return runner.GetHealth([]string{resData.GatewayProgram, resData.BridgeProgram}, resData, options), nil
 }
 
-func (r *linux_amd64_supervisor_runner02) Logs(lines int) error {
-	available, _, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+func (r *linux_amd64_supervisor_runner02) LogSources() ([]runner.LogSource, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !available {
-		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
-	}
-	// Check for resource
-	fileSubscriptions := make(map[string]string)
-	var runner02logRootDir = "/var/log/supervisor/"
-	err = filepath.Walk(runner02logRootDir, func(path string, f os.FileInfo, _ error) error {
-		if !f.IsDir() {
-			for _, v := range []string{runner02gatewaySupervisorConfFile + "_" + r.InstanceId + "-stdout.*",
-				runner02gatewaySupervisorConfFile + "_" + r.InstanceId + "-stderr.*",
-				runner02bridgeSupervisorConfFile + "_" + r.InstanceId + "-stdout.*",
-				runner02bridgeSupervisorConfFile + "_" + r.InstanceId + "-stderr.*"} {
-				r, err := regexp.MatchString(v, f.Name())
-				if err == nil && r {
-					fileSubscriptions[v[:len(v)-2]] = runner02logRootDir + f.Name()
-				}
-			}
-		}
-		return nil
-	})
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
+	}
+
+	return runner.GetLogSources(util.LogDirOrDefault(resData.LogDir), map[string]string{"gateway": resData.GatewayProgram, "bridge": resData.BridgeProgram}), nil
+}
+
+func (r *linux_amd64_supervisor_runner02) SupervisorConfs() (map[string]string, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return nil
-	}
-
-	var wg sync.WaitGroup
-	for k, v := range fileSubscriptions {
-		wg.Add(1)
-		go func(filename string, filelocation string) {
-			seeklocation := util.GetFileSeekOffsetLastNLines(filelocation, lines)
-			t, err := tail.TailFile(filelocation, tail.Config{Location: &tail.SeekInfo{Offset: seeklocation}, Follow: true, Logger: tail.DiscardingLogger})
-			if err != nil {
-				fmt.Println(err)
-			}
-			for line := range t.Lines {
-				log.Info(fmt.Sprintf("[%20s] ", filename) + line.Text)
-			}
-			wg.Done()
-		}(k, v)
-	}
-	wg.Wait()
-	return nil
+		return nil, err
+	}
+	if !available {
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't render supervisor confs.")
+	}
+
+	return runner.RenderSupervisorConfs(r.supervisorConfs(), &resData)
+}
+
+func (r *linux_amd64_supervisor_runner02) Adopt(sections map[string]map[string]string) ([]string, error) {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
+		return nil, errors.New("Resource file already exisits, cannot adopt into instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
+	}
+
+	resData := runner02resource{Runner: "linux-amd64.supervisor.runner02", Version: r.Version, StartTime: time.Now().Format(time.RFC822Z)}
+	unmapped, err := runner.AdoptSupervisorPrograms(r.supervisorConfs(), &resData, sections)
+	if err != nil {
+		return nil, err
+	}
+	util.FillLogConfigDefaults(&resData)
+
+	return unmapped, r.writeResourceToFile(resData, GetResourceFileLocation(r.Storage, r.InstanceId))
+}
+
+func (r *linux_amd64_supervisor_runner02) ManagedFiles() []string {
+	files := []string{GetResourceFileLocation(r.Storage, r.InstanceId), util.LogRotateConfLocation(runner02projectName + "_" + r.InstanceId)}
+	for _, conf := range r.supervisorConfs() {
+		files = append(files, conf.Location)
+	}
+	return files
+}
+
+func (r *linux_amd64_supervisor_runner02) supervisorConfs() []runner.SupervisorConf {
+	gt := template.Must(template.New("gateway-template").Parse(util.TrimSpacesEveryLine(`
+		[program:{{.GatewayProgram}}]
+		process_name={{.GatewayProgram}}
+		user=` + util.SupervisorUser("GatewayUser") + `
+		directory={{.GatewayRunDir}}
+		command=` + util.SupervisorCommandPrefix("GatewayUser") + `{{.GatewayExecutablePath}} dataconnect --keyfile {{.GatewayKeyfile}} --listenportpeer {{.GatewayListenPortPeer}} --marlinip {{.GatewayMarlinIp}} --marlinport {{.GatewayPort}} --direction {{.GatewayDirection}}` + util.SupervisorEnvironmentTemplate + `
+		priority=100
+		numprocs=1
+		numprocs_start=1
+		autostart=true
+		autorestart=true
+		` + util.SupervisorLogTemplate("GatewayProgram") + `
+	`)))
+	bt := template.Must(template.New("bridge-template").Parse(util.TrimSpacesEveryLine(`
+		[program:{{.BridgeProgram}}]
+		process_name={{.BridgeProgram}}
+		user=` + util.SupervisorUser("BridgeUser") + `
+		directory={{.BridgeRunDir}}
+		command=` + util.SupervisorCommandPrefix("BridgeUser") + `{{.BridgeExecutablePath}} --discovery-addr {{.DiscoveryAddr}} --pubsub-addr {{.PubsubAddr}} {{if .BridgeBootstrapAddr}} --beacon-addr {{.BridgeBootstrapAddr}}{{end}} --listen-addr {{.InternalListenAddr}} {{if .KeystorePath}} --keystore-path {{.KeystorePath}}{{end}} {{if .KeystorePassPath}} --keystore-pass-path {{.KeystorePassPath}} {{end}} --contracts {{.Contracts}}  ` + util.SupervisorEnvironmentTemplate + `
+		priority=100
+		numprocs=1
+		numprocs_start=1
+		autostart=true
+		autorestart=true
+		` + util.SupervisorLogTemplate("BridgeProgram") + `
+	`)))
+
+	return []runner.SupervisorConf{
+		{Location: runner02supervisorConfFiles + "/" + runner02gatewaySupervisorConfFile + "_" + r.InstanceId + ".conf", Template: gt},
+		{Location: runner02supervisorConfFiles + "/" + runner02bridgeSupervisorConfFile + "_" + r.InstanceId + ".conf", Template: bt},
+	}
 }
 
 type runner02resource struct {
 	Runner, Version, StartTime                                                                                                                                                   string
 	GatewayProgram, GatewayUser, GatewayRunDir, GatewayExecutablePath, GatewayKeyfile, GatewayListenPortPeer, GatewayMarlinIp, GatewayPort, GatewayDirection                     string
 	BridgeProgram, BridgeUser, BridgeRunDir, BridgeExecutablePath, BridgeBootstrapAddr, DiscoveryAddr, PubsubAddr, InternalListenAddr, KeystorePath, KeystorePassPath, Contracts string
+	LogDir, LogMaxBytes, LogBackups, LogCompress                                                                                                                                 string
+	MemoryLimit, CPUQuota, NofileLimit, Nice, IONice, Environment, SecretEnvFile                                                                                                 string
 }
 
 func (r *linux_amd64_supervisor_runner02) fetchResourceInformation(fileLocation string) (bool, runner02resource, error) {
@@ -555,5 +436,5 @@ func (r *linux_amd64_supervisor_runner02) writeResourceToFile(resData runner02re
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(fileLocation, fileData, 0644)
+	return util.WriteFile(fileLocation, fileData, 0644)
 }
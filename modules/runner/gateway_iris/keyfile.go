@@ -0,0 +1,8 @@
+package gateway_iris
+
+const (
+	// KeyfileChain is chain keyfiles of gateway (irisnet) instances are generated for
+	KeyfileChain = "iris"
+	// KeyfileGenerator is gateway executable keyfiles are generated with
+	KeyfileGenerator = runner02gatewayName
+)
@@ -11,6 +11,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/marlinprotocol/ctl2/modules/runner"
 	"github.com/marlinprotocol/ctl2/modules/util"
 	"github.com/marlinprotocol/ctl2/types"
 	log "github.com/sirupsen/logrus"
@@ -41,6 +42,7 @@ const (
 	runner02gatewaySupervisorConfFile  = "gateway_polygonbor"
 	runner02mevproxySupervisorConfFile = "mevproxy_polygonbor"
 	runner02projectName                = "gateway_polygonbor"
+	runner02logRootDir                 = "/var/log/supervisor"
 )
 
 func (r *linux_amd64_supervisor_runner02) PreRunSanity() error {
@@ -65,14 +67,19 @@ func (r *linux_amd64_supervisor_runner02) Download() error {
 		return err
 	}
 
-	err = util.DownloadExecutable("mevproxy", r.Version, r.RunnerData.MevProxy, r.SkipChecksum, r.RunnerData.MevProxyChecksum, dirPath+"/"+runner02mevproxyName)
-	if err != nil {
-		return err
+	// MEV proxy of instances yet to be created is downloaded on create, and
+	// only if it is enabled.
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+	if available && err == nil && resData.MevProxyProgram != "" {
+		return r.downloadMevProxy()
 	}
-
 	return nil
 }
 
+func (r *linux_amd64_supervisor_runner02) downloadMevProxy() error {
+	return util.DownloadExecutable("mevproxy", r.Version, r.RunnerData.MevProxy, r.SkipChecksum, r.RunnerData.MevProxyChecksum, r.Storage+"/"+r.Version+"/"+runner02mevproxyName)
+}
+
 func (r *linux_amd64_supervisor_runner02) Prepare() error {
 	err := r.Download()
 	if err != nil {
@@ -88,21 +95,23 @@ func (r *linux_amd64_supervisor_runner02) Prepare() error {
 }
 
 func (r *linux_amd64_supervisor_runner02) Create(runtimeArgs map[string]string) error {
-	if _, err := os.Stat(GetResourceFileLocation(r.Storage, r.InstanceId)); err == nil {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
 		return errors.New("Resource file already exisits, cannot create a new instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
 	}
 
-	currentUser, err := util.GetUser()
+	serviceUser, err := util.GetServiceUser(runner02projectName)
 	if err != nil {
 		return err
 	}
 
 	substitutions := runner02resource{
 		"linux-amd64.supervisor.runner02", r.Version, time.Now().Format(time.RFC822Z),
-		runner02gatewayProgramName + "_" + r.InstanceId, currentUser.Username, currentUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner02gatewayName,
+		runner02gatewayProgramName + "_" + r.InstanceId, serviceUser.Username, serviceUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner02gatewayName,
 		"", "", "", "", "", "", "",
-		runner02mevproxyProgramName + "_" + r.InstanceId, currentUser.Username, currentUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner02mevproxyName,
+		runner02mevproxyProgramName + "_" + r.InstanceId, serviceUser.Username, serviceUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner02mevproxyName,
 		"", "", "",
+		runner02logRootDir, util.DefaultLogMaxBytes, util.DefaultLogBackups, "false",
+		"", "", "", "", "", "", "",
 	}
 
 	for k, v := range runtimeArgs {
@@ -112,61 +121,74 @@ func (r *linux_amd64_supervisor_runner02) Create(runtimeArgs map[string]string)
 		}
 	}
 
-	log.Info("Running configuration")
-	util.PrettyPrintKVStruct(substitutions)
-
-	gt := template.Must(template.New("gateway-template").Parse(util.TrimSpacesEveryLine(`
-		[program:{{.GatewayProgram}}]
-		process_name={{.GatewayProgram}}
-		user={{.GatewayUser}}
-		directory={{.GatewayRunDir}}
-		command={{.GatewayExecutablePath}} --discovery-addr {{.DiscoveryAddr}} --pubsub-addr {{.PubsubAddr}} {{if .BootstrapAddr}} --beacon-addr {{.BootstrapAddr}}{{end}} {{if .SpamcheckAddr}} --spamcheck-addr {{.SpamcheckAddr}}{{end}} {{if .KeystorePath}} --keystore-path {{.KeystorePath}}{{end}} {{if .KeystorePassPath}} --keystore-pass-path {{.KeystorePassPath}} {{end}} --contracts {{.Contracts}}
-		priority=100
-		numprocs=1
-		numprocs_start=1
-		autostart=true
-		autorestart=true
-		stdout_logfile=/var/log/supervisor/{{.GatewayProgram}}-stdout.log
-		stderr_logfile=/var/log/supervisor/{{.GatewayProgram}}-stderr.log
-	`)))
-	gFile, err := os.Create(runner02supervisorConfFiles + "/" + runner02gatewaySupervisorConfFile + "_" + r.InstanceId + ".conf")
+	err = util.ApplyLimits(&substitutions, serviceUser)
 	if err != nil {
 		return err
 	}
-	if err := gt.Execute(gFile, substitutions); err != nil {
-		panic(err)
+
+	if substitutions.MevProxyProgram != "" {
+		chainID, err := CheckBundleAddr(substitutions.MevProxyBundleAddr)
+		if err != nil {
+			return err
+		}
+		log.Info("MEV proxy bundle address ", substitutions.MevProxyBundleAddr, " answers with chain id ", chainID)
+		if substitutions.MevProxyExecutablePath == "" {
+			substitutions.MevProxyExecutablePath = r.Storage + "/" + r.Version + "/" + runner02mevproxyName
+		}
+		err = r.downloadMevProxy()
+		if err == nil {
+			err = util.ChownRmarlinctlDir()
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		substitutions.MevProxyExecutablePath = ""
 	}
-	gFile.Close()
 
-	mpt := template.Must(template.New("mevproxy-template").Parse(util.TrimSpacesEveryLine(`
-		[program:{{.MevProxyProgram}}]
-		process_name={{.MevProxyProgram}}
-		user={{.MevProxyUser}}
-		directory={{.MevProxyRunDir}}
-		command={{.MevProxyExecutablePath}} -listenAddr {{.MevProxyListenAddr}} -rpcAddr {{.MevProxyBundleAddr}} {{if .SubgraphPath}} -subgraphPath {{.SubgraphPath}} {{end}}
-		priority=100
-		numprocs=1
-		numprocs_start=1
-		autostart=true
-		autorestart=true
-		stdout_logfile=/var/log/supervisor/{{.MevProxyProgram}}-stdout.log
-		stderr_logfile=/var/log/supervisor/{{.MevProxyProgram}}-stderr.log
-	`)))
-	mpFile, err := os.Create(runner02supervisorConfFiles + "/" + runner02mevproxySupervisorConfFile + "_" + r.InstanceId + ".conf")
+	tx := &runner.Transaction{}
+	err = tx.Preserve(util.LogRotateConfLocation(runner02projectName + "_" + r.InstanceId))
 	if err != nil {
 		return err
 	}
-	if err := mpt.Execute(mpFile, substitutions); err != nil {
-		panic(err)
+	err = util.ApplyLogConfig(runner02projectName+"_"+r.InstanceId, substitutions.programs(), &substitutions)
+	if err != nil {
+		return tx.Rollback(err)
 	}
-	mpFile.Close()
 
-	err = util.SupervisorStart([]string{substitutions.GatewayProgram, substitutions.MevProxyProgram})
+	log.Info("Running configuration")
+	util.PrettyPrintKVStruct(substitutions)
+
+	listenAddresses := substitutions
+	if substitutions.MevProxyProgram == "" {
+		listenAddresses.MevProxyListenAddr = ""
+	}
+	err = util.CheckListenAddresses(GetResourceFileLocation(r.Storage, r.InstanceId), listenAddresses)
 	if err != nil {
-		return err
+		return tx.Rollback(err)
+	}
+
+	for _, conf := range r.activeConfs(substitutions) {
+		err = tx.WriteSupervisorConf(conf, substitutions)
+		if err != nil {
+			return tx.Rollback(err)
+		}
+	}
+
+	err = tx.SupervisorStart(substitutions.programs())
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	util.SupervisorStatusBestEffort(substitutions.programs())
+	err = tx.Do("write resource file", func() error {
+		return r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
+	}, func() error {
+		return util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
+	})
+	if err != nil {
+		return tx.Rollback(err)
 	}
-	util.SupervisorStatusBestEffort([]string{runner02gatewayProgramName, runner02mevproxyProgramName}, r.InstanceId)
-	return r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
+	return nil
 }
 
 func (r *linux_amd64_supervisor_runner02) Restart() error {
@@ -179,7 +201,9 @@ func (r *linux_amd64_supervisor_runner02) Restart() error {
 	}
 
 	util.SupervisorRestartProgramBestEffort("gateway", resData.GatewayProgram)
-	util.SupervisorRestartProgramBestEffort("mevpoxy", resData.MevProxyProgram)
+	if resData.MevProxyProgram != "" {
+		util.SupervisorRestartProgramBestEffort("mevproxy", resData.MevProxyProgram)
+	}
 
 	return nil
 }
@@ -192,16 +216,6 @@ func (r *linux_amd64_supervisor_runner02) Recreate() error {
 	if !available {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
-	err = r.Destroy()
-	if err != nil {
-		return err
-	}
-
-	err = r.PostRun()
-	if err != nil {
-		return err
-	}
-
 	err = r.Prepare()
 	if err != nil {
 		return err
@@ -218,11 +232,9 @@ func (r *linux_amd64_supervisor_runner02) Recreate() error {
 		}
 	}
 
-	err = r.Create(runtimeArgs)
-	if err != nil {
-		return err
-	}
-	return nil
+	return runner.Replace(r, func() error {
+		return r.Create(runtimeArgs)
+	})
 }
 
 func (r *linux_amd64_supervisor_runner02) Destroy() error {
@@ -234,7 +246,7 @@ func (r *linux_amd64_supervisor_runner02) Destroy() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't destroy")
 	}
 
-	errs := util.SupervisorStop([]string{resData.MevProxyProgram, resData.GatewayProgram})
+	errs := util.SupervisorStop(resData.programs())
 	if len(errs) != 0 {
 		return errors.New(fmt.Sprintf("Error while stopping programs %v", errs))
 	}
@@ -242,20 +254,22 @@ func (r *linux_amd64_supervisor_runner02) Destroy() error {
 }
 
 func (r *linux_amd64_supervisor_runner02) PostRun() error {
-	var gatewayConfig = runner02supervisorConfFiles + "/" + runner02gatewaySupervisorConfFile + "_" + r.InstanceId + ".conf"
-
-	if _, err := os.Stat(gatewayConfig); !os.IsNotExist(err) {
-		if err := os.Remove(gatewayConfig); err != nil {
+	for _, conf := range r.supervisorConfs() {
+		if err := util.RemoveFileIfExists(conf.Location); err != nil {
 			return err
 		}
 	}
 
+	if err := util.RemoveLogRotateConf(runner02projectName + "_" + r.InstanceId); err != nil {
+		return err
+	}
+
 	err := util.SupervisorRereadUpdate()
 	if err != nil {
 		return err
 	}
 
-	err = os.Remove(GetResourceFileLocation(r.Storage, r.InstanceId))
+	err = util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
 		return errors.New("Error while removing resource file: " + err.Error())
 	}
@@ -285,22 +299,115 @@ func (r *linux_amd64_supervisor_runner02) Status() error {
 	util.PrettyPrintKVStruct(resData)
 
 	log.Info("Process Status")
-	util.SupervisorStatusBestEffort([]string{resData.GatewayProgram, resData.MevProxyProgram}, r.InstanceId)
+	util.SupervisorStatusBestEffort(resData.programs())
 
 	return nil
 }
 
-func (r *linux_amd64_supervisor_runner02) Logs(lines int) error {
-	available, _, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+func (r *linux_amd64_supervisor_runner02) Health(options runner.HealthOptions) (runner.HealthReport, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return err
+		return runner.HealthReport{}, err
+	}
+	if !available {
+		return runner.HealthReport{}, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return health.")
+	}
+
+	return runner.GetHealth(resData.programs(), resData, options), nil
+}
+
+func (r *linux_amd64_supervisor_runner02) LogSources() ([]runner.LogSource, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
+	}
+
+	programs := map[string]string{"gateway": resData.GatewayProgram}
+	if resData.MevProxyProgram != "" {
+		programs["mevproxy"] = resData.MevProxyProgram
+	}
+	return runner.GetLogSources(util.LogDirOrDefault(resData.LogDir), programs), nil
+}
+
+func (r *linux_amd64_supervisor_runner02) SupervisorConfs() (map[string]string, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+	if err != nil {
+		return nil, err
 	}
 	if !available {
-		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't render supervisor confs.")
+	}
+
+	return runner.RenderSupervisorConfs(r.activeConfs(resData), &resData)
+}
+
+func (r *linux_amd64_supervisor_runner02) Adopt(sections map[string]map[string]string) ([]string, error) {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
+		return nil, errors.New("Resource file already exisits, cannot adopt into instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
+	}
+
+	resData := runner02resource{Runner: "linux-amd64.supervisor.runner02", Version: r.Version, StartTime: time.Now().Format(time.RFC822Z)}
+	unmapped, err := runner.AdoptSupervisorPrograms(r.supervisorConfs(), &resData, sections)
+	if err != nil {
+		return nil, err
 	}
+	util.FillLogConfigDefaults(&resData)
 
-	return util.LogTailer([]string{runner02gatewaySupervisorConfFile, runner02mevproxySupervisorConfFile},
-		r.InstanceId, lines)
+	return unmapped, r.writeResourceToFile(resData, GetResourceFileLocation(r.Storage, r.InstanceId))
+}
+
+func (r *linux_amd64_supervisor_runner02) ManagedFiles() []string {
+	files := []string{GetResourceFileLocation(r.Storage, r.InstanceId), util.LogRotateConfLocation(runner02projectName + "_" + r.InstanceId)}
+	for _, conf := range r.supervisorConfs() {
+		files = append(files, conf.Location)
+	}
+	return files
+}
+
+func (r *linux_amd64_supervisor_runner02) supervisorConfs() []runner.SupervisorConf {
+	gt := template.Must(template.New("gateway-template").Parse(util.TrimSpacesEveryLine(`
+		[program:{{.GatewayProgram}}]
+		process_name={{.GatewayProgram}}
+		user=` + util.SupervisorUser("GatewayUser") + `
+		directory={{.GatewayRunDir}}
+		command=` + util.SupervisorCommandPrefix("GatewayUser") + `{{.GatewayExecutablePath}} --discovery-addr {{.DiscoveryAddr}} --pubsub-addr {{.PubsubAddr}} {{if .BootstrapAddr}} --beacon-addr {{.BootstrapAddr}}{{end}} {{if .SpamcheckAddr}} --spamcheck-addr {{.SpamcheckAddr}}{{end}} {{if .KeystorePath}} --keystore-path {{.KeystorePath}}{{end}} {{if .KeystorePassPath}} --keystore-pass-path {{.KeystorePassPath}} {{end}} --contracts {{.Contracts}}` + util.SupervisorEnvironmentTemplate + `
+		priority=100
+		numprocs=1
+		numprocs_start=1
+		autostart=true
+		autorestart=true
+		` + util.SupervisorLogTemplate("GatewayProgram") + `
+	`)))
+	mpt := template.Must(template.New("mevproxy-template").Parse(util.TrimSpacesEveryLine(`
+		[program:{{.MevProxyProgram}}]
+		process_name={{.MevProxyProgram}}
+		user=` + util.SupervisorUser("MevProxyUser") + `
+		directory={{.MevProxyRunDir}}
+		command=` + util.SupervisorCommandPrefix("MevProxyUser") + `{{.MevProxyExecutablePath}} -listenAddr {{.MevProxyListenAddr}} -rpcAddr {{.MevProxyBundleAddr}} {{if .SubgraphPath}} -subgraphPath {{.SubgraphPath}} {{end}}` + util.SupervisorEnvironmentTemplate + `
+		priority=100
+		numprocs=1
+		numprocs_start=1
+		autostart=true
+		autorestart=true
+		` + util.SupervisorLogTemplate("MevProxyProgram") + `
+	`)))
+
+	return []runner.SupervisorConf{
+		{Location: runner02supervisorConfFiles + "/" + runner02gatewaySupervisorConfFile + "_" + r.InstanceId + ".conf", Template: gt},
+		{Location: runner02supervisorConfFiles + "/" + runner02mevproxySupervisorConfFile + "_" + r.InstanceId + ".conf", Template: mpt},
+	}
+}
+
+// activeConfs leaves out conf of MEV proxy when it is disabled.
+func (r *linux_amd64_supervisor_runner02) activeConfs(resData runner02resource) []runner.SupervisorConf {
+	confs := r.supervisorConfs()
+	if resData.MevProxyProgram == "" {
+		return confs[:1]
+	}
+	return confs
 }
 
 type runner02resource struct {
@@ -309,6 +416,17 @@ type runner02resource struct {
 	DiscoveryAddr, PubsubAddr, BootstrapAddr, KeystorePath, KeystorePassPath, SpamcheckAddr, Contracts string
 	MevProxyProgram, MevProxyUser, MevProxyRunDir, MevProxyExecutablePath                              string
 	MevProxyListenAddr, MevProxyBundleAddr, SubgraphPath                                               string
+	LogDir, LogMaxBytes, LogBackups, LogCompress                                                       string
+	MemoryLimit, CPUQuota, NofileLimit, Nice, IONice, Environment, SecretEnvFile                       string
+}
+
+// programs returns programs of resource, MEV proxy having no program when it
+// is disabled.
+func (res runner02resource) programs() []string {
+	if res.MevProxyProgram == "" {
+		return []string{res.GatewayProgram}
+	}
+	return []string{res.GatewayProgram, res.MevProxyProgram}
 }
 
 func (r *linux_amd64_supervisor_runner02) fetchResourceInformation(fileLocation string) (bool, runner02resource, error) {
@@ -343,5 +461,5 @@ func (r *linux_amd64_supervisor_runner02) writeResourceToFile(resData runner02re
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(fileLocation, fileData, 0644)
+	return util.WriteFile(fileLocation, fileData, 0644)
 }
@@ -0,0 +1,193 @@
+package gateway_polygonbor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/marlinprotocol/ctl2/modules/runner"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// MevProxy is MEV proxy run by an instance alongside gateway. Program is
+// empty when proxy is disabled.
+type MevProxy struct {
+	InstanceId   string
+	Program      string
+	ListenAddr   string
+	BundleAddr   string
+	SubgraphPath string
+	storage      string
+}
+
+// MevProxyFields are resource fields which can be changed by reconfiguring
+// MEV proxy.
+var MevProxyFields = []string{"MevProxyListenAddr", "MevProxyBundleAddr", "SubgraphPath"}
+
+// CheckBundleAddr asks bor JSON-RPC endpoint at addr, which MEV proxy
+// forwards bundles to, for its chain id.
+func CheckBundleAddr(addr string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := rpc.DialContext(ctx, addr)
+	if err != nil {
+		return 0, errors.New("Error while connecting to bor JSON-RPC endpoint " + addr + ": " + err.Error())
+	}
+	defer client.Close()
+
+	var chainID hexutil.Uint64
+	err = client.CallContext(ctx, &chainID, "eth_chainId")
+	if err != nil {
+		return 0, errors.New("Bor JSON-RPC endpoint " + addr + " does not answer eth_chainId: " + err.Error())
+	}
+	return uint64(chainID), nil
+}
+
+// GetMevProxy returns MEV proxy of instance. Instances of runners not
+// running MEV proxy return an error.
+func GetMevProxy(storage string, instanceId string) (MevProxy, error) {
+	r := &linux_amd64_supervisor_runner02{Storage: storage, InstanceId: instanceId}
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(storage, instanceId))
+	if !available {
+		return MevProxy{}, errors.New("resource by id " + instanceId + " doesn't exist")
+	}
+	if err != nil {
+		return MevProxy{}, err
+	}
+	if resData.Runner != "linux-amd64.supervisor.runner02" {
+		return MevProxy{}, errors.New("Instance " + instanceId + " runs " + resData.Runner + " which does not run MEV proxy")
+	}
+	return MevProxy{
+		InstanceId:   instanceId,
+		Program:      resData.MevProxyProgram,
+		ListenAddr:   resData.MevProxyListenAddr,
+		BundleAddr:   resData.MevProxyBundleAddr,
+		SubgraphPath: resData.SubgraphPath,
+		storage:      storage,
+	}, nil
+}
+
+// Enabled tells if MEV proxy is run by instance.
+func (m MevProxy) Enabled() bool {
+	return m.Program != ""
+}
+
+// Restart restarts MEV proxy, leaving gateway running, once bor JSON-RPC
+// endpoint answers.
+func (m MevProxy) Restart() error {
+	if !m.Enabled() {
+		return errors.New("MEV proxy of instance " + m.InstanceId + " is disabled")
+	}
+	chainID, err := CheckBundleAddr(m.BundleAddr)
+	if err != nil {
+		return err
+	}
+	log.Info("MEV proxy bundle address ", m.BundleAddr, " answers with chain id ", chainID)
+	util.SupervisorRestartProgramBestEffort("mevproxy", m.Program)
+	return nil
+}
+
+// Reconfigure applies changes, keyed by MevProxyFields, to MEV proxy and
+// enables or disables it. MEV proxy being enabled is downloaded using
+// runnerData of version instance runs. Only MEV proxy is restarted, gateway
+// is left running. Everything is rolled back if any step fails.
+func (m MevProxy) Reconfigure(changes map[string]string, enabled bool, runnerData interface{}, skipChecksum bool) error {
+	r := &linux_amd64_supervisor_runner02{Storage: m.storage, InstanceId: m.InstanceId}
+	resourceFile := GetResourceFileLocation(m.storage, m.InstanceId)
+	_, resData, err := r.fetchResourceInformation(resourceFile)
+	if err != nil {
+		return err
+	}
+
+	oldListenAddr := resData.MevProxyListenAddr
+	for k, v := range changes {
+		valid := false
+		for _, field := range MevProxyFields {
+			valid = valid || field == k
+		}
+		if !valid {
+			return errors.New("Cannot reconfigure " + k + " of MEV proxy")
+		}
+		reflect.ValueOf(&resData).Elem().FieldByName(k).SetString(v)
+	}
+
+	if enabled {
+		_, err = util.ParseListenAddress("MevProxyListenAddr", resData.MevProxyListenAddr)
+		if err != nil {
+			return err
+		}
+		// Only new address is checked as gateway holds its own addresses.
+		if !m.Enabled() || resData.MevProxyListenAddr != oldListenAddr {
+			err = util.CheckListenAddresses(resourceFile, struct{ MevProxyListenAddr string }{resData.MevProxyListenAddr})
+			if err != nil {
+				return err
+			}
+		}
+		chainID, err := CheckBundleAddr(resData.MevProxyBundleAddr)
+		if err != nil {
+			return err
+		}
+		log.Info("MEV proxy bundle address ", resData.MevProxyBundleAddr, " answers with chain id ", chainID)
+		if resData.MevProxyProgram == "" {
+			resData.MevProxyProgram = runner02mevproxyProgramName + "_" + m.InstanceId
+		}
+		if !m.Enabled() {
+			versioned, err := GetRunnerInstance(resData.Runner, resData.Version, m.storage, runnerData, false, skipChecksum, m.InstanceId)
+			if err != nil {
+				return err
+			}
+			err = versioned.(*linux_amd64_supervisor_runner02).downloadMevProxy()
+			if err == nil {
+				err = util.ChownRmarlinctlDir()
+			}
+			if err != nil {
+				return err
+			}
+			if resData.MevProxyExecutablePath == "" {
+				resData.MevProxyExecutablePath = m.storage + "/" + resData.Version + "/" + runner02mevproxyName
+			}
+		}
+	} else {
+		resData.MevProxyProgram = ""
+		resData.MevProxyExecutablePath = ""
+	}
+
+	conf := r.supervisorConfs()[1]
+	logRotateName := runner02projectName + "_" + m.InstanceId
+	tx := &runner.Transaction{}
+	err = tx.Preserve(conf.Location, resourceFile, util.LogRotateConfLocation(logRotateName))
+	if err != nil {
+		return err
+	}
+	if enabled {
+		err = tx.WriteSupervisorConf(conf, resData)
+	} else {
+		err = tx.Do("remove supervisor conf "+conf.Location, func() error {
+			return util.RemoveFileIfExists(conf.Location)
+		}, nil)
+	}
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	err = util.ApplyLogConfig(logRotateName, resData.programs(), &resData)
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	err = tx.Do("write resource file", func() error {
+		return r.writeResourceToFile(resData, resourceFile)
+	}, nil)
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	err = tx.Do("update supervisor", util.SupervisorRereadUpdate, nil)
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	util.SupervisorStatusBestEffort(resData.programs())
+	return nil
+}
@@ -0,0 +1,151 @@
+package runner
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+)
+
+// HealthStatus follows exit code conventions of nagios style monitoring
+// plugins so that it can be handed to monitoring systems directly.
+type HealthStatus int
+
+const (
+	HealthOK       HealthStatus = 0
+	HealthWarning  HealthStatus = 1
+	HealthCritical HealthStatus = 2
+	HealthUnknown  HealthStatus = 3
+)
+
+func (h HealthStatus) String() string {
+	switch h {
+	case HealthOK:
+		return "OK"
+	case HealthWarning:
+		return "WARNING"
+	case HealthCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type HealthOptions struct {
+	HTTPProbe    string
+	ProbeTimeout time.Duration
+}
+
+type ProgramHealth struct {
+	Program  string
+	State    string
+	Pid      int
+	Uptime   time.Duration
+	Restarts int
+}
+
+type ProbeResult struct {
+	Name   string
+	Target string
+	OK     bool
+	Detail string
+}
+
+type HealthReport struct {
+	Status   HealthStatus
+	Programs []ProgramHealth
+	Probes   []ProbeResult
+}
+
+func (h *HealthReport) degrade(status HealthStatus) {
+	if status > h.Status {
+		h.Status = status
+	}
+}
+
+// GetHealth builds a health report for programs of a resource. Any program
+// not in RUNNING state or a failing http probe makes the resource critical,
+// unreachable listen addresses only raise a warning since not every program
+// listens on tcp.
+func GetHealth(programs []string, resData interface{}, options HealthOptions) HealthReport {
+	var report HealthReport
+	if options.ProbeTimeout == 0 {
+		options.ProbeTimeout = 2 * time.Second
+	}
+
+	infos, err := util.SupervisorProgramInfos(programs)
+	if err != nil {
+		report.degrade(HealthUnknown)
+		report.Probes = append(report.Probes, ProbeResult{"supervisor", "", false, err.Error()})
+		return report
+	}
+	since := resourceStartTime(resData)
+	for _, prg := range programs {
+		info, ok := infos[prg]
+		if !ok {
+			info.State = "MISSING"
+		}
+		restarts := util.SupervisorSpawnCount(prg, since)
+		if restarts > 0 {
+			restarts--
+		}
+		report.Programs = append(report.Programs, ProgramHealth{prg, info.State, info.Pid, info.Uptime, restarts})
+		if info.State != "RUNNING" {
+			report.degrade(HealthCritical)
+		}
+	}
+
+	addresses, err := util.GetListenAddresses(resData)
+	if err != nil {
+		report.degrade(HealthWarning)
+		report.Probes = append(report.Probes, ProbeResult{"addresses", "", false, err.Error()})
+	}
+	for _, a := range addresses {
+		host := a.Host
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		target := net.JoinHostPort(host, fmt.Sprint(a.Port))
+		conn, err := net.DialTimeout("tcp", target, options.ProbeTimeout)
+		if err != nil {
+			report.degrade(HealthWarning)
+			report.Probes = append(report.Probes, ProbeResult{"tcp " + a.Field, target, false, err.Error()})
+			continue
+		}
+		conn.Close()
+		report.Probes = append(report.Probes, ProbeResult{"tcp " + a.Field, target, true, ""})
+	}
+
+	if options.HTTPProbe != "" {
+		client := http.Client{Timeout: options.ProbeTimeout}
+		resp, err := client.Get(options.HTTPProbe)
+		if err != nil {
+			report.degrade(HealthCritical)
+			report.Probes = append(report.Probes, ProbeResult{"http", options.HTTPProbe, false, err.Error()})
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+				report.Probes = append(report.Probes, ProbeResult{"http", options.HTTPProbe, true, resp.Status})
+			} else {
+				report.degrade(HealthCritical)
+				report.Probes = append(report.Probes, ProbeResult{"http", options.HTTPProbe, false, resp.Status})
+			}
+		}
+	}
+	return report
+}
+
+// resourceStartTime returns time resource was created at, restarts of its
+// programs are counted since then. Zero time is returned if unknown.
+func resourceStartTime(resData interface{}) time.Time {
+	ref := reflect.Indirect(reflect.ValueOf(resData))
+	if f := ref.FieldByName("StartTime"); f.IsValid() && f.Kind() == reflect.String {
+		if t, err := time.Parse(time.RFC822Z, f.String()); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
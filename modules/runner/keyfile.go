@@ -0,0 +1,291 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Keyfile is keyfile holding key which gateways of tendermint based chains
+// identify themselves with to their peers.
+type Keyfile struct {
+	Location string
+	NodeId   string
+}
+
+// ReadKeyfile reads keyfile at location, failing if it is not a keyfile
+// generated by gateway.
+func ReadKeyfile(location string) (Keyfile, error) {
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return Keyfile{}, errors.New("Error while reading keyfile: " + err.Error())
+	}
+	var keyfileData struct {
+		IdString string
+	}
+	err = json.Unmarshal(data, &keyfileData)
+	if err != nil {
+		return Keyfile{}, errors.New("Invalid keyfile " + location + ": " + err.Error())
+	}
+	if keyfileData.IdString == "" {
+		return Keyfile{}, errors.New("Invalid keyfile " + location + ": no node id found")
+	}
+	return Keyfile{location, keyfileData.IdString}, nil
+}
+
+// GenerateKeyfile generates a new keyfile for chain at location using
+// gateway executable, readable only by usr.
+func GenerateKeyfile(executable string, chain string, location string, usr *user.User) (Keyfile, error) {
+	args := []string{"keyfile", "--chain=" + chain, "--generate", "--filelocation=" + location + ".new"}
+	if util.IsDryRun() {
+		util.RecordPlanStep("generate keyfile", location, executable+" "+strings.Join(args, " "))
+		return Keyfile{Location: location}, nil
+	}
+	if !util.FileExists(executable) {
+		return Keyfile{}, errors.New("Gateway executable " + executable + " not found, it is downloaded when creating an instance")
+	}
+	err := util.CreateDirPathIfNotExists(filepath.Dir(location))
+	if err != nil {
+		return Keyfile{}, err
+	}
+	err = util.RemoveFileIfExists(location + ".new")
+	if err != nil {
+		return Keyfile{}, err
+	}
+	out, err := exec.Command(executable, args...).CombinedOutput()
+	if err != nil {
+		return Keyfile{}, errors.New("Keyfile generation error: " + err.Error() + " " + strings.TrimSpace(string(out)))
+	}
+	return installKeyfile(location+".new", location, usr)
+}
+
+// ImportKeyfile copies keyfile at src to location, readable only by usr.
+func ImportKeyfile(src string, location string, usr *user.User) (Keyfile, error) {
+	keyfile, err := ReadKeyfile(src)
+	if err != nil {
+		return Keyfile{}, err
+	}
+	if util.IsDryRun() {
+		util.RecordPlanStep("import keyfile", src+" -> "+location, keyfile.NodeId)
+		return Keyfile{location, keyfile.NodeId}, nil
+	}
+	err = util.CreateDirPathIfNotExists(filepath.Dir(location))
+	if err != nil {
+		return Keyfile{}, err
+	}
+	err = util.CopyFile(src, location+".new", 0600)
+	if err != nil {
+		return Keyfile{}, err
+	}
+	return installKeyfile(location+".new", location, usr)
+}
+
+// installKeyfile moves freshly written keyfile at tmp to location once it
+// is found valid.
+func installKeyfile(tmp string, location string, usr *user.User) (Keyfile, error) {
+	keyfile, err := ReadKeyfile(tmp)
+	if err == nil {
+		err = os.Chmod(tmp, 0600)
+	}
+	if err == nil {
+		err = util.ChownToUser(tmp, usr)
+	}
+	if err == nil {
+		err = os.Rename(tmp, location)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return Keyfile{}, err
+	}
+	keyfile.Location = location
+	return keyfile, nil
+}
+
+// KeyfileLocation returns location of keyfile of instance of project.
+// Instances created by older versions of marlinctl share keyfile.json
+// instead.
+func KeyfileLocation(storage string, projectID string, instanceId string) string {
+	return storage + "/common/project_" + projectID + "_instance" + instanceId + ".keyfile.json"
+}
+
+// GetInstanceKeyfile returns keyfile used by instance of project, or
+// keyfile instance is going to use if it has not been created yet.
+func GetInstanceKeyfile(storage string, projectID string, instanceId string) (Keyfile, error) {
+	location := KeyfileLocation(storage, projectID, instanceId)
+	resData, err := readInstanceResource(storage, projectID, instanceId)
+	if err != nil && !os.IsNotExist(err) {
+		return Keyfile{}, err
+	} else if keyfile, ok := resData["GatewayKeyfile"].(string); ok && keyfile != "" {
+		location = keyfile
+	}
+	if !util.FileExists(location) {
+		return Keyfile{Location: location}, errors.New("No keyfile found at " + location)
+	}
+	return ReadKeyfile(location)
+}
+
+// GenerateInstanceKeyfile generates keyfile for chain for instance of
+// project yet to be created using gateway executable.
+func GenerateInstanceKeyfile(storage string, projectID string, chain string, executable string, instanceId string) (Keyfile, error) {
+	usr, err := checkNewKeyfile(storage, projectID, instanceId)
+	if err != nil {
+		return Keyfile{}, err
+	}
+	return GenerateKeyfile(executable, chain, KeyfileLocation(storage, projectID, instanceId), usr)
+}
+
+// ImportInstanceKeyfile imports keyfile at src for instance of project yet
+// to be created.
+func ImportInstanceKeyfile(storage string, projectID string, instanceId string, src string) (Keyfile, error) {
+	usr, err := checkNewKeyfile(storage, projectID, instanceId)
+	if err != nil {
+		return Keyfile{}, err
+	}
+	return ImportKeyfile(src, KeyfileLocation(storage, projectID, instanceId), usr)
+}
+
+func checkNewKeyfile(storage string, projectID string, instanceId string) (*user.User, error) {
+	if util.FileExists(instanceResourceLocation(storage, projectID, instanceId)) {
+		return nil, errors.New("Instance " + instanceId + " already exists, use keyfile rotate to replace its keyfile")
+	}
+	location := KeyfileLocation(storage, projectID, instanceId)
+	if util.FileExists(location) {
+		return nil, errors.New("Keyfile " + location + " already exists, it is used once instance " + instanceId + " is created")
+	}
+	return util.GetServiceUser(projectID)
+}
+
+// archivedKeyfileLocation returns location keyfile at location is kept at
+// once replaced or destroyed, timestamped so that earlier ones are kept.
+func archivedKeyfileLocation(location string, reason string) (string, error) {
+	archived := location + "." + reason + "." + time.Now().Format("20060102-150405")
+	if util.FileExists(archived) {
+		return "", errors.New("Archived keyfile " + archived + " already exists, refusing to overwrite it")
+	}
+	return archived, nil
+}
+
+// ArchiveInstanceKeyfile moves keyfile of destroyed instance of project out
+// of the way with a timestamped .destroyed suffix, so that an instance
+// created later with same id does not pick up its node id.
+func ArchiveInstanceKeyfile(storage string, projectID string, instanceId string) error {
+	location := KeyfileLocation(storage, projectID, instanceId)
+	if !util.FileExists(location) {
+		return nil
+	}
+	archived, err := archivedKeyfileLocation(location, "destroyed")
+	if err != nil {
+		return err
+	}
+	err = util.MoveFile(location, archived)
+	if err != nil {
+		return errors.New("Error while archiving keyfile: " + err.Error())
+	}
+	log.Info("Keyfile of instance ", instanceId, " moved to ", archived)
+	return nil
+}
+
+// PrepareKeyfile generates keyfile for chain at location for instance about
+// to be created unless it exists already, and validates it. Keyfiles other
+// than defaultLocation of instance have to exist.
+func PrepareKeyfile(tx *Transaction, location string, defaultLocation string, chain string, executable string, usr *user.User) error {
+	if !util.FileExists(location) {
+		if location != defaultLocation {
+			return errors.New("Keyfile " + location + " does not exist")
+		}
+		err := tx.Do("generate keyfile", func() error {
+			_, err := GenerateKeyfile(executable, chain, location, usr)
+			return err
+		}, func() error {
+			return util.RemoveFileIfExists(location)
+		})
+		if err != nil || util.IsDryRun() {
+			return err
+		}
+	}
+	keyfile, err := ReadKeyfile(location)
+	if err != nil {
+		return err
+	}
+	log.Info("Keyfile information")
+	util.PrettyPrintKVStruct(keyfile)
+	return nil
+}
+
+// RotateKeyfile replaces keyfile of instance of project run by r with one
+// imported from src, or a newly generated one for chain if src is empty, and
+// restarts gateway. Replaced keyfile of instance is kept alongside with a
+// timestamped .old suffix. Instances sharing keyfile.json move to a keyfile
+// of their own.
+func RotateKeyfile(r Runner, storage string, projectID string, chain string, instanceId string, src string) (Keyfile, error) {
+	resourceFile := instanceResourceLocation(storage, projectID, instanceId)
+	resData, err := readInstanceResource(storage, projectID, instanceId)
+	if os.IsNotExist(err) {
+		return Keyfile{}, errors.New("resource by id " + instanceId + " doesn't exist, use keyfile generate or import before creating it")
+	} else if err != nil {
+		return Keyfile{}, err
+	}
+	executable, _ := resData["GatewayExecutablePath"].(string)
+	program, _ := resData["GatewayProgram"].(string)
+	oldLocation, _ := resData["GatewayKeyfile"].(string)
+	usr, err := util.GetServiceUser(projectID)
+	if err != nil {
+		return Keyfile{}, err
+	}
+
+	location := KeyfileLocation(storage, projectID, instanceId)
+	backup, err := archivedKeyfileLocation(location, "old")
+	if err != nil {
+		return Keyfile{}, err
+	}
+	tx := &Transaction{}
+	err = tx.Preserve(append([]string{location, backup}, r.ManagedFiles()...)...)
+	if err != nil {
+		return Keyfile{}, err
+	}
+	if util.FileExists(location) {
+		err = tx.Do("back up keyfile", func() error {
+			return util.CopyFile(location, backup, 0600)
+		}, nil)
+		if err != nil {
+			return Keyfile{}, tx.Rollback(err)
+		}
+		log.Info("Keyfile of instance ", instanceId, " backed up to ", backup)
+	}
+	var keyfile Keyfile
+	err = tx.Do("replace keyfile", func() error {
+		if src == "" {
+			keyfile, err = GenerateKeyfile(executable, chain, location, usr)
+		} else {
+			keyfile, err = ImportKeyfile(src, location, usr)
+		}
+		return err
+	}, nil)
+	if err != nil {
+		return Keyfile{}, tx.Rollback(err)
+	}
+
+	err = UpdateResource(tx, r, resourceFile, map[string]interface{}{"GatewayKeyfile": location})
+	if err != nil {
+		return Keyfile{}, tx.Rollback(err)
+	}
+	err = tx.Do("update supervisor", util.SupervisorRereadUpdate, nil)
+	if err != nil {
+		return Keyfile{}, tx.Rollback(err)
+	}
+	// Supervisor restarts gateway on update only if its conf changed.
+	if oldLocation == location {
+		util.SupervisorRestartProgramBestEffort("gateway", program)
+	}
+	log.Info("Gateway of instance ", instanceId, " now uses keyfile ", location)
+	return keyfile, nil
+}
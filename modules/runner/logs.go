@@ -0,0 +1,336 @@
+package runner
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// LogSource is a single log file written by supervisor for a program of a
+// resource. Program is the kind of program, such as relay, geth or bridge,
+// rather than the supervisor program name.
+type LogSource struct {
+	Instance string
+	Program  string
+	Stream   string
+	Path     string
+}
+
+func (s LogSource) label() string {
+	return s.Instance + " " + s.Program + " " + s.Stream
+}
+
+type LogOptions struct {
+	Lines   int
+	Follow  bool
+	Since   time.Time
+	Until   time.Time
+	Grep    *regexp.Regexp
+	Stream  string
+	Program string
+	Raw     bool
+}
+
+// GetLogSources lists stdout and stderr logs of programs, given as a map from
+// kind of program to supervisor program name, in logRootDir.
+func GetLogSources(logRootDir string, programs map[string]string) []LogSource {
+	var sources []LogSource
+	for kind, program := range programs {
+		if program == "" {
+			continue
+		}
+		for _, stream := range []string{"stdout", "stderr"} {
+			sources = append(sources, LogSource{
+				Program: kind,
+				Stream:  stream,
+				Path:    logRootDir + "/" + program + "-" + stream + ".log",
+			})
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Path < sources[j].Path
+	})
+	return sources
+}
+
+// FilterLogSources keeps sources matching program and stream filters of
+// options. Empty filters match everything.
+func FilterLogSources(sources []LogSource, options LogOptions) []LogSource {
+	var filtered []LogSource
+	for _, s := range sources {
+		if (options.Program == "" || s.Program == options.Program) && (options.Stream == "" || s.Stream == options.Stream) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+type logLine struct {
+	Time   time.Time
+	Source LogSource
+	Text   string
+}
+
+var (
+	isoTimestampRegex    = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)\]?`)
+	logrusTimestampRegex = regexp.MustCompile(`time="([^"]+)"`)
+	gethTimestampRegex   = regexp.MustCompile(`^[A-Z]+ ?\[(\d{2}-\d{2})\|(\d{2}:\d{2}:\d{2}(?:\.\d+)?)\]`)
+)
+
+// parseLineTimestamp extracts timestamp of a line written by any of spdlog
+// (relays, bridges, gateways), logrus or geth.
+func parseLineTimestamp(line string) (time.Time, bool) {
+	if m := isoTimestampRegex.FindStringSubmatch(line); m != nil {
+		t, err := ParseLogTime(strings.Replace(m[1], ",", ".", 1))
+		return t, err == nil
+	}
+	if m := logrusTimestampRegex.FindStringSubmatch(line); m != nil {
+		t, err := time.Parse(time.RFC3339Nano, m[1])
+		return t, err == nil
+	}
+	if m := gethTimestampRegex.FindStringSubmatch(line); m != nil {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", strconv.Itoa(time.Now().Year())+"-"+m[1]+" "+m[2][:8], time.Local)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// ParseLogTime parses an absolute timestamp in RFC3339 or a few common
+// layouts, or a duration such as 10m which is taken relative to now.
+func ParseLogTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z0700", "2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("Invalid time " + value + ", expected a duration such as 1h, RFC3339 or 2006-01-02 15:04:05")
+}
+
+func (o LogOptions) matches(l logLine) bool {
+	if !o.Since.IsZero() && !l.Time.IsZero() && l.Time.Before(o.Since) {
+		return false
+	}
+	if !o.Until.IsZero() && !l.Time.IsZero() && l.Time.After(o.Until) {
+		return false
+	}
+	return o.Grep == nil || o.Grep.MatchString(l.Text)
+}
+
+func (o LogOptions) print(l logLine) {
+	if o.Raw {
+		fmt.Println(l.Text)
+	} else {
+		log.Info("[" + l.Source.label() + "] " + l.Text)
+	}
+}
+
+// rotatedLogFiles returns log file of source along with files rotated out by
+// supervisor or logrotate, oldest first.
+func rotatedLogFiles(source LogSource) []string {
+	matches, _ := filepath.Glob(source.Path + ".*")
+	type rotated struct {
+		path  string
+		index int
+	}
+	var files []rotated
+	for _, m := range matches {
+		if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(m, source.Path+"."), ".gz")); err == nil {
+			files = append(files, rotated{m, n})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].index > files[j].index
+	})
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.path)
+	}
+	return append(paths, source.Path)
+}
+
+// readLogLines reads lines of a source. Rotated files are read as well when
+// lines older than the current file are asked for. Lines without a timestamp
+// of their own, such as continuations of stack traces, inherit the timestamp
+// of the line before them. Offset in current file up to which complete lines
+// were read is returned as well, so that following can carry on from it.
+func readLogLines(source LogSource, options LogOptions) ([]logLine, int64, error) {
+	files := []string{source.Path}
+	var offset int64
+	if !options.Since.IsZero() {
+		files = rotatedLogFiles(source)
+	} else if options.Grep == nil && options.Until.IsZero() && options.Lines > 0 {
+		offset = util.GetFileSeekOffsetLastNLines(source.Path, options.Lines)
+	}
+
+	var lines []logLine
+	var last time.Time
+	var end int64
+	for _, f := range files {
+		file, err := os.Open(f)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+		if f == source.Path && offset > 0 {
+			_, err = file.Seek(offset, io.SeekStart)
+			if err != nil {
+				file.Close()
+				return nil, 0, err
+			}
+		}
+		var reader io.Reader = file
+		if strings.HasSuffix(f, ".gz") {
+			reader, err = gzip.NewReader(file)
+			if err != nil {
+				file.Close()
+				return nil, 0, errors.New("Error while reading " + f + ": " + err.Error())
+			}
+		}
+		// A trailing line still being written is left for following to
+		// print once it is complete.
+		complete := offset
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			advance, token, err := bufio.ScanLines(data, atEOF)
+			if advance > 0 && data[advance-1] == '\n' {
+				complete += int64(advance)
+			} else if token != nil && options.Follow && f == source.Path {
+				return advance, nil, bufio.ErrFinalToken
+			}
+			return advance, token, err
+		})
+		for scanner.Scan() {
+			if scanner.Bytes() == nil {
+				break
+			}
+			if t, ok := parseLineTimestamp(scanner.Text()); ok {
+				last = t
+			}
+			l := logLine{last, source, scanner.Text()}
+			if options.matches(l) {
+				lines = append(lines, l)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, 0, errors.New("Error while reading " + f + ": " + err.Error())
+		}
+		if f == source.Path {
+			end = complete
+		}
+	}
+	return lines, end, nil
+}
+
+// StreamLogs prints lines of sources interleaved in order of their timestamps,
+// followed by lines appended to them afterwards if options ask to follow.
+// Following stops on SIGINT or SIGTERM.
+func StreamLogs(sources []LogSource, options LogOptions) error {
+	if len(sources) == 0 {
+		return errors.New("No log files match given filters")
+	}
+
+	var lines []logLine
+	offsets := make([]int64, len(sources))
+	for i, s := range sources {
+		sourceLines, offset, err := readLogLines(s, options)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, sourceLines...)
+		offsets[i] = offset
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+	if options.Lines > 0 && len(lines) > options.Lines {
+		lines = lines[len(lines)-options.Lines:]
+	}
+	for _, l := range lines {
+		options.print(l)
+	}
+
+	if !options.Follow || !options.Until.IsZero() {
+		return nil
+	}
+
+	var tails []*tail.Tail
+	for i, s := range sources {
+		t, err := tail.TailFile(s.Path, tail.Config{
+			Location: &tail.SeekInfo{Offset: offsets[i], Whence: io.SeekStart},
+			Follow:   true,
+			ReOpen:   true,
+			Logger:   tail.DiscardingLogger,
+		})
+		if err != nil {
+			return errors.New("Error while following " + s.Path + ": " + err.Error())
+		}
+		tails = append(tails, t)
+	}
+
+	followed := make(chan logLine)
+	var wg sync.WaitGroup
+	for i, t := range tails {
+		wg.Add(1)
+		go func(source LogSource, t *tail.Tail) {
+			defer wg.Done()
+			for line := range t.Lines {
+				ts, ok := parseLineTimestamp(line.Text)
+				if !ok {
+					ts = line.Time
+				}
+				followed <- logLine{ts, source, line.Text}
+			}
+		}(sources[i], t)
+	}
+	go func() {
+		wg.Wait()
+		close(followed)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case l, ok := <-followed:
+			if !ok {
+				return nil
+			}
+			if options.matches(l) {
+				options.print(l)
+			}
+		case <-signals:
+			for _, t := range tails {
+				t.Stop()
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseLineTimestamp(t *testing.T) {
+	year := strconv.Itoa(time.Now().Year())
+	tests := []struct {
+		line string
+		time string
+		ok   bool
+	}{
+		{"[2021-03-04 05:06:07.123] [info] connected to peer", "2021-03-04 05:06:07.123", true},
+		{"[2021-03-04 05:06:07,123] [info] connected to peer", "2021-03-04 05:06:07.123", true},
+		{"2021-03-04T05:06:07Z connected to peer", "2021-03-04T05:06:07Z", true},
+		{"2021-03-04T05:06:07.5+05:30 connected to peer", "2021-03-04T05:06:07.5+05:30", true},
+		{"2021-03-04T05:06:07+0530 connected to peer", "2021-03-04T05:06:07+05:30", true},
+		{"2021-03-04 05:06:07.123-0700 connected to peer", "2021-03-04T05:06:07.123-07:00", true},
+		{`time="2021-03-04T05:06:07+05:30" level=info msg="connected to peer"`, "2021-03-04T05:06:07+05:30", true},
+		{"INFO [03-04|05:06:07.123] Imported new chain segment", year + "-03-04 05:06:07", true},
+		{"WARN [03-04|05:06:07] Dropping peer", year + "-03-04 05:06:07", true},
+		{"connected to peer", "", false},
+		{`time="yesterday" level=info`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLineTimestamp(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseLineTimestamp(%q) ok = %v, expected %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		expected, err := ParseLogTime(tt.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(expected) {
+			t.Errorf("parseLineTimestamp(%q) = %v, expected %v", tt.line, got, expected)
+		}
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	before := time.Now()
+	got, err := ParseLogTime("10m")
+	if err != nil || got.After(before.Add(-10*time.Minute).Add(time.Second)) || got.Before(before.Add(-11*time.Minute)) {
+		t.Errorf("ParseLogTime(10m) = %v, %v", got, err)
+	}
+	for _, value := range []string{"2021-03-04", "2021-03-04 05:06", "2021-03-04T05:06:07Z"} {
+		if _, err := ParseLogTime(value); err != nil {
+			t.Errorf("ParseLogTime(%q) failed: %v", value, err)
+		}
+	}
+	if _, err := ParseLogTime("yesterday"); err == nil {
+		t.Error("ParseLogTime accepted yesterday")
+	}
+}
@@ -6,16 +6,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"reflect"
-	"regexp"
 	"strings"
-	"sync"
 	"text/template"
 	"time"
 
-	"github.com/hpcloud/tail"
+	"github.com/marlinprotocol/ctl2/modules/runner"
 	"github.com/marlinprotocol/ctl2/modules/util"
 	"github.com/marlinprotocol/ctl2/types"
 	log "github.com/sirupsen/logrus"
@@ -38,7 +34,6 @@ type linux_amd64_supervisor_runner02 struct {
 const (
 	runner02relayName               = "relay_cosmos_linux-amd64"
 	runner02relayProgramName        = "relay_cosmos"
-	runner02defaultUser             = "root"
 	runner02supervisorConfFiles     = "/etc/supervisor/conf.d"
 	runner02relaySupervisorConfFile = "relay_cosmos"
 	runner02logRootDir              = "/var/log/supervisor"
@@ -65,23 +60,11 @@ func (r *linux_amd64_supervisor_runner02) Download() error {
 
 	var relaycosmosLocation = dirPath + "/" + runner02relayName
 
-	if _, err := os.Stat(relaycosmosLocation); os.IsNotExist(err) {
-		log.Info("Fetching relaycosmos from upstream for version ", r.Version)
-		util.DownloadFile(relaycosmosLocation, r.RunnerData.Relay)
-	}
-	if !r.SkipChecksum {
-		err := util.VerifyChecksum(relaycosmosLocation, r.RunnerData.RelayChecksum)
-		if err != nil {
-			return errors.New("Error while verifying relaycosmos checksum: " + err.Error())
-		} else {
-			log.Debug("Successully verified relaycosmos's integrity")
-		}
-	}
-
-	err = os.Chmod(relaycosmosLocation, 0755)
+	err = util.DownloadExecutable("relaycosmos", r.Version, r.RunnerData.Relay, r.SkipChecksum, r.RunnerData.RelayChecksum, relaycosmosLocation)
 	if err != nil {
 		return err
 	}
+
 	return nil
 }
 
@@ -98,18 +81,20 @@ func (r *linux_amd64_supervisor_runner02) Prepare() error {
 }
 
 func (r *linux_amd64_supervisor_runner02) Create(runtimeArgs map[string]string) error {
-	if _, err := os.Stat(GetResourceFileLocation(r.Storage, r.InstanceId)); err == nil {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
 		return errors.New("Resource file already exisits, cannot create a new instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
 	}
 
-	currentUser, err := util.GetUser()
+	serviceUser, err := util.GetServiceUser(runner02projectName)
 	if err != nil {
 		return err
 	}
 
 	substitutions := runner02resource{
 		"linux-amd64.supervisor.runner02", r.Version, time.Now().Format(time.RFC822Z),
-		runner02relayProgramName + "_" + r.InstanceId, currentUser.Username, currentUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner02relayName, "", "", "", "",
+		runner02relayProgramName + "_" + r.InstanceId, serviceUser.Username, serviceUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner02relayName, "", "", "", "",
+		runner02logRootDir, util.DefaultLogMaxBytes, util.DefaultLogBackups, "false",
+		"", "", "", "", "", "", "",
 	}
 
 	for k, v := range runtimeArgs {
@@ -119,74 +104,49 @@ func (r *linux_amd64_supervisor_runner02) Create(runtimeArgs map[string]string)
 		}
 	}
 
-	log.Info("Running configuration")
-	util.PrettyPrintKVStruct(substitutions)
-
-	rt := template.Must(template.New("relay-cosmos-template").Parse(util.TrimSpacesEveryLine(`
-		[program:{{.RelayProgram}}]
-		process_name={{.RelayProgram}}
-		user={{.RelayUser}}
-		directory={{.RelayRunDir}}
-		command={{.RelayExecutablePath}} {{if .DiscoveryAddrs}} --discovery-addrs "{{.DiscoveryAddrs}}" {{end}} {{if .HeartbeatAddrs}} --heartbeat-addrs "{{.HeartbeatAddrs}}" {{end}} {{if .DiscoveryBindAddr}} --discovery-bind-addr "{{.DiscoveryBindAddr}}" {{end}} {{if .PubsubBindAddr}} --pubsub-bind-addr "{{.PubsubBindAddr}}" {{end}} 
-		priority=100
-		numprocs=1
-		numprocs_start=1
-		autostart=true
-		autorestart=true
-		stdout_logfile=/var/log/supervisor/{{.RelayProgram}}-stdout.log
-		stderr_logfile=/var/log/supervisor/{{.RelayProgram}}-stderr.log
-	`)))
-	rFile, err := os.Create(runner02supervisorConfFiles + "/" + runner02relaySupervisorConfFile + "_" + r.InstanceId + ".conf")
+	err = util.ApplyLimits(&substitutions, serviceUser)
 	if err != nil {
 		return err
 	}
-	if err := rt.Execute(rFile, substitutions); err != nil {
-		panic(err)
-	}
-	rFile.Close()
 
-	_, err = exec.Command("supervisorctl", "reread").Output()
+	tx := &runner.Transaction{}
+	err = tx.Preserve(util.LogRotateConfLocation(runner02projectName + "_" + r.InstanceId))
 	if err != nil {
-		return errors.New("Error while supervisorctl reread: " + err.Error())
-	}
-
-	_, err = exec.Command("supervisorctl", "update").Output()
-	if err != nil {
-		return errors.New("Error while supervisorctl update: " + err.Error())
+		return err
 	}
-
-	_, err = exec.Command("supervisorctl", "start", substitutions.RelayProgram).Output()
+	err = util.ApplyLogConfig(runner02projectName+"_"+r.InstanceId, []string{substitutions.RelayProgram}, &substitutions)
 	if err != nil {
-		return errors.New("Error while starting relaycosmos: " + err.Error())
+		return tx.Rollback(err)
 	}
-	log.Debug("Trigerred relaycosmos run")
 
-	log.Info("Waiting 10 seconds to poll for status")
-	time.Sleep(10 * time.Second)
+	log.Info("Running configuration")
+	util.PrettyPrintKVStruct(substitutions)
 
-	status, err := exec.Command("supervisorctl", "status").Output()
+	err = util.CheckListenAddresses(GetResourceFileLocation(r.Storage, r.InstanceId), substitutions)
 	if err != nil {
-		log.Warning("Error while reading supervisor status: " + err.Error())
+		return tx.Rollback(err)
 	}
-	var supervisorStatus = make(map[string]interface{})
 
-	statusLines := strings.Split(string(status), "\n")
-	var anyStatusLine = false
-	for _, v := range statusLines {
-		if match, err := regexp.MatchString(substitutions.RelayProgram, v); err == nil && match {
-			vSplit := strings.Split(v, " ")
-			supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-			anyStatusLine = true
+	for _, conf := range r.supervisorConfs() {
+		err = tx.WriteSupervisorConf(conf, substitutions)
+		if err != nil {
+			return tx.Rollback(err)
 		}
 	}
-	if !anyStatusLine {
-		log.Info("No proceses seem to be running")
-	} else {
-		log.Info("Process status")
-		util.PrettyPrintKVMap(supervisorStatus)
-	}
-	r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
 
+	err = tx.SupervisorStart([]string{substitutions.RelayProgram})
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	util.SupervisorStatusBestEffort([]string{substitutions.RelayProgram})
+	err = tx.Do("write resource file", func() error {
+		return r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
+	}, func() error {
+		return util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
+	})
+	if err != nil {
+		return tx.Rollback(err)
+	}
 	return nil
 }
 
@@ -199,13 +159,7 @@ func (r *linux_amd64_supervisor_runner02) Restart() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
 
-	_, err1 := exec.Command("supervisorctl", "restart", resData.RelayProgram).Output()
-
-	if err1 == nil {
-		log.Info("Triggered restart")
-	} else {
-		log.Warning("Triggered restart, however supervisor did return some errors. ", err1.Error())
-	}
+	util.SupervisorRestartProgramBestEffort("relay", resData.RelayProgram)
 
 	return nil
 }
@@ -218,16 +172,6 @@ func (r *linux_amd64_supervisor_runner02) Recreate() error {
 	if !available {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
-	err = r.Destroy()
-	if err != nil {
-		return err
-	}
-
-	err = r.PostRun()
-	if err != nil {
-		return err
-	}
-
 	err = r.Prepare()
 	if err != nil {
 		return err
@@ -244,11 +188,9 @@ func (r *linux_amd64_supervisor_runner02) Recreate() error {
 		}
 	}
 
-	err = r.Create(runtimeArgs)
-	if err != nil {
-		return err
-	}
-	return nil
+	return runner.Replace(r, func() error {
+		return r.Create(runtimeArgs)
+	})
 }
 
 func (r *linux_amd64_supervisor_runner02) Destroy() error {
@@ -260,17 +202,10 @@ func (r *linux_amd64_supervisor_runner02) Destroy() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't destroy")
 	}
 
-	returned, err := exec.Command("supervisorctl", "stop", resData.RelayProgram).Output()
-	if err != nil {
-		alreadyDead, err2 := regexp.MatchString("not running", string(returned))
-		if !alreadyDead || err2 != nil {
-			return errors.New("Error while stopping relaycosmos: " + err.Error())
-		}
+	errs := util.SupervisorStop([]string{resData.RelayProgram})
+	if len(errs) != 0 {
+		return errors.New(fmt.Sprintf("Error while stopping programs %v", errs))
 	}
-	log.Debug("Trigerred relaycosmos stop")
-
-	log.Info("Waiting 5 seconds for SIGTERM to take effect")
-	time.Sleep(5 * time.Second)
 
 	return nil
 }
@@ -278,23 +213,20 @@ func (r *linux_amd64_supervisor_runner02) Destroy() error {
 func (r *linux_amd64_supervisor_runner02) PostRun() error {
 	var relaycosmosConfig = runner02supervisorConfFiles + "/" + runner02relaySupervisorConfFile + "_" + r.InstanceId + ".conf"
 
-	if _, err := os.Stat(relaycosmosConfig); !os.IsNotExist(err) {
-		if err := os.Remove(relaycosmosConfig); err != nil {
-			return err
-		}
+	if err := util.RemoveFileIfExists(relaycosmosConfig); err != nil {
+		return err
 	}
 
-	_, err := exec.Command("supervisorctl", "reread").Output()
-	if err != nil {
-		return errors.New("Error while supervisorctl reread: " + err.Error())
+	if err := util.RemoveLogRotateConf(runner02projectName + "_" + r.InstanceId); err != nil {
+		return err
 	}
 
-	_, err = exec.Command("supervisorctl", "update").Output()
+	err := util.SupervisorRereadUpdate()
 	if err != nil {
-		return errors.New("Error while supervisorctl update: " + err.Error())
+		return err
 	}
 
-	err = os.Remove(GetResourceFileLocation(r.Storage, r.InstanceId))
+	err = util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
 		return errors.New("Error while removing resource file: " + err.Error())
 	}
@@ -323,78 +255,95 @@ func (r *linux_amd64_supervisor_runner02) Status() error {
 	log.Info("Resource information")
 	util.PrettyPrintKVStruct(resData)
 
-	status, _ := exec.Command("supervisorctl", "status").Output()
+	util.SupervisorStatusBestEffort([]string{resData.RelayProgram})
 
-	var supervisorStatus = make(map[string]interface{})
+	return nil
+}
 
-	statusLines := strings.Split(string(status), "\n")
-	var anyStatusLine = false
-	for _, v := range statusLines {
-		if match, err := regexp.MatchString(runner02relayProgramName+"_"+r.InstanceId, v); err == nil && match {
-			vSplit := strings.Split(v, " ")
-			supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-			anyStatusLine = true
-		}
+func (r *linux_amd64_supervisor_runner02) Health(options runner.HealthOptions) (runner.HealthReport, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+	if err != nil {
+		return runner.HealthReport{}, err
 	}
-	if !anyStatusLine {
-		log.Info("No proceses seem to be running")
-	} else {
-		log.Info("Process status")
-		util.PrettyPrintKVMap(supervisorStatus)
+	if !available {
+		return runner.HealthReport{}, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return health.")
 	}
 
-	return nil
+	return runner.GetHealth([]string{resData.RelayProgram}, resData, options), nil
 }
 
-func (r *linux_amd64_supervisor_runner02) Logs(lines int) error {
+func (r *linux_amd64_supervisor_runner02) LogSources() ([]runner.LogSource, error) {
 	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !available {
-		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
-	}
-	// Check for resource
-	fileSubscriptions := make(map[string]string)
-	var runner02logRootDir = "/var/log/supervisor/"
-	err = filepath.Walk(runner02logRootDir, func(path string, f os.FileInfo, _ error) error {
-		if !f.IsDir() {
-			for _, v := range []string{resData.RelayProgram + "-stdout.*",
-				resData.RelayProgram + "-stderr.*"} {
-				r, err := regexp.MatchString(v, f.Name())
-				if err == nil && r {
-					fileSubscriptions[v[:len(v)-2]] = runner02logRootDir + f.Name()
-				}
-			}
-		}
-		return nil
-	})
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
+	}
+
+	return runner.GetLogSources(util.LogDirOrDefault(resData.LogDir), map[string]string{"relay": resData.RelayProgram}), nil
+}
+
+func (r *linux_amd64_supervisor_runner02) SupervisorConfs() (map[string]string, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return nil
-	}
-
-	var wg sync.WaitGroup
-	for k, v := range fileSubscriptions {
-		wg.Add(1)
-		go func(filename string, filelocation string) {
-			seeklocation := util.GetFileSeekOffsetLastNLines(filelocation, lines)
-			t, err := tail.TailFile(filelocation, tail.Config{Location: &tail.SeekInfo{Offset: seeklocation}, Follow: true, Logger: tail.DiscardingLogger})
-			if err != nil {
-				fmt.Println(err)
-			}
-			for line := range t.Lines {
-				log.Info(fmt.Sprintf("[%20s] ", filename) + line.Text)
-			}
-			wg.Done()
-		}(k, v)
-	}
-	wg.Wait()
-	return nil
+		return nil, err
+	}
+	if !available {
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't render supervisor confs.")
+	}
+
+	return runner.RenderSupervisorConfs(r.supervisorConfs(), &resData)
+}
+
+func (r *linux_amd64_supervisor_runner02) Adopt(sections map[string]map[string]string) ([]string, error) {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
+		return nil, errors.New("Resource file already exisits, cannot adopt into instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
+	}
+
+	resData := runner02resource{Runner: "linux-amd64.supervisor.runner02", Version: r.Version, StartTime: time.Now().Format(time.RFC822Z)}
+	unmapped, err := runner.AdoptSupervisorPrograms(r.supervisorConfs(), &resData, sections)
+	if err != nil {
+		return nil, err
+	}
+	util.FillLogConfigDefaults(&resData)
+
+	return unmapped, r.writeResourceToFile(resData, GetResourceFileLocation(r.Storage, r.InstanceId))
+}
+
+func (r *linux_amd64_supervisor_runner02) ManagedFiles() []string {
+	files := []string{GetResourceFileLocation(r.Storage, r.InstanceId), util.LogRotateConfLocation(runner02projectName + "_" + r.InstanceId)}
+	for _, conf := range r.supervisorConfs() {
+		files = append(files, conf.Location)
+	}
+	return files
+}
+
+func (r *linux_amd64_supervisor_runner02) supervisorConfs() []runner.SupervisorConf {
+	rt := template.Must(template.New("relay-cosmos-template").Parse(util.TrimSpacesEveryLine(`
+		[program:{{.RelayProgram}}]
+		process_name={{.RelayProgram}}
+		user=` + util.SupervisorUser("RelayUser") + `
+		directory={{.RelayRunDir}}
+		command=` + util.SupervisorCommandPrefix("RelayUser") + `{{.RelayExecutablePath}} {{if .DiscoveryAddrs}} --discovery-addrs "{{.DiscoveryAddrs}}" {{end}} {{if .HeartbeatAddrs}} --heartbeat-addrs "{{.HeartbeatAddrs}}" {{end}} {{if .DiscoveryBindAddr}} --discovery-bind-addr "{{.DiscoveryBindAddr}}" {{end}} {{if .PubsubBindAddr}} --pubsub-bind-addr "{{.PubsubBindAddr}}" {{end}} ` + util.SupervisorEnvironmentTemplate + `
+		priority=100
+		numprocs=1
+		numprocs_start=1
+		autostart=true
+		autorestart=true
+		` + util.SupervisorLogTemplate("RelayProgram") + `
+	`)))
+
+	return []runner.SupervisorConf{
+		{Location: runner02supervisorConfFiles + "/" + runner02relaySupervisorConfFile + "_" + r.InstanceId + ".conf", Template: rt},
+	}
 }
 
 type runner02resource struct {
 	Runner, Version, StartTime                                                                                                   string
 	RelayProgram, RelayUser, RelayRunDir, RelayExecutablePath, DiscoveryAddrs, HeartbeatAddrs, DiscoveryBindAddr, PubsubBindAddr string
+	LogDir, LogMaxBytes, LogBackups, LogCompress                                                                                 string
+	MemoryLimit, CPUQuota, NofileLimit, Nice, IONice, Environment, SecretEnvFile                                                 string
 }
 
 func (r *linux_amd64_supervisor_runner02) fetchResourceInformation(fileLocation string) (bool, runner02resource, error) {
@@ -429,5 +378,5 @@ func (r *linux_amd64_supervisor_runner02) writeResourceToFile(resData runner02re
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(fileLocation, fileData, 0644)
+	return util.WriteFile(fileLocation, fileData, 0644)
 }
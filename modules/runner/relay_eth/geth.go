@@ -0,0 +1,254 @@
+package relay_eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultGethPprofAddr is address pprof of managed geth listens on unless
+// asked otherwise. Instances created before it was configurable listen on
+// all interfaces until recreated.
+const DefaultGethPprofAddr = "127.0.0.1"
+
+// Default ports managed geth listens on for peers and pprof. Instances
+// created before they were configurable use these without them being
+// recorded in their resource.
+const (
+	DefaultGethPort      = "30303"
+	DefaultGethPprofPort = "6060"
+)
+
+var gethSyncModes = []string{"light", "snap", "fast", "full"}
+
+// gethSyncModeVersions are geth versions sync modes were added and removed
+// in, zero if they always were or still are supported.
+var gethSyncModeVersions = map[string][2][3]int{
+	"light": {{}, {1, 14, 0}},
+	"snap":  {{1, 10, 0}, {}},
+	"fast":  {{}, {1, 10, 14}},
+	"full":  {{}, {}},
+}
+
+var gethVersionRegex = regexp.MustCompile(`(?m)^Version: ([0-9]+)\.([0-9]+)\.([0-9]+)`)
+
+// Geth is geth program run by an instance alongside relay.
+type Geth struct {
+	InstanceId     string
+	Program        string
+	ExecutablePath string
+	User           string
+	DataDir        string
+	SyncMode       string
+}
+
+// SyncStatus is sync state of geth as reported by it over IPC.
+type SyncStatus struct {
+	Syncing       bool
+	CurrentBlock  uint64
+	HighestBlock  uint64
+	StartingBlock uint64
+	Peers         uint64
+}
+
+// ValidateGethArgs validates sync mode and pprof address of managed geth,
+// checking sync mode is supported by geth executable.
+func ValidateGethArgs(executable string, syncMode string, pprofAddr string) error {
+	valid := false
+	for _, m := range gethSyncModes {
+		if m == syncMode {
+			valid = true
+		}
+	}
+	if !valid {
+		return errors.New("Invalid geth sync mode " + syncMode + ", expected one of " + strings.Join(gethSyncModes, ", "))
+	}
+	if net.ParseIP(pprofAddr) == nil {
+		return errors.New("Invalid geth pprof address " + pprofAddr + ", expected an IP address")
+	}
+	if util.IsDryRun() && !util.FileExists(executable) {
+		return nil
+	}
+	version, err := gethVersion(executable)
+	if err != nil {
+		return err
+	}
+	added, removed := gethSyncModeVersions[syncMode][0], gethSyncModeVersions[syncMode][1]
+	if compareGethVersions(version, added) < 0 || (removed != [3]int{} && compareGethVersions(version, removed) >= 0) {
+		return errors.New("Geth " + formatGethVersion(version) + " shipped with this version does not support sync mode " + syncMode)
+	}
+	return nil
+}
+
+// gethVersion returns version of geth executable as reported by it.
+func gethVersion(executable string) ([3]int, error) {
+	out, err := exec.Command(executable, "version").Output()
+	if err != nil {
+		return [3]int{}, errors.New("Error while reading version of geth " + executable + ": " + err.Error())
+	}
+	m := gethVersionRegex.FindStringSubmatch(string(out))
+	if m == nil {
+		return [3]int{}, errors.New("Cannot find version of geth " + executable + " in its output")
+	}
+	var version [3]int
+	for i := range version {
+		version[i], _ = strconv.Atoi(m[i+1])
+	}
+	return version, nil
+}
+
+func compareGethVersions(a [3]int, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
+
+func formatGethVersion(version [3]int) string {
+	return strconv.Itoa(version[0]) + "." + strconv.Itoa(version[1]) + "." + strconv.Itoa(version[2])
+}
+
+// GetGeth returns geth managed by instance. Instances of runners not managing
+// geth, which expect geth to be run separately, return an error.
+func GetGeth(storage string, instanceId string) (Geth, error) {
+	file, err := ioutil.ReadFile(GetResourceFileLocation(storage, instanceId))
+	if err != nil {
+		return Geth{}, err
+	}
+	var resData map[string]interface{}
+	err = json.Unmarshal(file, &resData)
+	if err != nil {
+		return Geth{}, err
+	}
+	field := func(key string) string {
+		v, _ := resData[key].(string)
+		return v
+	}
+	if field("GethProgram") == "" {
+		return Geth{}, errors.New("Instance " + instanceId + " runs " + field("Runner") + " which does not manage geth, geth using data directory " + field("DataDir") + " has to be run separately")
+	}
+	return Geth{
+		InstanceId:     instanceId,
+		Program:        field("GethProgram"),
+		ExecutablePath: field("GethExecutablePath"),
+		User:           field("GethUser"),
+		DataDir:        field("DataDir"),
+		SyncMode:       field("SyncMode"),
+	}, nil
+}
+
+// IPCPath returns location of IPC endpoint of geth.
+func (g Geth) IPCPath() string {
+	return filepath.Join(g.DataDir, "geth.ipc")
+}
+
+// SyncStatus asks geth over IPC whether it is syncing and how far it got.
+func (g Geth) SyncStatus() (SyncStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := rpc.DialContext(ctx, g.IPCPath())
+	if err != nil {
+		return SyncStatus{}, errors.New("Error while connecting to geth at " + g.IPCPath() + ": " + err.Error())
+	}
+	defer client.Close()
+	ec := ethclient.NewClient(client)
+
+	var status SyncStatus
+	progress, err := ec.SyncProgress(ctx)
+	if err != nil {
+		return SyncStatus{}, errors.New("Error while querying eth_syncing: " + err.Error())
+	}
+	if progress != nil {
+		status.Syncing = true
+		status.CurrentBlock = progress.CurrentBlock
+		status.HighestBlock = progress.HighestBlock
+		status.StartingBlock = progress.StartingBlock
+	} else {
+		status.CurrentBlock, err = ec.BlockNumber(ctx)
+		if err != nil {
+			return SyncStatus{}, errors.New("Error while querying eth_blockNumber: " + err.Error())
+		}
+		status.HighestBlock = status.CurrentBlock
+	}
+
+	var peers hexutil.Uint64
+	err = client.CallContext(ctx, &peers, "net_peerCount")
+	if err != nil {
+		return SyncStatus{}, errors.New("Error while querying net_peerCount: " + err.Error())
+	}
+	status.Peers = uint64(peers)
+	return status, nil
+}
+
+// DataDirSize returns total size of files in data directory of geth.
+func (g Geth) DataDirSize() (int64, error) {
+	var size int64
+	err := filepath.Walk(g.DataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Prune stops geth, prunes stale state from its data directory and starts it
+// again. Needs geth to keep a snapshot, which light clients do not.
+func (g Geth) Prune() error {
+	if g.SyncMode == "light" {
+		return errors.New("Geth of instance " + g.InstanceId + " runs in light mode, which keeps no state to prune")
+	}
+
+	usr, err := user.Lookup(g.User)
+	if err != nil {
+		return errors.New("Error while looking up user " + g.User + " geth runs as: " + err.Error())
+	}
+	cmd := exec.Command(g.ExecutablePath, "snapshot", "prune-state", "--datadir", g.DataDir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if strconv.Itoa(os.Geteuid()) != usr.Uid {
+		uid, _ := strconv.Atoi(usr.Uid)
+		gid, _ := strconv.Atoi(usr.Gid)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}}
+	}
+	if util.IsDryRun() {
+		util.SupervisorStop([]string{g.Program})
+		util.RecordPlanStep("prune geth state", g.DataDir, strings.Join(cmd.Args, " "))
+		return util.SupervisorStart([]string{g.Program})
+	}
+
+	errs := util.SupervisorStop([]string{g.Program})
+	if len(errs) != 0 {
+		return errors.New("Error while stopping geth: " + errs[0].Error())
+	}
+	log.Info("Pruning state of geth in ", g.DataDir, ", this may take hours")
+	pruneErr := cmd.Run()
+	err = util.SupervisorStart([]string{g.Program})
+	if pruneErr != nil {
+		return errors.New("Error while pruning geth state: " + pruneErr.Error())
+	}
+	return err
+}
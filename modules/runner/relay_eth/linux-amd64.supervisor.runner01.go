@@ -6,16 +6,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
-	"sync"
 	"text/template"
 	"time"
 
-	"github.com/hpcloud/tail"
+	"github.com/marlinprotocol/ctl2/modules/runner"
 	"github.com/marlinprotocol/ctl2/modules/util"
 	"github.com/marlinprotocol/ctl2/types"
 	log "github.com/sirupsen/logrus"
@@ -42,7 +40,6 @@ const (
 	runner01relayProgramName        = "relayeth"
 	runner01gethName                = "geth_linux-amd64"
 	runner01gethProgramName         = "geth"
-	runner01defaultUser             = "root"
 	runner01supervisorConfFiles     = "/etc/supervisor/conf.d"
 	runner01relaySupervisorConfFile = "relayeth"
 	runner01gethSupervisorConfFile  = "geth"
@@ -71,40 +68,16 @@ func (r *linux_amd64_supervisor_runner01) Download() error {
 	var relayethLocation = dirPath + "/" + runner01relayName
 	var gethLocation = dirPath + "/" + runner01gethName
 
-	if _, err := os.Stat(relayethLocation); os.IsNotExist(err) {
-		log.Info("Fetching relayeth from upstream for version ", r.Version)
-		util.DownloadFile(relayethLocation, r.RunnerData.Relay)
-	}
-	if !r.SkipChecksum {
-		err := util.VerifyChecksum(relayethLocation, r.RunnerData.RelayChecksum)
-		if err != nil {
-			return errors.New("Error while verifying relayeth checksum: " + err.Error())
-		} else {
-			log.Debug("Successully verified relayeth's integrity")
-		}
-	}
-
-	if _, err := os.Stat(gethLocation); os.IsNotExist(err) {
-		log.Info("Fetching geth from upstream for version ", r.Version)
-		util.DownloadFile(gethLocation, r.RunnerData.Geth)
-	}
-	if !r.SkipChecksum {
-		err := util.VerifyChecksum(gethLocation, r.RunnerData.GethChecksum)
-		if err != nil {
-			return errors.New("Error while verifying geth checksum: " + err.Error())
-		} else {
-			log.Debug("Successully verified geth's integrity")
-		}
-	}
-
-	err = os.Chmod(relayethLocation, 0755)
+	err = util.DownloadExecutable("relayeth", r.Version, r.RunnerData.Relay, r.SkipChecksum, r.RunnerData.RelayChecksum, relayethLocation)
 	if err != nil {
 		return err
 	}
-	err = os.Chmod(gethLocation, 0755)
+
+	err = util.DownloadExecutable("geth", r.Version, r.RunnerData.Geth, r.SkipChecksum, r.RunnerData.GethChecksum, gethLocation)
 	if err != nil {
 		return err
 	}
+
 	return nil
 }
 
@@ -121,19 +94,21 @@ func (r *linux_amd64_supervisor_runner01) Prepare() error {
 }
 
 func (r *linux_amd64_supervisor_runner01) Create(runtimeArgs map[string]string) error {
-	if _, err := os.Stat(GetResourceFileLocation(r.Storage, r.InstanceId)); err == nil {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
 		return errors.New("Resource file already exisits, cannot create a new instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
 	}
 
-	currentUser, err := util.GetUser()
+	serviceUser, err := util.GetServiceUser(runner01projectName)
 	if err != nil {
 		return err
 	}
 
 	substitutions := runner01resource{
 		"linux-amd64.supervisor.runner01", r.Version, time.Now().Format(time.RFC822Z),
-		runner01relayProgramName + r.InstanceId, currentUser.Username, currentUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner01relayName, "127.0.0.1:8002", "", "", "", "", "", "",
-		runner01gethProgramName + r.InstanceId, currentUser.Username, currentUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner01gethName, "light",
+		runner01relayProgramName + r.InstanceId, serviceUser.Username, serviceUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner01relayName, "127.0.0.1:8002", "", "", "", "", "", "",
+		runner01gethProgramName + r.InstanceId, serviceUser.Username, serviceUser.HomeDir, r.Storage + "/" + r.Version + "/" + runner01gethName, "light", DefaultGethPprofAddr, DefaultGethPort, DefaultGethPprofPort,
+		runner01logRootDir, util.DefaultLogMaxBytes, util.DefaultLogBackups, "false",
+		"", "", "", "", "", "", "",
 	}
 
 	for k, v := range runtimeArgs {
@@ -143,93 +118,63 @@ func (r *linux_amd64_supervisor_runner01) Create(runtimeArgs map[string]string)
 		}
 	}
 
-	log.Info("Running configuration")
-	util.PrettyPrintKVStruct(substitutions)
-
-	rt := template.Must(template.New("relay-eth-template").Parse(util.TrimSpacesEveryLine(`
-		[program:{{.RelayProgram}}]
-		process_name={{.RelayProgram}}
-		user={{.RelayUser}}
-		directory={{.RelayRunDir}}
-		command={{.RelayExecutablePath}} "{{.DiscoveryAddrs}}" "{{.HeartbeatAddrs}}" "{{.DataDir}}"{{if .PubsubPort}} --pubsub_port "{{.PubsubPort}}"{{end}}{{if .DiscoveryPort}} --discovery_port "{{.DiscoveryPort}}"{{end}}{{if .Address}} --address "{{.Address}}"{{end}}{{if .Name}} --name "{{.Name}}"{{end}} 
-		priority=100
-		numprocs=1
-		numprocs_start=1
-		autostart=true
-		autorestart=true
-	`)))
-	rFile, err := os.Create(runner01supervisorConfFiles + "/" + runner01relaySupervisorConfFile + r.InstanceId + ".conf")
-	if err != nil {
-		return err
+	if substitutions.GethPprofAddr == "" {
+		substitutions.GethPprofAddr = DefaultGethPprofAddr
 	}
-	if err := rt.Execute(rFile, substitutions); err != nil {
-		panic(err)
+	if substitutions.GethPort == "" {
+		substitutions.GethPort = DefaultGethPort
 	}
-	rFile.Close()
-
-	gt := template.Must(template.New("geth-template").Parse(util.TrimSpacesEveryLine(`
-		[program:{{.GethProgram}}]
-		process_name={{.GethProgram}}
-		user={{.GethUser}}
-		directory={{.GethRunDir}}
-		command={{.GethExecutablePath}} --nousb --syncmode={{.SyncMode}} --datadir={{.DataDir}} --metrics --pprof --pprof.addr "0.0.0.0"
-		priority=100
-		numprocs=1
-		numprocs_start=1
-		autostart=true
-		autorestart=true
-	`)))
-	gFile, err := os.Create(runner01supervisorConfFiles + "/" + runner01gethSupervisorConfFile + r.InstanceId + ".conf")
+	if substitutions.GethPprofPort == "" {
+		substitutions.GethPprofPort = DefaultGethPprofPort
+	}
+	err = ValidateGethArgs(substitutions.GethExecutablePath, substitutions.SyncMode, substitutions.GethPprofAddr)
 	if err != nil {
 		return err
 	}
-	if err := gt.Execute(gFile, substitutions); err != nil {
-		panic(err)
-	}
-	gFile.Close()
 
-	_, err = exec.Command("supervisorctl", "reread").Output()
+	err = util.ApplyLimits(&substitutions, serviceUser)
 	if err != nil {
-		return errors.New("Error while supervisorctl reread: " + err.Error())
+		return err
 	}
 
-	_, err = exec.Command("supervisorctl", "update").Output()
+	tx := &runner.Transaction{}
+	err = tx.Preserve(util.LogRotateConfLocation(runner01projectName + "_" + r.InstanceId))
 	if err != nil {
-		return errors.New("Error while supervisorctl update: " + err.Error())
+		return err
 	}
-
-	_, err = exec.Command("supervisorctl", "start", substitutions.RelayProgram).Output()
+	err = util.ApplyLogConfig(runner01projectName+"_"+r.InstanceId, []string{substitutions.RelayProgram, substitutions.GethProgram}, &substitutions)
 	if err != nil {
-		return errors.New("Error while starting relayeth: " + err.Error())
+		return tx.Rollback(err)
 	}
-	log.Debug("Trigerred relayeth run")
 
-	log.Info("Waiting 10 seconds to poll for status")
-	time.Sleep(10 * time.Second)
+	log.Info("Running configuration")
+	util.PrettyPrintKVStruct(substitutions)
 
-	status, err := exec.Command("supervisorctl", "status").Output()
+	err = util.CheckListenAddresses(GetResourceFileLocation(r.Storage, r.InstanceId), substitutions)
 	if err != nil {
-		log.Warning("Error while reading supervisor status: " + err.Error())
+		return tx.Rollback(err)
 	}
-	var supervisorStatus = make(map[string]interface{})
 
-	statusLines := strings.Split(string(status), "\n")
-	var anyStatusLine = false
-	for _, v := range statusLines {
-		if match, err := regexp.MatchString(substitutions.RelayProgram+"|"+substitutions.GethProgram, v); err == nil && match {
-			vSplit := strings.Split(v, " ")
-			supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-			anyStatusLine = true
+	for _, conf := range r.supervisorConfs() {
+		err = tx.WriteSupervisorConf(conf, substitutions)
+		if err != nil {
+			return tx.Rollback(err)
 		}
 	}
-	if !anyStatusLine {
-		log.Info("No proceses seem to be running")
-	} else {
-		log.Info("Process status")
-		util.PrettyPrintKVMap(supervisorStatus)
-	}
-	r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
 
+	err = tx.SupervisorStart([]string{substitutions.RelayProgram})
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	util.SupervisorStatusBestEffort([]string{substitutions.RelayProgram, substitutions.GethProgram})
+	err = tx.Do("write resource file", func() error {
+		return r.writeResourceToFile(substitutions, GetResourceFileLocation(r.Storage, r.InstanceId))
+	}, func() error {
+		return util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
+	})
+	if err != nil {
+		return tx.Rollback(err)
+	}
 	return nil
 }
 
@@ -242,14 +187,8 @@ func (r *linux_amd64_supervisor_runner01) Restart() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
 
-	_, err1 := exec.Command("supervisorctl", "restart", resData.RelayProgram).Output()
-	_, err2 := exec.Command("supervisorctl", "restart", resData.GethProgram).Output()
-
-	if err1 == nil && err2 == nil {
-		log.Info("Triggered restart")
-	} else {
-		log.Warning("Triggered restart, however supervisor did return some errors. ", err1.Error(), " ", err2.Error())
-	}
+	util.SupervisorRestartProgramBestEffort("relay", resData.RelayProgram)
+	util.SupervisorRestartProgramBestEffort("geth", resData.GethProgram)
 
 	return nil
 }
@@ -262,16 +201,6 @@ func (r *linux_amd64_supervisor_runner01) Recreate() error {
 	if !available {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return status.")
 	}
-	err = r.Destroy()
-	if err != nil {
-		return err
-	}
-
-	err = r.PostRun()
-	if err != nil {
-		return err
-	}
-
 	err = r.Prepare()
 	if err != nil {
 		return err
@@ -288,11 +217,9 @@ func (r *linux_amd64_supervisor_runner01) Recreate() error {
 		}
 	}
 
-	err = r.Create(runtimeArgs)
-	if err != nil {
-		return err
-	}
-	return nil
+	return runner.Replace(r, func() error {
+		return r.Create(runtimeArgs)
+	})
 }
 
 func (r *linux_amd64_supervisor_runner01) Destroy() error {
@@ -304,26 +231,10 @@ func (r *linux_amd64_supervisor_runner01) Destroy() error {
 		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't destroy")
 	}
 
-	returned, err := exec.Command("supervisorctl", "stop", resData.RelayProgram).Output()
-	if err != nil {
-		alreadyDead, err2 := regexp.MatchString("not running", string(returned))
-		if !alreadyDead || err2 != nil {
-			return errors.New("Error while stopping relayeth: " + err.Error())
-		}
-	}
-	log.Debug("Trigerred relayeth stop")
-
-	returned, err = exec.Command("supervisorctl", "stop", resData.GethProgram).Output()
-	if err != nil {
-		alreadyDead, err2 := regexp.MatchString("not running", string(returned))
-		if !alreadyDead || err2 != nil {
-			return errors.New("Error while stopping geth: " + err.Error())
-		}
+	errs := util.SupervisorStop([]string{resData.RelayProgram, resData.GethProgram})
+	if len(errs) != 0 {
+		return errors.New(fmt.Sprintf("Error while stopping programs %v", errs))
 	}
-	log.Debug("Trigerred geth stop")
-
-	log.Info("Waiting 5 seconds for SIGTERM to take effect")
-	time.Sleep(5 * time.Second)
 
 	return nil
 }
@@ -332,16 +243,12 @@ func (r *linux_amd64_supervisor_runner01) PostRun() error {
 	var relayethConfig = runner01supervisorConfFiles + "/" + runner01relaySupervisorConfFile + r.InstanceId + ".conf"
 	var gethConfig = runner01supervisorConfFiles + "/" + runner01gethSupervisorConfFile + r.InstanceId + ".conf"
 
-	if _, err := os.Stat(relayethConfig); !os.IsNotExist(err) {
-		if err := os.Remove(relayethConfig); err != nil {
-			return err
-		}
+	if err := util.RemoveFileIfExists(relayethConfig); err != nil {
+		return err
 	}
 
-	if _, err := os.Stat(gethConfig); !os.IsNotExist(err) {
-		if err := os.Remove(gethConfig); err != nil {
-			return err
-		}
+	if err := util.RemoveFileIfExists(gethConfig); err != nil {
+		return err
 	}
 
 	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
@@ -357,11 +264,12 @@ func (r *linux_amd64_supervisor_runner01) PostRun() error {
 		return err
 	}
 
-	err = filepath.Walk(runner01logRootDir, func(path string, f os.FileInfo, _ error) error {
+	logDir := util.LogDirOrDefault(resData.LogDir)
+	err = filepath.Walk(logDir, func(path string, f os.FileInfo, _ error) error {
 		if !f.IsDir() {
 			r, err := regexp.MatchString(resData.RelayProgram+".*|"+resData.GethProgram+".*", f.Name())
 			if err == nil && r {
-				err2 := os.Rename(runner01logRootDir+"/"+f.Name(), runner01oldLogRootDir+"/previous_run_"+f.Name())
+				err2 := util.MoveFile(logDir+"/"+f.Name(), runner01oldLogRootDir+"/previous_run_"+f.Name())
 				if err2 != nil {
 					return err2
 				}
@@ -376,17 +284,16 @@ func (r *linux_amd64_supervisor_runner01) PostRun() error {
 		return errors.New("Error while marking logs as old: " + err.Error())
 	}
 
-	_, err = exec.Command("supervisorctl", "reread").Output()
-	if err != nil {
-		return errors.New("Error while supervisorctl reread: " + err.Error())
+	if err := util.RemoveLogRotateConf(runner01projectName + "_" + r.InstanceId); err != nil {
+		return err
 	}
 
-	_, err = exec.Command("supervisorctl", "update").Output()
+	err = util.SupervisorRereadUpdate()
 	if err != nil {
-		return errors.New("Error while supervisorctl update: " + err.Error())
+		return err
 	}
 
-	err = os.Remove(GetResourceFileLocation(r.Storage, r.InstanceId))
+	err = util.RemoveFileIfExists(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
 		return errors.New("Error while removing resource file: " + err.Error())
 	}
@@ -415,84 +322,110 @@ func (r *linux_amd64_supervisor_runner01) Status() error {
 	log.Info("Resource information")
 	util.PrettyPrintKVStruct(resData)
 
-	status, _ := exec.Command("supervisorctl", "status").Output()
-	// if err != nil {
-	// 	return errors.New("Error while reading supervisor status: " + err.Error())
-	// }
+	util.SupervisorStatusBestEffort([]string{resData.RelayProgram, resData.GethProgram})
 
-	var supervisorStatus = make(map[string]interface{})
+	return nil
+}
 
-	statusLines := strings.Split(string(status), "\n")
-	var anyStatusLine = false
-	for _, v := range statusLines {
-		if match, err := regexp.MatchString(runner01relayProgramName+r.InstanceId+"|"+runner01gethProgramName+r.InstanceId, v); err == nil && match {
-			vSplit := strings.Split(v, " ")
-			supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-			anyStatusLine = true
-		}
+func (r *linux_amd64_supervisor_runner01) Health(options runner.HealthOptions) (runner.HealthReport, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
+	if err != nil {
+		return runner.HealthReport{}, err
 	}
-	if !anyStatusLine {
-		log.Info("No proceses seem to be running")
-	} else {
-		log.Info("Process status")
-		util.PrettyPrintKVMap(supervisorStatus)
+	if !available {
+		return runner.HealthReport{}, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't return health.")
 	}
 
-	return nil
+	return runner.GetHealth([]string{resData.RelayProgram, resData.GethProgram}, resData, options), nil
 }
 
-func (r *linux_amd64_supervisor_runner01) Logs(lines int) error {
+func (r *linux_amd64_supervisor_runner01) LogSources() ([]runner.LogSource, error) {
 	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !available {
-		return errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exists. Can't tail logs")
 	}
-	// Check for resource
-	fileSubscriptions := make(map[string]string)
-	var runner01logRootDir = "/var/log/supervisor/"
-	err = filepath.Walk(runner01logRootDir, func(path string, f os.FileInfo, _ error) error {
-		if !f.IsDir() {
-			for _, v := range []string{resData.RelayProgram + "-stdout.*",
-				resData.RelayProgram + "-stderr.*",
-				resData.GethProgram + "-stdout.*",
-				resData.GethProgram + "-stderr.*"} {
-				r, err := regexp.MatchString(v, f.Name())
-				if err == nil && r {
-					fileSubscriptions[v[:len(v)-2]] = runner01logRootDir + f.Name()
-				}
-			}
-		}
-		return nil
-	})
+
+	return runner.GetLogSources(util.LogDirOrDefault(resData.LogDir), map[string]string{"relay": resData.RelayProgram, "geth": resData.GethProgram}), nil
+}
+
+func (r *linux_amd64_supervisor_runner01) SupervisorConfs() (map[string]string, error) {
+	available, resData, err := r.fetchResourceInformation(GetResourceFileLocation(r.Storage, r.InstanceId))
 	if err != nil {
-		return nil
+		return nil, err
+	}
+	if !available {
+		return nil, errors.New("resource by id " + r.InstanceId + " doesn't exist. Can't render supervisor confs.")
 	}
 
-	var wg sync.WaitGroup
-	for k, v := range fileSubscriptions {
-		wg.Add(1)
-		go func(filename string, filelocation string) {
-			seeklocation := util.GetFileSeekOffsetLastNLines(filelocation, lines)
-			t, err := tail.TailFile(filelocation, tail.Config{Location: &tail.SeekInfo{Offset: seeklocation}, Follow: true, Logger: tail.DiscardingLogger})
-			if err != nil {
-				fmt.Println(err)
-			}
-			for line := range t.Lines {
-				log.Info(fmt.Sprintf("[%20s] ", filename) + line.Text)
-			}
-			wg.Done()
-		}(k, v)
+	return runner.RenderSupervisorConfs(r.supervisorConfs(), &resData)
+}
+
+func (r *linux_amd64_supervisor_runner01) Adopt(sections map[string]map[string]string) ([]string, error) {
+	if util.FileExists(GetResourceFileLocation(r.Storage, r.InstanceId)) {
+		return nil, errors.New("Resource file already exisits, cannot adopt into instance: " + GetResourceFileLocation(r.Storage, r.InstanceId))
+	}
+
+	resData := runner01resource{Runner: "linux-amd64.supervisor.runner01", Version: r.Version, StartTime: time.Now().Format(time.RFC822Z)}
+	unmapped, err := runner.AdoptSupervisorPrograms(r.supervisorConfs(), &resData, sections)
+	if err != nil {
+		return nil, err
+	}
+	util.FillLogConfigDefaults(&resData)
+
+	return unmapped, r.writeResourceToFile(resData, GetResourceFileLocation(r.Storage, r.InstanceId))
+}
+
+func (r *linux_amd64_supervisor_runner01) ManagedFiles() []string {
+	files := []string{GetResourceFileLocation(r.Storage, r.InstanceId), util.LogRotateConfLocation(runner01projectName + "_" + r.InstanceId)}
+	for _, conf := range r.supervisorConfs() {
+		files = append(files, conf.Location)
+	}
+	return files
+}
+
+func (r *linux_amd64_supervisor_runner01) supervisorConfs() []runner.SupervisorConf {
+	rt := template.Must(template.New("relay-eth-template").Parse(util.TrimSpacesEveryLine(`
+		[program:{{.RelayProgram}}]
+		process_name={{.RelayProgram}}
+		user=` + util.SupervisorUser("RelayUser") + `
+		directory={{.RelayRunDir}}
+		command=` + util.SupervisorCommandPrefix("RelayUser") + `{{.RelayExecutablePath}} "{{.DiscoveryAddrs}}" "{{.HeartbeatAddrs}}" "{{.DataDir}}"{{if .PubsubPort}} --pubsub_port "{{.PubsubPort}}"{{end}}{{if .DiscoveryPort}} --discovery_port "{{.DiscoveryPort}}"{{end}}{{if .Address}} --address "{{.Address}}"{{end}}{{if .Name}} --name "{{.Name}}"{{end}} ` + util.SupervisorEnvironmentTemplate + `
+		priority=100
+		numprocs=1
+		numprocs_start=1
+		autostart=true
+		autorestart=true
+		` + util.SupervisorLogTemplate("RelayProgram") + `
+	`)))
+	gt := template.Must(template.New("geth-template").Parse(util.TrimSpacesEveryLine(`
+		[program:{{.GethProgram}}]
+		process_name={{.GethProgram}}
+		user=` + util.SupervisorUser("GethUser") + `
+		directory={{.GethRunDir}}
+		command=` + util.SupervisorCommandPrefix("GethUser") + `{{.GethExecutablePath}} --nousb --syncmode={{.SyncMode}} --datadir={{.DataDir}}{{if .GethPort}} --port {{.GethPort}}{{end}} --metrics --pprof --pprof.addr "{{if .GethPprofAddr}}{{.GethPprofAddr}}{{else}}0.0.0.0{{end}}"{{if .GethPprofPort}} --pprof.port {{.GethPprofPort}}{{end}}` + util.SupervisorEnvironmentTemplate + `
+		priority=100
+		numprocs=1
+		numprocs_start=1
+		autostart=true
+		autorestart=true
+		` + util.SupervisorLogTemplate("GethProgram") + `
+	`)))
+
+	return []runner.SupervisorConf{
+		{Location: runner01supervisorConfFiles + "/" + runner01relaySupervisorConfFile + r.InstanceId + ".conf", Template: rt},
+		{Location: runner01supervisorConfFiles + "/" + runner01gethSupervisorConfFile + r.InstanceId + ".conf", Template: gt},
 	}
-	wg.Wait()
-	return nil
 }
 
 type runner01resource struct {
 	Runner, Version, StartTime                                                                                                                   string
 	RelayProgram, RelayUser, RelayRunDir, RelayExecutablePath, DiscoveryAddrs, HeartbeatAddrs, DataDir, PubsubPort, DiscoveryPort, Address, Name string
-	GethProgram, GethUser, GethRunDir, GethExecutablePath, SyncMode                                                                              string
+	GethProgram, GethUser, GethRunDir, GethExecutablePath, SyncMode, GethPprofAddr, GethPort, GethPprofPort                                      string
+	LogDir, LogMaxBytes, LogBackups, LogCompress                                                                                                 string
+	MemoryLimit, CPUQuota, NofileLimit, Nice, IONice, Environment, SecretEnvFile                                                                 string
 }
 
 func (r *linux_amd64_supervisor_runner01) fetchResourceInformation(fileLocation string) (bool, runner01resource, error) {
@@ -527,5 +460,5 @@ func (r *linux_amd64_supervisor_runner01) writeResourceToFile(resData runner01re
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(fileLocation, fileData, 0644)
+	return util.WriteFile(fileLocation, fileData, 0644)
 }
@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+)
+
+func instanceResourceLocation(storage string, projectID string, instanceId string) string {
+	return storage + "/common/project_" + projectID + "_instance" + instanceId + ".resource"
+}
+
+func readInstanceResource(storage string, projectID string, instanceId string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(instanceResourceLocation(storage, projectID, instanceId))
+	if err != nil {
+		return nil, err
+	}
+	resData := make(map[string]interface{})
+	err = json.Unmarshal(data, &resData)
+	if err != nil {
+		return nil, errors.New("Error while reading resource file: " + err.Error())
+	}
+	return resData, nil
+}
+
+// UpdateResource adds steps to tx which set fields of resource file of
+// instance run by r to changes and render its supervisor confs again.
+// Callers preserve files managed by r beforehand.
+func UpdateResource(tx *Transaction, r Runner, resourceFile string, changes map[string]interface{}) error {
+	err := tx.Do("write resource file", func() error {
+		data, err := ioutil.ReadFile(resourceFile)
+		if err != nil {
+			return err
+		}
+		resData := make(map[string]interface{})
+		err = json.Unmarshal(data, &resData)
+		if err != nil {
+			return errors.New("Error while reading resource file: " + err.Error())
+		}
+		for k, v := range changes {
+			resData[k] = v
+		}
+		fileData, err := json.MarshalIndent(resData, "", " ")
+		if err != nil {
+			return err
+		}
+		return util.WriteFile(resourceFile, fileData, 0644)
+	}, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Do("write supervisor confs", func() error {
+		confs, err := r.SupervisorConfs()
+		if err != nil {
+			return err
+		}
+		for location, conf := range confs {
+			if err := util.WriteFile(location, []byte(conf), 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// SetKeystorePassPath makes instance of project run by r read passphrase of
+// its keystore from passPath, rewriting its resource file and supervisor
+// confs. Files are restored if any of them cannot be written. Supervisor is
+// left for the caller to update.
+func SetKeystorePassPath(r Runner, storage string, projectID string, instanceId string, passPath string) error {
+	tx := &Transaction{}
+	err := tx.Preserve(r.ManagedFiles()...)
+	if err != nil {
+		return err
+	}
+	err = UpdateResource(tx, r, instanceResourceLocation(storage, projectID, instanceId), map[string]interface{}{"KeystorePassPath": passPath})
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	return nil
+}
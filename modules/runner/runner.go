@@ -10,5 +10,9 @@ type Runner interface {
 	Destroy() error
 	PostRun() error
 	Status() error
-	Logs(lines int) error
+	Health(options HealthOptions) (HealthReport, error)
+	LogSources() ([]LogSource, error)
+	SupervisorConfs() (map[string]string, error)
+	Adopt(sections map[string]map[string]string) ([]string, error)
+	ManagedFiles() []string
 }
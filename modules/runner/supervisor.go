@@ -0,0 +1,29 @@
+package runner
+
+import (
+	"text/template"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+)
+
+// SupervisorConf is a supervisor conf file written by a runner along with
+// template rendering it from resource of an instance.
+type SupervisorConf struct {
+	Location string
+	Template *template.Template
+}
+
+// RenderSupervisorConfs renders supervisor confs from resource pointed to by
+// resData the same way runner's Create renders them, keyed by location.
+func RenderSupervisorConfs(confs []SupervisorConf, resData interface{}) (map[string]string, error) {
+	util.FillLogConfigDefaults(resData)
+	rendered := make(map[string]string)
+	for _, conf := range confs {
+		data, err := util.RenderSupervisorConf(conf.Template, resData)
+		if err != nil {
+			return nil, err
+		}
+		rendered[conf.Location] = string(data)
+	}
+	return rendered, nil
+}
@@ -0,0 +1,222 @@
+package runner
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/marlinprotocol/ctl2/modules/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const rolledBack = "; all changes were rolled back"
+
+// oldLogRootDir is where runners move logs of instances they remove, with a
+// previous_run_ prefix.
+const oldLogRootDir = "/var/log/old_logs"
+
+// Transaction records steps of a lifecycle operation so that everything done
+// so far can be undone if a later step fails.
+type Transaction struct {
+	steps []transactionStep
+}
+
+type transactionStep struct {
+	description string
+	undo        func() error
+}
+
+// Do runs a step of transaction. Undo is recorded before step runs, so that
+// a step which fails half way is undone as well.
+func (t *Transaction) Do(description string, do func() error, undo func() error) error {
+	if undo != nil {
+		t.steps = append(t.steps, transactionStep{description, undo})
+	}
+	err := do()
+	if err != nil {
+		return errors.New("Error while trying to " + description + ": " + err.Error())
+	}
+	return nil
+}
+
+// Preserve records current contents of files, which are put back in place on
+// rollback. Files which do not exist are removed on rollback.
+func (t *Transaction) Preserve(locations ...string) error {
+	contents := make(map[string][]byte)
+	modes := make(map[string]os.FileMode)
+	var supervisorConfs bool
+	for _, location := range locations {
+		if strings.HasPrefix(location, util.SupervisorConfDir+"/") {
+			supervisorConfs = true
+		}
+		stat, err := os.Stat(location)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.New("Error while reading " + location + ": " + err.Error())
+		}
+		data, err := ioutil.ReadFile(location)
+		if err != nil {
+			return errors.New("Error while reading " + location + ": " + err.Error())
+		}
+		contents[location], modes[location] = data, stat.Mode().Perm()
+	}
+
+	t.steps = append(t.steps, transactionStep{"restore " + strings.Join(locations, ", "), func() error {
+		for _, location := range locations {
+			var err error
+			if data, ok := contents[location]; ok {
+				err = util.WriteFile(location, data, modes[location])
+			} else {
+				err = util.RemoveFileIfExists(location)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if supervisorConfs {
+			return util.SupervisorRereadUpdate()
+		}
+		return nil
+	}})
+	return nil
+}
+
+// WriteSupervisorConf renders conf from data and writes it, putting back
+// whatever was at its location on rollback.
+func (t *Transaction) WriteSupervisorConf(conf SupervisorConf, data interface{}) error {
+	rendered, err := util.RenderSupervisorConf(conf.Template, data)
+	if err != nil {
+		return err
+	}
+	err = t.Preserve(conf.Location)
+	if err != nil {
+		return err
+	}
+	return t.Do("write supervisor conf "+conf.Location, func() error {
+		return util.WriteFile(conf.Location, rendered, 0644)
+	}, nil)
+}
+
+// SupervisorStart starts programs, stopping them again on rollback.
+func (t *Transaction) SupervisorStart(programs []string) error {
+	return t.Do("start "+strings.Join(programs, ", "), func() error {
+		return util.SupervisorStart(programs)
+	}, func() error {
+		if errs := util.SupervisorStop(programs); len(errs) != 0 {
+			return errs[0]
+		}
+		return nil
+	})
+}
+
+// Rollback undoes recorded steps in reverse order and returns cause along
+// with anything which could not be undone.
+func (t *Transaction) Rollback(cause error) error {
+	var failures []string
+	for i := len(t.steps) - 1; i >= 0; i-- {
+		log.Warning("Rolling back: ", t.steps[i].description)
+		if err := t.steps[i].undo(); err != nil {
+			failures = append(failures, t.steps[i].description+": "+err.Error())
+		}
+	}
+	t.steps = nil
+	if len(failures) != 0 {
+		return errors.New(cause.Error() + "; rollback incomplete, inspect manually: " + strings.Join(failures, "; "))
+	}
+	if strings.HasSuffix(cause.Error(), rolledBack) {
+		return cause
+	}
+	return errors.New(cause.Error() + rolledBack)
+}
+
+// Replace replaces instance run by old using create, typically creating it
+// again with a different version or configuration. If any step fails, files
+// of old instance are restored and its programs started again.
+func Replace(old Runner, create func() error) error {
+	confs, err := old.SupervisorConfs()
+	if err != nil {
+		return err
+	}
+	var programs []string
+	for _, conf := range confs {
+		for prg := range ParseSupervisorSections(conf) {
+			programs = append(programs, prg)
+		}
+	}
+	sort.Strings(programs)
+
+	tx := &Transaction{}
+	err = tx.Do("stop programs", old.Destroy, func() error {
+		return util.SupervisorStart(programs)
+	})
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	err = tx.Preserve(old.ManagedFiles()...)
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	logFiles, err := listLogFiles(old)
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	err = tx.Do("remove instance", old.PostRun, func() error {
+		return restoreOldLogs(logFiles)
+	})
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	err = tx.Do("create instance", create, nil)
+	if err != nil {
+		return tx.Rollback(err)
+	}
+	return nil
+}
+
+// listLogFiles lists files in log directories of instance run by r, which
+// its PostRun may move to oldLogRootDir.
+func listLogFiles(r Runner) ([]string, error) {
+	sources, err := r.LogSources()
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]bool)
+	var files []string
+	for _, s := range sources {
+		dir := filepath.Dir(s.Path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.New("Error while listing logs: " + err.Error())
+		}
+		for _, info := range infos {
+			if info.Mode().IsRegular() {
+				files = append(files, dir+"/"+info.Name())
+			}
+		}
+	}
+	return files, nil
+}
+
+// restoreOldLogs moves log files back from oldLogRootDir where PostRun put
+// them.
+func restoreOldLogs(files []string) error {
+	for _, f := range files {
+		moved := oldLogRootDir + "/previous_run_" + filepath.Base(f)
+		if util.FileExists(f) || !util.FileExists(moved) {
+			continue
+		}
+		err := util.MoveFile(moved, f)
+		if err != nil {
+			return errors.New("Error while restoring log " + f + ": " + err.Error())
+		}
+	}
+	return nil
+}
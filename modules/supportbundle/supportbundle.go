@@ -0,0 +1,297 @@
+package supportbundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marlinprotocol/ctl2/modules/keystore"
+	"github.com/marlinprotocol/ctl2/modules/projects"
+	"github.com/marlinprotocol/ctl2/modules/registry"
+	"github.com/marlinprotocol/ctl2/modules/util"
+	"github.com/marlinprotocol/ctl2/version"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const redacted = "REDACTED"
+
+var (
+	secretKeyRegex    = regexp.MustCompile(`(?i)(pass|secret|token|private|mnemonic|credential|api_?key)`)
+	urlRegex          = regexp.MustCompile(`\b([a-zA-Z][a-zA-Z0-9+.-]*://)([^/\s"'@]+@)?([^/\s"'?#]+)([^\s"'?#]*)(\?[^\s"'#]*)?`)
+	tokenSegmentRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+	privateKeyRegex   = regexp.MustCompile(`\b(0x)?[0-9a-fA-F]{64}\b`)
+)
+
+type Options struct {
+	ProjectID  string
+	InstanceID string
+	LogLines   int
+}
+
+type bundle struct {
+	contents map[string][]byte
+	excluded map[string]bool
+}
+
+// Create writes a support bundle holding marlinctl state, resources, their
+// supervisor configuration and logs along with details of host into a
+// gzipped tarball. Values which look like secrets are redacted and keystore
+// passphrase files are never included.
+func Create(output string, options Options) error {
+	instances, err := projects.GetInstances()
+	if err != nil {
+		return errors.New("Error while listing instances: " + err.Error())
+	}
+	var selected []projects.Instance
+	for _, instance := range instances {
+		if (options.ProjectID == "" || instance.ProjectID == options.ProjectID) &&
+			(options.InstanceID == "" || instance.InstanceID == options.InstanceID) {
+			selected = append(selected, instance)
+		}
+	}
+	if len(selected) == 0 && (options.ProjectID != "" || options.InstanceID != "") {
+		return errors.New("No instances match given project and instance id")
+	}
+
+	b := bundle{make(map[string][]byte), passphraseFiles(instances)}
+	b.add("marlinctl.txt", []byte(marlinctlInfo()))
+	b.add("host.txt", []byte(hostInfo()))
+	b.add("supervisorctl_status.txt", commandOutput("supervisorctl", "status"))
+
+	state, err := yaml.Marshal(redact("", viper.AllSettings()))
+	if err != nil {
+		return errors.New("Error while encoding state: " + err.Error())
+	}
+	b.add("state.yaml", state)
+
+	confs := util.SupervisorConfPrograms()
+	for _, instance := range selected {
+		prefix := "projects/" + instance.ProjectID + "/" + instance.InstanceID + "/"
+		resource, err := json.MarshalIndent(redact("", instance.Resource), "", " ")
+		if err == nil {
+			b.add(prefix+filepath.Base(instance.ResourceFile), resource)
+		}
+		for _, prg := range instance.Programs() {
+			if conf, ok := confs[prg]; ok {
+				if data, err := b.readFile(conf, 0); err == nil {
+					b.add(prefix+"supervisor/"+filepath.Base(conf), []byte(redactText(string(data))))
+				}
+			}
+		}
+		b.addLogs(prefix+"logs/", instance, options.LogLines)
+		b.add(prefix+"checksums.txt", []byte(checksumReport(instance)))
+	}
+
+	return util.WriteTarGz(output, nil, b.contents)
+}
+
+func (b *bundle) add(name string, data []byte) {
+	b.contents[name] = data
+}
+
+func (b *bundle) addLogs(prefix string, instance projects.Instance, lines int) {
+	r, err := instance.Runner()
+	if err != nil {
+		b.add(prefix+"error.txt", []byte(err.Error()+"\n"))
+		return
+	}
+	sources, err := r.LogSources()
+	if err != nil {
+		b.add(prefix+"error.txt", []byte(err.Error()+"\n"))
+		return
+	}
+	for _, s := range sources {
+		data, err := b.readFile(s.Path, lines)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Warning("Skipping log ", s.Path, ": ", err)
+			}
+			continue
+		}
+		b.add(prefix+filepath.Base(s.Path), []byte(redactText(string(data))))
+	}
+}
+
+// readFile reads a file, or its last lines if lines is positive. Keystore
+// passphrase files are refused no matter how they were reached.
+func (b *bundle) readFile(location string, lines int) ([]byte, error) {
+	if b.excluded[location] || strings.HasSuffix(location, "-pass") {
+		return nil, errors.New("Refusing to read passphrase file " + location)
+	}
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if lines > 0 {
+		_, err = file.Seek(util.GetFileSeekOffsetLastNLines(location, lines), io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.ReadAll(file)
+}
+
+// passphraseFiles lists keystore passphrase files known to marlinctl, both
+// from project keystores and from resources referring to them.
+func passphraseFiles(instances []projects.Instance) map[string]bool {
+	excluded := make(map[string]bool)
+	var keystoreDirs []string
+	for _, projectID := range projects.GetProjectIDs() {
+		if keystoreDir, err := keystore.Dir(projectID); err == nil {
+			keystoreDirs = append(keystoreDirs, keystoreDir)
+		}
+	}
+	names, _ := keystore.SharedNames()
+	for _, name := range names {
+		if keystoreDir, err := keystore.SharedDir(name); err == nil {
+			keystoreDirs = append(keystoreDirs, keystoreDir)
+		}
+	}
+	for _, keystoreDir := range keystoreDirs {
+		for _, acc := range keystore.ListAccounts(keystoreDir) {
+			excluded[acc.PassPath] = true
+		}
+	}
+	for _, instance := range instances {
+		for k, v := range instance.Resource {
+			if location, ok := v.(string); ok && strings.HasSuffix(k, "PassPath") && location != "" {
+				excluded[location] = true
+			}
+		}
+	}
+	return excluded
+}
+
+func checksumReport(instance projects.Instance) string {
+	version := instance.GetString("Version")
+	report := "Version: " + version + "\n"
+	projectVersion, err := registry.GlobalRegistry.GetVersionToRun(instance.ProjectID, "", version)
+	if err != nil {
+		return report + "Registry lookup failed: " + err.Error() + "\n"
+	}
+	results := instance.VerifyChecksums(projectVersion.RunnerData)
+	executables := instance.Executables()
+	var names []string
+	for name := range executables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result, ok := results[name]
+		status := "OK"
+		if !ok {
+			status = "NO CHECKSUM IN REGISTRY"
+		} else if result != nil {
+			status = "MISMATCH: " + result.Error()
+		}
+		report += fmt.Sprintf("%s %s %s\n", name, executables[name], status)
+	}
+	return report
+}
+
+func marlinctlInfo() string {
+	return "marlinctl " + version.RootCmdVersion + "\n" +
+		"Config file: " + viper.ConfigFileUsed() + "\n" +
+		"Bundle created: " + time.Now().Format(time.RFC3339) + "\n"
+}
+
+func hostInfo() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "GOOS/GOARCH: %s/%s\nCPUs: %d\n", runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	for _, section := range []struct {
+		title string
+		data  []byte
+	}{
+		{"uname -a", commandOutput("uname", "-a")},
+		{"/etc/os-release", readFileOrError("/etc/os-release")},
+		{"ulimit -a", commandOutput("/bin/sh", "-c", "ulimit -a")},
+		{"df -h", commandOutput("df", "-h")},
+		{"free -m", commandOutput("free", "-m")},
+	} {
+		fmt.Fprintf(&b, "\n== %s ==\n%s", section.title, section.data)
+	}
+	return b.String()
+}
+
+func commandOutput(name string, args ...string) []byte {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		out = append(out, []byte("error: "+err.Error()+"\n")...)
+	}
+	return out
+}
+
+func readFileOrError(location string) []byte {
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return []byte("error: " + err.Error() + "\n")
+	}
+	return data
+}
+
+// redact replaces values held under keys which look like secrets and
+// credentials embedded in text of every other value.
+func redact(key string, v interface{}) interface{} {
+	ref := reflect.ValueOf(v)
+	switch ref.Kind() {
+	case reflect.Map:
+		redactedMap := make(map[string]interface{})
+		for _, k := range ref.MapKeys() {
+			name := fmt.Sprint(k.Interface())
+			redactedMap[name] = redact(name, ref.MapIndex(k).Interface())
+		}
+		return redactedMap
+	case reflect.Slice:
+		redactedSlice := []interface{}{}
+		for i := 0; i < ref.Len(); i++ {
+			redactedSlice = append(redactedSlice, redact(key, ref.Index(i).Interface()))
+		}
+		return redactedSlice
+	case reflect.String:
+		if secretKeyRegex.MatchString(key) && ref.String() != "" {
+			return redacted
+		}
+		return redactText(ref.String())
+	default:
+		return v
+	}
+}
+
+// redactText strips credentials, query strings and token like path segments
+// (such as API keys of RPC providers) from URLs, and hex strings long enough
+// to be private keys.
+func redactText(text string) string {
+	text = urlRegex.ReplaceAllStringFunc(text, func(u string) string {
+		m := urlRegex.FindStringSubmatch(u)
+		segments := strings.Split(m[4], "/")
+		for i, s := range segments {
+			if tokenSegmentRegex.MatchString(s) {
+				segments[i] = redacted
+			}
+		}
+		result := m[1]
+		if m[2] != "" {
+			result += redacted + "@"
+		}
+		result += m[3] + strings.Join(segments, "/")
+		if m[5] != "" {
+			result += "?" + redacted
+		}
+		return result
+	})
+	return privateKeyRegex.ReplaceAllString(text, redacted)
+}
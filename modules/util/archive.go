@@ -0,0 +1,95 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// WriteTarGz writes files, given as a map from name within archive to
+// location on disk, and contents generated in memory into a gzipped tarball.
+// Files which do not exist are skipped. Files growing while being archived,
+// such as logs of running programs, are cut at the size they had when
+// archiving started.
+func WriteTarGz(output string, files map[string]string, contents map[string][]byte) error {
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := addFileToTar(tw, name, files[name])
+		if err != nil {
+			return errors.New("Error while archiving " + files[name] + ": " + err.Error())
+		}
+	}
+
+	names = nil
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(contents[name])),
+			ModTime: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(contents[name])
+		if err != nil {
+			return errors.New("Error while archiving " + name + ": " + err.Error())
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func addFileToTar(tw *tar.Writer, name string, location string) error {
+	file, err := os.Open(location)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !stat.Mode().IsRegular() {
+		return nil
+	}
+	header, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	err = tw.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, file, stat.Size())
+	return err
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseEnv parses KEY=VALUE pairs, one per line, as found in env files.
+// Blank lines, comments and export keywords are skipped and values may be
+// wrapped in single or double quotes.
+func ParseEnv(data string) (map[string]string, error) {
+	env := make(map[string]string)
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || !envKeyRegex.MatchString(strings.TrimSpace(kv[0])) {
+			return nil, errors.New("Invalid environment variable on line " + strconv.Itoa(i+1) + ", expected KEY=VALUE")
+		}
+		value := strings.TrimSpace(kv[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[strings.TrimSpace(kv[0])] = value
+	}
+	return env, nil
+}
+
+// ValidateEnvKey tells if key can be used as name of an environment variable.
+func ValidateEnvKey(key string) error {
+	if !envKeyRegex.MatchString(key) {
+		return errors.New("Invalid environment variable name " + key)
+	}
+	return nil
+}
+
+// FormatEnv turns env into double quoted KEY="VALUE" pairs separated by
+// spaces, the form Environment field of resources is given in. Quoting keeps
+// spaces and commas within values intact.
+func FormatEnv(env map[string]string) string {
+	var pairs []string
+	for _, k := range sortedKeys(env) {
+		pairs = append(pairs, k+`="`+env[k]+`"`)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// WriteSecretEnvFile writes env as a shell sourceable file readable only by
+// usr, which programs source before starting. Contents are left out of dry
+// run plans.
+func WriteSecretEnvFile(location string, env map[string]string, usr *user.User) error {
+	var b strings.Builder
+	for _, k := range sortedKeys(env) {
+		if strings.ContainsAny(env[k], "\n\x00") {
+			return errors.New("Value of environment variable " + k + " cannot span multiple lines")
+		}
+		b.WriteString(k + "='" + strings.Replace(env[k], "'", `'\''`, -1) + "'\n")
+	}
+	if IsDryRun() {
+		RecordPlanStep("write secret environment", location, strings.Join(sortedKeys(env), ", "))
+		setPlannedFile(location, true)
+		return nil
+	}
+	err := RemoveFileIfExists(location)
+	if err != nil {
+		return err
+	}
+	err = WriteFile(location, []byte(b.String()), 0600)
+	if err != nil {
+		return err
+	}
+	return ChownToUser(location, usr)
+}
+
+// DescribeSecretEnvFile returns location of secret env file along with names
+// of variables it sets, their values redacted.
+func DescribeSecretEnvFile(location string) string {
+	file, err := os.Open(location)
+	if err != nil {
+		return location
+	}
+	defer file.Close()
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if kv := strings.SplitN(scanner.Text(), "=", 2); len(kv) == 2 {
+			keys = append(keys, kv[0]+"=<redacted>")
+		}
+	}
+	if len(keys) == 0 {
+		return location
+	}
+	return location + " (" + strings.Join(keys, ", ") + ")"
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,107 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	tests := []struct {
+		data    string
+		env     map[string]string
+		invalid bool
+	}{
+		{data: "", env: map[string]string{}},
+		{data: "A=1\nB=2", env: map[string]string{"A": "1", "B": "2"}},
+		{data: "# comment\n\n  A = 1  \n", env: map[string]string{"A": "1"}},
+		{data: "export A=1", env: map[string]string{"A": "1"}},
+		{data: `A="hello world"`, env: map[string]string{"A": "hello world"}},
+		{data: `A='a,b'`, env: map[string]string{"A": "a,b"}},
+		{data: `A="unbalanced'`, env: map[string]string{"A": `"unbalanced'`}},
+		{data: "A=x=y", env: map[string]string{"A": "x=y"}},
+		{data: "A=", env: map[string]string{"A": ""}},
+		{data: "A", invalid: true},
+		{data: "1A=1", invalid: true},
+		{data: "A-B=1", invalid: true},
+	}
+	for _, tt := range tests {
+		env, err := ParseEnv(tt.data)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParseEnv(%q) = %v, expected an error", tt.data, env)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseEnv(%q) failed: %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(env, tt.env) {
+			t.Errorf("ParseEnv(%q) = %v, expected %v", tt.data, env, tt.env)
+		}
+	}
+}
+
+func TestFormatEnv(t *testing.T) {
+	tests := []struct {
+		env         map[string]string
+		formatted   string
+		environment string
+	}{
+		{env: map[string]string{}, formatted: "", environment: ""},
+		{env: map[string]string{"B": "2", "A": "1"}, formatted: `A="1" B="2"`, environment: `A="1",B="2"`},
+		{env: map[string]string{"A": "hello world"}, formatted: `A="hello world"`, environment: `A="hello world"`},
+		{env: map[string]string{"A": "a,b", "B": ""}, formatted: `A="a,b" B=""`, environment: `A="a,b",B=""`},
+	}
+	for _, tt := range tests {
+		formatted := FormatEnv(tt.env)
+		if formatted != tt.formatted {
+			t.Errorf("FormatEnv(%v) = %q, expected %q", tt.env, formatted, tt.formatted)
+		}
+		environment, err := normalizeEnvironment(formatted)
+		if err != nil {
+			t.Errorf("normalizeEnvironment(%q) failed: %v", formatted, err)
+			continue
+		}
+		if environment != tt.environment {
+			t.Errorf("normalizeEnvironment(%q) = %q, expected %q", formatted, environment, tt.environment)
+		}
+	}
+}
+
+func TestNormalizeEnvironment(t *testing.T) {
+	tests := []struct {
+		env         string
+		environment string
+		invalid     bool
+	}{
+		{env: "A=1 B=2", environment: `A="1",B="2"`},
+		{env: "A=1,B=2", environment: `A="1",B="2"`},
+		{env: ` A="x y" , B=z `, environment: `A="x y",B="z"`},
+		{env: `A="x y",B="z"`, environment: `A="x y",B="z"`},
+		{env: `A="a,b"`, environment: `A="a,b"`},
+		{env: "A", invalid: true},
+		{env: "1A=1", invalid: true},
+		{env: `A="x`, invalid: true},
+		{env: `A=x"y"z"`, invalid: true},
+		{env: "A=it's", invalid: true},
+		{env: `A=a\b`, invalid: true},
+		{env: "A=50%", invalid: true},
+	}
+	for _, tt := range tests {
+		environment, err := normalizeEnvironment(tt.env)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("normalizeEnvironment(%q) = %q, expected an error", tt.env, environment)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("normalizeEnvironment(%q) failed: %v", tt.env, err)
+			continue
+		}
+		if environment != tt.environment {
+			t.Errorf("normalizeEnvironment(%q) = %q, expected %q", tt.env, environment, tt.environment)
+		}
+	}
+}
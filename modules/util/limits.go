@@ -0,0 +1,251 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LimitFields are resource fields holding resource limits and environment of
+// programs of a resource, all of them are strings so that they can be given
+// as runtime arguments.
+var LimitFields = []string{"MemoryLimit", "CPUQuota", "NofileLimit", "Nice", "IONice", "Environment", "SecretEnvFile"}
+
+// SupervisorUser renders user supervisor program runs as, given resource
+// field holding it. Programs with memory limit or CPU quota are started as
+// root so that they can be placed in a systemd scope, SupervisorCommandPrefix
+// drops them to their user inside it.
+func SupervisorUser(userField string) string {
+	return `{{if or .MemoryLimit .CPUQuota}}root{{else}}{{.` + userField + `}}{{end}}`
+}
+
+// SupervisorCommandPrefix renders wrappers prepended to command of supervisor
+// programs to apply resource limits of resource before program starts, given
+// resource field holding user program runs as. Memory limit and CPU quota are
+// enforced by a systemd scope program is moved into, since supervisor programs
+// do not get a cgroup of their own. Secret environment is sourced from its
+// file by a shell, keeping it out of supervisor confs.
+func SupervisorCommandPrefix(userField string) string {
+	return `{{if or .MemoryLimit .CPUQuota}}systemd-run --scope --quiet --collect --uid={{.` + userField + `}}{{if .MemoryLimit}} -p MemoryMax={{.MemoryLimit}}{{end}}{{if .CPUQuota}} -p CPUQuota={{.CPUQuota}}{{end}} -- {{end}}` +
+		`{{if .NofileLimit}}prlimit --nofile={{.NofileLimit}} -- {{end}}` +
+		`{{if .Nice}}nice -n {{.Nice}} {{end}}` +
+		`{{if eq .IONice "idle"}}ionice -c 3 {{else if .IONice}}ionice -c 2 -n {{.IONice}} {{end}}` +
+		`{{if .SecretEnvFile}}sh -c 'set -a && . {{.SecretEnvFile}} && exec "$0" "$@"' {{end}}`
+}
+
+// SupervisorEnvironmentTemplate renders environment of resource into
+// supervisor program section, to be placed at end of a line.
+const SupervisorEnvironmentTemplate = "{{if .Environment}}\nenvironment={{.Environment}}{{end}}"
+
+var (
+	memoryLimitRegex = regexp.MustCompile(`^([0-9]+)([KMGT]?)B?$`)
+	cpuQuotaRegex    = regexp.MustCompile(`^([0-9]+)%?$`)
+	envKeyRegex      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ValidateLimits validates limits among values, keyed by resource fields, of
+// programs run as usr and returns them normalized to the form they are
+// stored in resources. Memory limits are stored in bytes, CPU quotas in
+// percent of a CPU and environment in supervisor syntax. Normalizing
+// normalized limits gives them back unchanged.
+func ValidateLimits(values map[string]string, usr *user.User) (map[string]string, error) {
+	normalized := make(map[string]string)
+	for k, v := range values {
+		normalized[k] = v
+	}
+
+	if v := values["MemoryLimit"]; v != "" {
+		m := memoryLimitRegex.FindStringSubmatch(strings.ToUpper(v))
+		if m == nil {
+			return nil, errors.New("Invalid memory limit " + v + ", expected a size such as 512M or 2G")
+		}
+		n, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil || n == 0 {
+			return nil, errors.New("Invalid memory limit " + v + ", expected a positive size")
+		}
+		if m[2] != "" {
+			shift := uint(10*strings.Index("KMGT", m[2]) + 10)
+			if n > (^uint64(0))>>shift {
+				return nil, errors.New("Memory limit " + v + " is too large")
+			}
+			n <<= shift
+		}
+		normalized["MemoryLimit"] = strconv.FormatUint(n, 10)
+	}
+
+	if v := values["CPUQuota"]; v != "" {
+		m := cpuQuotaRegex.FindStringSubmatch(v)
+		if m == nil {
+			return nil, errors.New("Invalid CPU quota " + v + ", expected percent of a CPU such as 50% or 200%")
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n <= 0 {
+			return nil, errors.New("Invalid CPU quota " + v + ", expected a positive percentage")
+		}
+		normalized["CPUQuota"] = strconv.Itoa(n) + "%"
+	}
+
+	if values["MemoryLimit"] != "" || values["CPUQuota"] != "" {
+		if _, err := os.Stat("/run/systemd/system"); err != nil {
+			return nil, errors.New("Memory limit and CPU quota need a host booted with systemd")
+		}
+	}
+
+	if v := values["NofileLimit"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, errors.New("Invalid open files limit " + v + ", expected a positive number")
+		}
+		if max, err := ReadStringFromFile("/proc/sys/fs/nr_open"); err == nil {
+			if m, err := strconv.Atoi(strings.TrimSpace(max)); err == nil && n > m {
+				return nil, errors.New("Open files limit " + v + " is above maximum of " + strconv.Itoa(m) + " allowed by kernel")
+			}
+		}
+	}
+
+	if v := values["Nice"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < -20 || n > 19 {
+			return nil, errors.New("Invalid nice " + v + ", expected a number from -20 to 19")
+		}
+		if n < 0 && usr.Uid != "0" {
+			return nil, errors.New("Negative nice " + v + " needs programs to run as root, they run as " + usr.Username)
+		}
+	}
+
+	if v := values["IONice"]; v != "" && v != "idle" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 7 {
+			return nil, errors.New("Invalid io nice " + v + ", expected a best effort priority from 0 to 7 or idle")
+		}
+	}
+
+	if v := values["Environment"]; v != "" {
+		env, err := normalizeEnvironment(v)
+		if err != nil {
+			return nil, err
+		}
+		normalized["Environment"] = env
+	}
+
+	if v := values["SecretEnvFile"]; v != "" {
+		if !filepath.IsAbs(v) || strings.ContainsAny(v, ` '"`) {
+			return nil, errors.New("Secret environment file has to be an absolute path without spaces or quotes: " + v)
+		}
+		if !FileExists(v) {
+			return nil, errors.New("Secret environment file " + v + " does not exist")
+		}
+	}
+
+	for _, wrapper := range []struct{ command, field string }{
+		{"systemd-run", "MemoryLimit"}, {"systemd-run", "CPUQuota"}, {"prlimit", "NofileLimit"}, {"nice", "Nice"}, {"ionice", "IONice"}, {"sh", "SecretEnvFile"},
+	} {
+		if values[wrapper.field] != "" && !IsCommandAvailable(wrapper.command) {
+			return nil, errors.New(wrapper.field + " needs " + wrapper.command + " which is not available")
+		}
+	}
+
+	for k, v := range values {
+		if !strings.HasSuffix(k, "RunDir") || v == "" {
+			continue
+		}
+		if !filepath.IsAbs(v) {
+			return nil, errors.New("Working directory has to be an absolute path: " + v)
+		}
+		if stat, err := os.Stat(v); err != nil || !stat.IsDir() {
+			return nil, errors.New("Working directory " + v + " does not exist")
+		}
+		if _, err := CheckTraversable(v, usr); err != nil {
+			return nil, err
+		}
+	}
+	return normalized, nil
+}
+
+// ApplyLimits validates limits of resource pointed to by resData, whose
+// programs run as usr, and normalizes them in place.
+func ApplyLimits(resData interface{}, usr *user.User) error {
+	ref := reflect.ValueOf(resData).Elem()
+	values := make(map[string]string)
+	for i := 0; i < ref.NumField(); i++ {
+		name := ref.Type().Field(i).Name
+		if ref.Field(i).Kind() == reflect.String && (strings.HasSuffix(name, "RunDir") || IsLimitField(name)) {
+			values[name] = ref.Field(i).String()
+		}
+	}
+	normalized, err := ValidateLimits(values, usr)
+	if err != nil {
+		return err
+	}
+	for k, v := range normalized {
+		ref.FieldByName(k).SetString(v)
+	}
+	return nil
+}
+
+// IsLimitField tells if resource field holds a limit.
+func IsLimitField(name string) bool {
+	for _, field := range LimitFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEnvironment turns KEY=VALUE pairs separated by spaces or commas,
+// with values optionally double quoted, into supervisor environment syntax.
+// Spaces and commas within double quoted values are kept.
+func normalizeEnvironment(env string) (string, error) {
+	fields, err := splitEnvironment(env)
+	if err != nil {
+		return "", err
+	}
+	var pairs []string
+	for _, pair := range fields {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !envKeyRegex.MatchString(kv[0]) {
+			return "", errors.New("Invalid environment variable " + pair + ", expected KEY=VALUE")
+		}
+		value := kv[1]
+		if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = value[1 : len(value)-1]
+		}
+		if strings.ContainsAny(value, "\"'%\\\n") {
+			return "", errors.New("Value of environment variable " + kv[0] + " cannot contain quotes, backslashes, newlines or %")
+		}
+		pairs = append(pairs, kv[0]+`="`+value+`"`)
+	}
+	return strings.Join(pairs, ","), nil
+}
+
+// splitEnvironment splits env on spaces and commas outside of double quotes.
+func splitEnvironment(env string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	quoted := false
+	for _, c := range env {
+		if c == '"' {
+			quoted = !quoted
+		} else if !quoted && (c == ' ' || c == ',') {
+			if field.Len() != 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			continue
+		}
+		field.WriteRune(c)
+	}
+	if quoted {
+		return nil, errors.New("Unterminated quote in environment " + env)
+	}
+	if field.Len() != 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
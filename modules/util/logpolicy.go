@@ -0,0 +1,125 @@
+package util
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultLogDir      = "/var/log/supervisor"
+	DefaultLogMaxBytes = "50MB"
+	DefaultLogBackups  = "10"
+	logRotateConfDir   = "/etc/logrotate.d"
+)
+
+// LogConfigFields are resource fields holding log configuration of a
+// resource, all of them are strings so that they can be given as runtime
+// arguments.
+var LogConfigFields = []string{"LogDir", "LogMaxBytes", "LogBackups", "LogCompress"}
+
+var logMaxBytesRegex = regexp.MustCompile(`^[0-9]+(KB|MB|GB)?$`)
+
+func LogDirOrDefault(logDir string) string {
+	if logDir == "" {
+		return DefaultLogDir
+	}
+	return logDir
+}
+
+// SupervisorLogTemplate returns supervisor program section lines for stdout
+// and stderr logs of the program named by programField of a resource.
+// Supervisor does not compress rotated logs, rotation is left to logrotate
+// for resources asking for compression.
+func SupervisorLogTemplate(programField string) string {
+	var lines []string
+	for _, stream := range []string{"stdout", "stderr"} {
+		lines = append(lines,
+			stream+"_logfile={{.LogDir}}/{{."+programField+"}}-"+stream+".log",
+			stream+`_logfile_maxbytes={{if eq .LogCompress "true"}}0{{else}}{{.LogMaxBytes}}{{end}}`,
+			stream+`_logfile_backups={{if eq .LogCompress "true"}}0{{else}}{{.LogBackups}}{{end}}`)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func ValidateLogConfig(logDir string, maxBytes string, backups string, compress string) error {
+	if !filepath.IsAbs(logDir) {
+		return errors.New("Log directory has to be an absolute path: " + logDir)
+	}
+	if !logMaxBytesRegex.MatchString(maxBytes) {
+		return errors.New("Invalid log max bytes " + maxBytes + ", expected a size such as 50MB")
+	}
+	if n, err := strconv.Atoi(backups); err != nil || n < 0 {
+		return errors.New("Invalid log backups " + backups + ", expected a non negative number")
+	}
+	if compress != "true" && compress != "false" {
+		return errors.New("Invalid log compress " + compress + ", expected true or false")
+	}
+	return nil
+}
+
+// ApplyLogConfig fills in defaults for log fields missing in a resource, such
+// as those of resources created by older versions of marlinctl, validates
+// them, creates the log directory and installs or removes logrotate
+// configuration for logs of programs.
+func ApplyLogConfig(name string, programs []string, resData interface{}) error {
+	values := FillLogConfigDefaults(resData)
+	err := ValidateLogConfig(values["LogDir"], values["LogMaxBytes"], values["LogBackups"], values["LogCompress"])
+	if err != nil {
+		return err
+	}
+	err = CreateDirPathIfNotExists(values["LogDir"])
+	if err != nil {
+		return errors.New("Error while creating log directory: " + err.Error())
+	}
+
+	if values["LogCompress"] != "true" {
+		return RemoveLogRotateConf(name)
+	}
+	var files []string
+	for _, prg := range programs {
+		files = append(files, values["LogDir"]+"/"+prg+"-stdout.log", values["LogDir"]+"/"+prg+"-stderr.log")
+	}
+	conf := strings.Join(files, " ") + " {\n" +
+		"\tsize " + strings.TrimSuffix(values["LogMaxBytes"], "B") + "\n" +
+		"\trotate " + values["LogBackups"] + "\n" +
+		"\tcompress\n" +
+		"\tdelaycompress\n" +
+		"\tmissingok\n" +
+		"\tnotifempty\n" +
+		"\tcopytruncate\n" +
+		"}\n"
+	return WriteFile(LogRotateConfLocation(name), []byte(conf), 0644)
+}
+
+// FillLogConfigDefaults fills in defaults for log fields missing in resource
+// pointed to by resData and returns resulting log fields.
+func FillLogConfigDefaults(resData interface{}) map[string]string {
+	ref := reflect.ValueOf(resData).Elem()
+	defaults := map[string]string{
+		"LogDir":      DefaultLogDir,
+		"LogMaxBytes": DefaultLogMaxBytes,
+		"LogBackups":  DefaultLogBackups,
+		"LogCompress": "false",
+	}
+	values := make(map[string]string)
+	for _, field := range LogConfigFields {
+		f := ref.FieldByName(field)
+		if f.String() == "" {
+			f.SetString(defaults[field])
+		}
+		values[field] = f.String()
+	}
+	return values
+}
+
+func RemoveLogRotateConf(name string) error {
+	return RemoveFileIfExists(LogRotateConfLocation(name))
+}
+
+func LogRotateConfLocation(name string) string {
+	return logRotateConfDir + "/marlinctl_" + name
+}
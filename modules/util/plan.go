@@ -0,0 +1,99 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/jedib0t/go-pretty/table"
+	log "github.com/sirupsen/logrus"
+)
+
+// PlanStep is a single side effect a runner would have performed on the
+// system had marlinctl not been invoked in dry run mode.
+type PlanStep struct {
+	Action string
+	Target string
+	Detail string
+}
+
+// planMu guards dry run state, which instances acted upon in parallel share.
+var planMu sync.Mutex
+var dryRun bool
+var planSteps []PlanStep
+
+// plannedFiles tracks files written (true) or removed (false) by planned
+// steps so that later lookups during the same dry run see a consistent view.
+var plannedFiles = make(map[string]bool)
+
+func EnableDryRun() {
+	planMu.Lock()
+	defer planMu.Unlock()
+	dryRun = true
+}
+
+func IsDryRun() bool {
+	planMu.Lock()
+	defer planMu.Unlock()
+	return dryRun
+}
+
+func RecordPlanStep(action string, target string, detail string) {
+	log.Debug("Dry run: ", action, " ", target)
+	planMu.Lock()
+	defer planMu.Unlock()
+	planSteps = append(planSteps, PlanStep{action, target, detail})
+}
+
+func GetPlanSteps() []PlanStep {
+	planMu.Lock()
+	defer planMu.Unlock()
+	return append([]PlanStep(nil), planSteps...)
+}
+
+// setPlannedFile records a file as written (true) or removed (false) by a
+// planned step.
+func setPlannedFile(location string, exists bool) {
+	planMu.Lock()
+	defer planMu.Unlock()
+	plannedFiles[location] = exists
+}
+
+// FileExists reports whether a file exists, taking into account files written
+// or removed by steps recorded in the current dry run.
+func FileExists(location string) bool {
+	planMu.Lock()
+	exists, ok := plannedFiles[location]
+	planMu.Unlock()
+	if ok {
+		return exists
+	}
+	_, err := os.Stat(location)
+	return err == nil
+}
+
+func PrintPlan() {
+	planSteps := GetPlanSteps()
+	if len(planSteps) == 0 {
+		log.Info("Dry run: nothing to be done")
+		return
+	}
+	log.Info("Dry run: following actions would be taken")
+
+	t := GetTable()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Step", "Action", "Target"})
+	for i, s := range planSteps {
+		t.AppendRow(table.Row{strconv.Itoa(i + 1), s.Action, s.Target})
+	}
+	t.Render()
+
+	for _, s := range planSteps {
+		if s.Detail != "" {
+			log.Info("Contents of ", s.Target)
+			fmt.Println(s.Detail)
+		}
+	}
+	log.Info("Dry run complete, no changes were made to the system")
+}
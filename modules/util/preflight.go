@@ -0,0 +1,259 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// listenAddressFields are resource fields holding an address (or a bare port)
+// which a spawned program binds on. Fields pointing at remote peers, such as
+// BootstrapAddr or DiscoveryAddrs, are deliberately not part of this list.
+var listenAddressFields = []string{
+	"DiscoveryAddr", "HeartbeatAddr", "PubsubAddr", "InternalListenAddr", "ListenAddr",
+	"MevProxyListenAddr", "DiscoveryBindAddr", "PubsubBindAddr", "DiscoveryPort", "PubsubPort",
+	"GatewayListenPortPeer",
+}
+
+// listenAddressPairs are listen addresses of a program split into a host and
+// a port field, along with what program binds on when either of them is not
+// recorded in resource, as for resources created before they were
+// configurable. They are checked whenever program field is set.
+var listenAddressPairs = []struct{ program, host, port, defaultHost, defaultPort string }{
+	{"GethProgram", "", "GethPort", "", "30303"},
+	{"GethProgram", "GethPprofAddr", "GethPprofPort", "0.0.0.0", "6060"},
+}
+
+// InstanceResourceFiles lists resource files of every instance of every
+// configured project. It is set by package projects, which knows storage of
+// each project.
+var InstanceResourceFiles func() ([]string, error)
+
+type ListenAddress struct {
+	Field string
+	Host  string
+	Port  int
+}
+
+func (l ListenAddress) String() string {
+	return net.JoinHostPort(l.Host, strconv.Itoa(l.Port))
+}
+
+func (l ListenAddress) overlaps(o ListenAddress) bool {
+	if l.Port != o.Port {
+		return false
+	}
+	return isWildcardHost(l.Host) || isWildcardHost(o.Host) || l.Host == o.Host ||
+		(isLoopbackHost(l.Host) && isLoopbackHost(o.Host) && (l.Host == "localhost" || o.Host == "localhost"))
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func isWildcardHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
+
+// ParseListenAddress parses a host:port pair or a bare port into a
+// ListenAddress.
+func ParseListenAddress(field string, value string) (ListenAddress, error) {
+	host, portString := "", value
+	if strings.Contains(value, ":") {
+		var err error
+		host, portString, err = net.SplitHostPort(value)
+		if err != nil {
+			return ListenAddress{}, errors.New("Invalid address " + value + " for " + field + ": " + err.Error())
+		}
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil || port < 1 || port > 65535 {
+		return ListenAddress{}, errors.New("Invalid port " + portString + " in address " + value + " for " + field)
+	}
+	if host != "" && host != "localhost" && net.ParseIP(host) == nil {
+		return ListenAddress{}, errors.New("Invalid host " + host + " in address " + value + " for " + field + ", expected an IP address")
+	}
+	return ListenAddress{field, host, port}, nil
+}
+
+// GetListenAddresses extracts every non empty listen address field from a
+// resource struct or a resource decoded into a map.
+func GetListenAddresses(resData interface{}) ([]ListenAddress, error) {
+	field := func(name string) string {
+		if m, ok := resData.(map[string]interface{}); ok {
+			value, _ := m[name].(string)
+			return value
+		}
+		ref := reflect.Indirect(reflect.ValueOf(resData))
+		if f := ref.FieldByName(name); f.IsValid() && f.Kind() == reflect.String {
+			return f.String()
+		}
+		return ""
+	}
+
+	var addresses []ListenAddress
+	for _, name := range listenAddressFields {
+		value := field(name)
+		if value == "" {
+			continue
+		}
+		address, err := ParseListenAddress(name, value)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	for _, pair := range listenAddressPairs {
+		if field(pair.program) == "" {
+			continue
+		}
+		name, host, port := pair.port, pair.defaultHost, pair.defaultPort
+		if pair.host != "" {
+			name = pair.host
+			if h := field(pair.host); h != "" {
+				host = h
+			}
+		}
+		if p := field(pair.port); p != "" {
+			port = p
+		}
+		value := port
+		if host != "" {
+			value = net.JoinHostPort(host, port)
+		}
+		address, err := ParseListenAddress(name, value)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// CheckListenAddresses validates listen addresses of a resource about to be
+// created against each other, against resources of every other marlinctl
+// instance on this host and against sockets currently bound on this host.
+func CheckListenAddresses(resourceFile string, resData interface{}) error {
+	addresses, err := GetListenAddresses(resData)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(addresses); i++ {
+		for j := i + 1; j < len(addresses); j++ {
+			if addresses[i].overlaps(addresses[j]) {
+				return errors.New("Address conflict: " + addresses[i].Field + " (" + addresses[i].String() + ") and " +
+					addresses[j].Field + " (" + addresses[j].String() + ") use the same port")
+			}
+		}
+	}
+
+	if InstanceResourceFiles == nil {
+		return errors.New("Cannot list instances to check address conflicts against")
+	}
+	resourceFiles, err := InstanceResourceFiles()
+	if err != nil {
+		return errors.New("Error while listing instances to check address conflicts against: " + err.Error())
+	}
+
+	// Addresses of resources removed earlier in a dry run are still bound by
+	// their running programs and hence are exempt from the bind check.
+	var plannedFreed []ListenAddress
+	for _, f := range resourceFiles {
+		otherAddresses, err := readResourceListenAddresses(f)
+		if err != nil {
+			log.Warning("Skipping resource file ", f, ": ", err.Error())
+			continue
+		}
+		if !FileExists(f) {
+			plannedFreed = append(plannedFreed, otherAddresses...)
+			continue
+		}
+		if f == resourceFile {
+			continue
+		}
+		resourceName := strings.TrimSuffix(filepath.Base(f), ".resource")
+		for _, a := range addresses {
+			for _, o := range otherAddresses {
+				if a.overlaps(o) {
+					return errors.New("Address conflict: " + a.Field + " (" + a.String() + ") is already used as " +
+						o.Field + " (" + o.String() + ") by " + resourceName)
+				}
+			}
+		}
+	}
+
+	for _, a := range addresses {
+		freed := false
+		for _, o := range plannedFreed {
+			freed = freed || a.overlaps(o)
+		}
+		if freed {
+			continue
+		}
+		err := checkAddressBindable(a)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readResourceListenAddresses(fileLocation string) ([]ListenAddress, error) {
+	file, err := ioutil.ReadFile(fileLocation)
+	if err != nil {
+		return nil, err
+	}
+	var resData map[string]interface{}
+	err = json.Unmarshal(file, &resData)
+	if err != nil {
+		return nil, err
+	}
+	return GetListenAddresses(resData)
+}
+
+// checkAddressBindable tries binding both tcp and udp sockets on the address
+// since programs differ in which protocol they listen on.
+func checkAddressBindable(a ListenAddress) error {
+	var inUse = func(protocol string, err error) error {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return errors.New("Address conflict: " + a.Field + " (" + a.String() + ") is already bound by another process on this host (" + protocol + ")")
+		}
+		if errors.Is(err, syscall.EADDRNOTAVAIL) {
+			return errors.New("Invalid address: " + a.Field + " (" + a.String() + ") is not available on this host")
+		}
+		log.Debug("Could not check ", protocol, " availability of ", a.String(), ": ", err.Error())
+		return nil
+	}
+
+	l, err := net.Listen("tcp", a.String())
+	if err != nil {
+		if err := inUse("tcp", err); err != nil {
+			return err
+		}
+	} else {
+		l.Close()
+	}
+
+	p, err := net.ListenPacket("udp", a.String())
+	if err != nil {
+		if err := inUse("udp", err); err != nil {
+			return err
+		}
+	} else {
+		p.Close()
+	}
+	return nil
+}
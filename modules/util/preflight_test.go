@@ -0,0 +1,151 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		value   string
+		host    string
+		port    int
+		invalid bool
+	}{
+		{value: "8002", host: "", port: 8002},
+		{value: "0.0.0.0:8002", host: "0.0.0.0", port: 8002},
+		{value: "127.0.0.1:6060", host: "127.0.0.1", port: 6060},
+		{value: "[::]:30303", host: "::", port: 30303},
+		{value: "[::1]:30303", host: "::1", port: 30303},
+		{value: "localhost:8545", host: "localhost", port: 8545},
+		{value: ":8002", host: "", port: 8002},
+		{value: "0", invalid: true},
+		{value: "65536", invalid: true},
+		{value: "127.0.0.1:70000", invalid: true},
+		{value: "abc", invalid: true},
+		{value: "127.0.0.1:abc", invalid: true},
+		{value: "127.0.0.1", invalid: true},
+		{value: "::1", invalid: true},
+		{value: "example.com:8002", invalid: true},
+	}
+	for _, tt := range tests {
+		a, err := ParseListenAddress("Field", tt.value)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParseListenAddress(%q) = %v, expected an error", tt.value, a)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseListenAddress(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if a.Field != "Field" || a.Host != tt.host || a.Port != tt.port {
+			t.Errorf("ParseListenAddress(%q) = %+v, expected host %q port %d", tt.value, a, tt.host, tt.port)
+		}
+	}
+}
+
+func TestListenAddressOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		overlaps bool
+	}{
+		{"8002", "8002", true},
+		{"8002", "8003", false},
+		{"8002", "127.0.0.1:8002", true},
+		{"0.0.0.0:8002", "10.0.0.1:8002", true},
+		{"[::]:8002", "10.0.0.1:8002", true},
+		{"[::]:8002", "0.0.0.0:8002", true},
+		{"10.0.0.1:8002", "10.0.0.2:8002", false},
+		{"10.0.0.1:8002", "10.0.0.1:8002", true},
+		{"localhost:8002", "127.0.0.1:8002", true},
+		{"localhost:8002", "[::1]:8002", true},
+		{"localhost:8002", "10.0.0.1:8002", false},
+		{"localhost:8002", "localhost:8003", false},
+	}
+	for _, tt := range tests {
+		a, err := ParseListenAddress("A", tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseListenAddress("B", tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.overlaps(b) != tt.overlaps || b.overlaps(a) != tt.overlaps {
+			t.Errorf("%s overlaps %s = %v, expected %v", tt.a, tt.b, a.overlaps(b), tt.overlaps)
+		}
+	}
+}
+
+func TestGetListenAddresses(t *testing.T) {
+	resData := struct {
+		DiscoveryAddr string
+		PubsubAddr    string
+		BootstrapAddr string
+	}{"0.0.0.0:8002", "", "10.0.0.1:8002"}
+	addresses, err := GetListenAddresses(resData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 1 || addresses[0].Field != "DiscoveryAddr" || addresses[0].Port != 8002 {
+		t.Errorf("GetListenAddresses(struct) = %+v", addresses)
+	}
+
+	addresses, err = GetListenAddresses(map[string]interface{}{"PubsubAddr": "[::]:8000", "Runner": "linux-amd64.supervisor.runner01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 1 || addresses[0].Host != "::" || addresses[0].Port != 8000 {
+		t.Errorf("GetListenAddresses(map) = %+v", addresses)
+	}
+
+	_, err = GetListenAddresses(map[string]interface{}{"PubsubAddr": "0.0.0.0:http"})
+	if err == nil {
+		t.Error("GetListenAddresses accepted a non numeric port")
+	}
+}
+
+func TestGetListenAddressPairs(t *testing.T) {
+	tests := []struct {
+		resData   map[string]interface{}
+		addresses []string
+	}{
+		{
+			resData:   map[string]interface{}{"GethPort": "30303", "GethPprofAddr": "127.0.0.1", "GethPprofPort": "6060"},
+			addresses: nil,
+		},
+		{
+			resData:   map[string]interface{}{"GethProgram": "geth_1", "GethPort": "30304", "GethPprofAddr": "127.0.0.1", "GethPprofPort": "6061"},
+			addresses: []string{"GethPort :30304", "GethPprofAddr 127.0.0.1:6061"},
+		},
+		{
+			resData:   map[string]interface{}{"GethProgram": "geth_1", "GethPprofAddr": "::1"},
+			addresses: []string{"GethPort :30303", "GethPprofAddr [::1]:6060"},
+		},
+		{
+			resData:   map[string]interface{}{"GethProgram": "geth_1"},
+			addresses: []string{"GethPort :30303", "GethPprofAddr 0.0.0.0:6060"},
+		},
+	}
+	for _, tt := range tests {
+		addresses, err := GetListenAddresses(tt.resData)
+		if err != nil {
+			t.Errorf("GetListenAddresses(%v) failed: %v", tt.resData, err)
+			continue
+		}
+		var got []string
+		for _, a := range addresses {
+			got = append(got, a.Field+" "+a.String())
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.addresses, ", ") {
+			t.Errorf("GetListenAddresses(%v) = %v, expected %v", tt.resData, got, tt.addresses)
+		}
+	}
+
+	_, err := GetListenAddresses(map[string]interface{}{"GethProgram": "geth_1", "GethPprofAddr": "127.0.0.1", "GethPprofPort": "abc"})
+	if err == nil {
+		t.Error("GetListenAddresses accepted a non numeric pprof port")
+	}
+}
@@ -0,0 +1,228 @@
+package util
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultServiceUser is the system user programs are run as once a project is
+// set up with a service user.
+const DefaultServiceUser = "marlin"
+
+// GetServiceUser returns user programs of project are run as, which is its
+// configured service user or user invoking marlinctl if none is configured.
+func GetServiceUser(projectID string) (*user.User, error) {
+	name := viper.GetString(projectID + ".serviceuser")
+	if name == "" {
+		return GetUser()
+	}
+	usr, err := user.Lookup(name)
+	if err != nil {
+		return nil, errors.New("Error while looking up service user " + name + " of " + projectID + ": " + err.Error())
+	}
+	return usr, nil
+}
+
+// HasServiceUser tells if project is set up to run programs as a service
+// user of their own.
+func HasServiceUser(projectID string) bool {
+	return viper.GetString(projectID+".serviceuser") != ""
+}
+
+// EnsureServiceUser returns system user with given name, creating it along
+// with a group of the same name if it does not exist. Service users have no
+// login shell and a home directory under /var/lib.
+func EnsureServiceUser(name string) (*user.User, error) {
+	usr, err := user.Lookup(name)
+	if err == nil {
+		return usr, nil
+	} else if _, ok := err.(user.UnknownUserError); !ok {
+		return nil, err
+	}
+	args := []string{"--system", "--user-group", "--create-home", "--home-dir", "/var/lib/" + name, "--shell", "/usr/sbin/nologin", name}
+	if IsDryRun() {
+		RecordPlanStep("create user", name, "useradd "+strings.Join(args, " "))
+		return &user.User{Username: name, HomeDir: "/var/lib/" + name}, nil
+	}
+	out, err := exec.Command("useradd", args...).CombinedOutput()
+	if err != nil {
+		return nil, errors.New("Error while creating user " + name + ": " + err.Error() + ": " + strings.TrimSpace(string(out)))
+	}
+	return user.Lookup(name)
+}
+
+// ChownToUser hands location over to usr, unless usr already owns it.
+func ChownToUser(location string, usr *user.User) error {
+	uid, gid, err := userIDs(usr)
+	if err != nil && IsDryRun() && usr.Uid == "" {
+		RecordPlanStep("chown", location, usr.Username)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	stat, err := os.Stat(location)
+	if err != nil {
+		return err
+	}
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok && int(sys.Uid) == uid && int(sys.Gid) == gid {
+		return nil
+	}
+	if IsDryRun() {
+		RecordPlanStep("chown", location, usr.Username)
+		return nil
+	}
+	return os.Chown(location, uid, gid)
+}
+
+// CheckTraversable tells if usr can reach location, which needs every
+// directory leading to it to be searchable by usr. Returns first directory
+// which is not.
+func CheckTraversable(location string, usr *user.User) (string, error) {
+	dirs, err := untraversableDirs(location, usr, false)
+	if err != nil || len(dirs) == 0 {
+		return "", err
+	}
+	stat, err := os.Stat(dirs[0])
+	if err != nil {
+		return dirs[0], err
+	}
+	return dirs[0], errors.New(dirs[0] + " cannot be entered by user " + usr.Username + " (mode " + stat.Mode().Perm().String() + ")")
+}
+
+// UntraversableDirs returns every directory leading to location which usr
+// cannot enter, innermost first.
+func UntraversableDirs(location string, usr *user.User) ([]string, error) {
+	return untraversableDirs(location, usr, true)
+}
+
+func untraversableDirs(location string, usr *user.User, all bool) ([]string, error) {
+	uid, gid, err := userIDs(usr)
+	if err != nil && IsDryRun() && usr.Uid == "" {
+		// user is yet to be created
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if uid == 0 {
+		return nil, nil
+	}
+	groups := map[string]bool{strconv.Itoa(gid): true}
+	if groupIds, err := usr.GroupIds(); err == nil {
+		for _, g := range groupIds {
+			groups[g] = true
+		}
+	}
+	location, err = filepath.Abs(location)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for dir := filepath.Dir(location); ; dir = filepath.Dir(dir) {
+		stat, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		perm := stat.Mode().Perm()
+		sys, ok := stat.Sys().(*syscall.Stat_t)
+		var searchable bool
+		switch {
+		case !ok:
+			searchable = true
+		case int(sys.Uid) == uid:
+			searchable = perm&0100 != 0
+		case groups[strconv.Itoa(int(sys.Gid))]:
+			searchable = perm&0010 != 0
+		default:
+			searchable = perm&0001 != 0
+		}
+		if !searchable {
+			dirs = append(dirs, dir)
+			if !all {
+				return dirs, nil
+			}
+		}
+		if dir == filepath.Dir(dir) {
+			return dirs, nil
+		}
+	}
+}
+
+// IsHomeDir tells if dir is home directory of any user, or holds them.
+func IsHomeDir(dir string) bool {
+	if dir == "/root" || dir == "/home" {
+		return true
+	}
+	data, err := ioutil.ReadFile("/etc/passwd")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) > 5 && fields[5] != "/" && filepath.Clean(fields[5]) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowTraverse makes directory searchable, but not listable, by everyone so
+// that service users can reach files below it.
+func AllowTraverse(dir string) error {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if IsDryRun() {
+		RecordPlanStep("chmod o+x", dir, "")
+		return nil
+	}
+	return os.Chmod(dir, stat.Mode().Perm()|0001)
+}
+
+// ShareConfDirs makes directories marlinctl writes supervisor and logrotate
+// confs to writable by members of group, so that operators in group can run
+// marlinctl without root. New files inherit group of directories.
+func ShareConfDirs(group string) error {
+	grp, err := user.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(grp.Gid)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{SupervisorConfDir, logRotateConfDir} {
+		if IsDryRun() {
+			RecordPlanStep("share with group "+group, dir, "")
+			continue
+		}
+		if err := os.Chown(dir, 0, gid); err != nil {
+			return err
+		}
+		if err := os.Chmod(dir, 0775|os.ModeSetgid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func userIDs(usr *user.User) (int, int, error) {
+	uid, err := strconv.Atoi(usr.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := strconv.Atoi(usr.Gid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
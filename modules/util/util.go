@@ -18,15 +18,14 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"golang.org/x/crypto/ssh/terminal"
 
-	"github.com/hpcloud/tail"
 	"github.com/jedib0t/go-pretty/table"
 	"github.com/jedib0t/go-pretty/text"
 	"github.com/schollz/progressbar/v3"
@@ -103,7 +102,7 @@ func IsSupervisorAvailable() bool {
 		isSupervisorAvailable = true
 	}
 	if !IsCommandAvailable("supervisorctl") {
-		isSupervisorAvailable = true
+		isSupervisorAvailable = false
 	}
 	return isSupervisorAvailable
 }
@@ -159,6 +158,10 @@ func GetRuntimes() map[string]bool {
 
 func CreateDirPathIfNotExists(dirPath string) error {
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+		if IsDryRun() {
+			RecordPlanStep("create directory", dirPath, "")
+			return nil
+		}
 		currentUser, err := GetUser()
 		if err != nil {
 			return err
@@ -226,6 +229,10 @@ func ChownRmarlinctlDir() error {
 	if err != nil {
 		return err
 	}
+	if IsDryRun() {
+		RecordPlanStep("chown", currentUser.HomeDir+"/.marlin", "")
+		return nil
+	}
 	uid, err := strconv.Atoi(currentUser.Uid)
 	if err != nil {
 		return err
@@ -234,11 +241,19 @@ func ChownRmarlinctlDir() error {
 	if err != nil {
 		return err
 	}
+	if !FileExists(currentUser.HomeDir + "/.marlin") {
+		return nil
+	}
+	// Only files created as root, e.g. when run using sudo, are handed over so
+	// that files handed to service users stay theirs
 	return filepath.Walk(currentUser.HomeDir+"/.marlin", func(name string, info os.FileInfo, err error) error {
-		if err == nil {
-			err = os.Chown(name, uid, gid)
+		if err != nil {
+			return err
 		}
-		return err
+		if sys, ok := info.Sys().(*syscall.Stat_t); ok && sys.Uid != 0 {
+			return nil
+		}
+		return os.Chown(name, uid, gid)
 	})
 }
 
@@ -268,28 +283,32 @@ func DownloadFile(filepath string, url string) error {
 }
 
 func VerifyChecksum(filepath string, md5hash string) error {
-	var calculatedMD5 string
+	calculatedMD5, err := FileChecksum(filepath)
+	if err != nil {
+		return err
+	}
+
+	if calculatedMD5 != md5hash {
+		return errors.New("MD5 mismatch. Got " + calculatedMD5 + " while expecting " + md5hash + " @ " + filepath)
+	}
+	return nil
+}
 
+// FileChecksum returns md5 checksum of file as used by registry.
+func FileChecksum(filepath string) (string, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer file.Close()
 
 	hash := md5.New()
 
 	if _, err := io.Copy(hash, file); err != nil {
-		return err
+		return "", err
 	}
 
-	hashInBytes := hash.Sum(nil)[:16]
-
-	calculatedMD5 = hex.EncodeToString(hashInBytes)
-
-	if calculatedMD5 != md5hash {
-		return errors.New("MD5 mismatch. Got " + calculatedMD5 + " while expecting " + md5hash + " @ " + filepath)
-	}
-	return nil
+	return hex.EncodeToString(hash.Sum(nil)[:16]), nil
 }
 
 func TrimSpacesEveryLine(s string) string {
@@ -315,6 +334,10 @@ func PrettyPrintKVStruct(s interface{}) {
 	t.AppendHeader(table.Row{"Key", "Value"})
 
 	for i := 0; i < v.NumField(); i++ {
+		if name := v.Type().Field(i).Name; name == "SecretEnvFile" && v.Field(i).String() != "" {
+			t.AppendRow(table.Row{name, DescribeSecretEnvFile(v.Field(i).String())})
+			continue
+		}
 		t.AppendRow(table.Row{v.Type().Field(i).Name, v.Field(i).Interface()})
 	}
 	t.Render()
@@ -529,6 +552,17 @@ func ReadStringFromFile(filePath string) (string, error) {
 }
 
 func DownloadExecutable(exectype string, version string, url string, skipchecksum bool, checksum string, filelocation string) error {
+	if IsDryRun() {
+		if !FileExists(filelocation) {
+			RecordPlanStep("download "+exectype, filelocation, "")
+			setPlannedFile(filelocation, true)
+			return nil
+		}
+		if !skipchecksum {
+			return VerifyChecksum(filelocation, checksum)
+		}
+		return nil
+	}
 	if _, err := os.Stat(filelocation); os.IsNotExist(err) {
 		log.Info("Fetching ", exectype, " from upstream for version ", version)
 		DownloadFile(filelocation, url)
@@ -545,7 +579,82 @@ func DownloadExecutable(exectype string, version string, url string, skipchecksu
 	return os.Chmod(filelocation, 0755)
 }
 
+// WriteSupervisorConf renders template t with data and writes it to location.
+func WriteSupervisorConf(t *template.Template, data interface{}, location string) error {
+	rendered, err := RenderSupervisorConf(t, data)
+	if err != nil {
+		return err
+	}
+	return WriteFile(location, rendered, 0644)
+}
+
+// SupervisorConfMarker heads every supervisor conf rendered by marlinctl, so
+// that confs it wrote can be told apart from ones written by hand.
+const SupervisorConfMarker = "; managed by marlinctl, changes are overwritten\n"
+
+func RenderSupervisorConf(t *template.Template, data interface{}) ([]byte, error) {
+	var rendered bytes.Buffer
+	rendered.WriteString(SupervisorConfMarker)
+	if err := t.Execute(&rendered, data); err != nil {
+		return nil, errors.New("Error while rendering " + t.Name() + ": " + err.Error())
+	}
+	return rendered.Bytes(), nil
+}
+
+func WriteFile(location string, data []byte, perm os.FileMode) error {
+	if IsDryRun() {
+		RecordPlanStep("write file", location, string(data))
+		setPlannedFile(location, true)
+		return nil
+	}
+	return ioutil.WriteFile(location, data, perm)
+}
+
+func RemoveFileIfExists(location string) error {
+	if !FileExists(location) {
+		return nil
+	}
+	if IsDryRun() {
+		RecordPlanStep("remove file", location, "")
+		setPlannedFile(location, false)
+		return nil
+	}
+	return os.Remove(location)
+}
+
+func MoveFile(src string, dst string) error {
+	if IsDryRun() {
+		RecordPlanStep("move file", src+" -> "+dst, "")
+		setPlannedFile(src, false)
+		setPlannedFile(dst, true)
+		return nil
+	}
+	return os.Rename(src, dst)
+}
+
+func CopyFile(src string, dst string, perm os.FileMode) error {
+	if IsDryRun() {
+		RecordPlanStep("copy file", src+" -> "+dst, "")
+		setPlannedFile(dst, true)
+		return nil
+	}
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(dst, data, perm)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(dst, perm)
+}
+
 func SupervisorRereadUpdate() error {
+	if IsDryRun() {
+		RecordPlanStep("supervisorctl reread", "", "")
+		RecordPlanStep("supervisorctl update", "", "")
+		return nil
+	}
 	_, err := exec.Command("supervisorctl", "reread").Output()
 	if err != nil {
 		return errors.New("Error while supervisorctl reread: " + err.Error())
@@ -564,40 +673,37 @@ func SupervisorStart(programs []string) error {
 		return err
 	}
 	for _, prg := range programs {
+		if IsDryRun() {
+			RecordPlanStep("supervisorctl start", prg, "")
+			continue
+		}
 		_, err = exec.Command("supervisorctl", "start", prg).Output()
 		if err != nil {
 			return errors.New("Error while starting program: " + err.Error())
 		}
 	}
-
-	log.Info("Waiting 10 seconds to poll for status")
-	time.Sleep(10 * time.Second)
 	return nil
 }
 
-func SupervisorStatusBestEffort(programs []string, instanceID string) {
+func SupervisorStatusBestEffort(programs []string) {
+	if IsDryRun() {
+		return
+	}
 	status, err := exec.Command("supervisorctl", "status").Output()
-	if err != nil {
+	if err != nil && len(status) == 0 {
 		log.Warning("Error while reading supervisor status: " + err.Error())
 	} else {
 		var supervisorStatus = make(map[string]interface{})
 
-		programs_len := len(programs)
-		matchstr := ""
-		for idx, prg := range programs {
-			matchstr = matchstr + prg + "_" + instanceID
-			if idx != programs_len-1 {
-				matchstr = matchstr + "|"
-			}
-		}
-
 		statusLines := strings.Split(string(status), "\n")
 		var anyStatusLine = false
 		for _, v := range statusLines {
-			if match, err := regexp.MatchString(matchstr, v); err == nil && match {
-				vSplit := strings.Split(v, " ")
-				supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
-				anyStatusLine = true
+			vSplit := strings.Split(v, " ")
+			for _, prg := range programs {
+				if vSplit[0] == prg {
+					supervisorStatus[vSplit[0]] = strings.Trim(strings.Join(vSplit[1:], " "), " ")
+					anyStatusLine = true
+				}
 			}
 		}
 		if !anyStatusLine {
@@ -609,7 +715,106 @@ func SupervisorStatusBestEffort(programs []string, instanceID string) {
 	}
 }
 
+type SupervisorProgramInfo struct {
+	State  string
+	Pid    int
+	Uptime time.Duration
+}
+
+var supervisorUptimeRegex = regexp.MustCompile(`pid (\d+), uptime (?:(\d+) days?, )?(\d+):(\d+):(\d+)`)
+
+// SupervisorProgramInfos returns state reported by supervisor (RUNNING,
+// STARTING, BACKOFF, FATAL...) along with pid and uptime for each of given
+// programs known to supervisor.
+func SupervisorProgramInfos(programs []string) (map[string]SupervisorProgramInfo, error) {
+	status, err := exec.Command("supervisorctl", "status").Output()
+	if err != nil && len(status) == 0 {
+		return nil, errors.New("Error while reading supervisor status: " + err.Error())
+	}
+	infos := make(map[string]SupervisorProgramInfo)
+	for _, v := range strings.Split(string(status), "\n") {
+		vSplit := strings.Fields(v)
+		if len(vSplit) < 2 {
+			continue
+		}
+		for _, prg := range programs {
+			if vSplit[0] != prg {
+				continue
+			}
+			info := SupervisorProgramInfo{State: vSplit[1]}
+			if m := supervisorUptimeRegex.FindStringSubmatch(v); m != nil {
+				info.Pid, _ = strconv.Atoi(m[1])
+				days, _ := strconv.Atoi(m[2])
+				hours, _ := strconv.Atoi(m[3])
+				minutes, _ := strconv.Atoi(m[4])
+				seconds, _ := strconv.Atoi(m[5])
+				info.Uptime = time.Duration(days*86400+hours*3600+minutes*60+seconds) * time.Second
+			}
+			infos[prg] = info
+		}
+	}
+	return infos, nil
+}
+
+var supervisorSpawnRegex = regexp.MustCompile(`(?m)^(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d),\d+ \w+ spawned: '([^']+)'`)
+
+// SupervisorSpawnCount counts number of times supervisor has spawned a program
+// since a point in time as recorded in supervisord's log and its uncompressed
+// rotations. Returns -1 if no log could be read.
+func SupervisorSpawnCount(program string, since time.Time) int {
+	logs, _ := filepath.Glob("/var/log/supervisor/supervisord.log*")
+	count, read := 0, false
+	for _, l := range logs {
+		if strings.HasSuffix(l, ".gz") {
+			continue
+		}
+		data, err := ioutil.ReadFile(l)
+		if err != nil {
+			continue
+		}
+		read = true
+		for _, m := range supervisorSpawnRegex.FindAllStringSubmatch(string(data), -1) {
+			if m[2] != program {
+				continue
+			}
+			spawned, err := time.ParseInLocation("2006-01-02 15:04:05", m[1], time.Local)
+			if err == nil && !spawned.Before(since) {
+				count++
+			}
+		}
+	}
+	if !read {
+		return -1
+	}
+	return count
+}
+
+const SupervisorConfDir = "/etc/supervisor/conf.d"
+
+var supervisorProgramRegex = regexp.MustCompile(`(?m)^\[program:([^\]]+)\]`)
+
+// SupervisorConfPrograms maps supervisor programs to conf files defining them
+// in supervisor's include directory.
+func SupervisorConfPrograms() map[string]string {
+	confs := make(map[string]string)
+	files, _ := filepath.Glob(SupervisorConfDir + "/*.conf")
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		for _, m := range supervisorProgramRegex.FindAllStringSubmatch(string(data), -1) {
+			confs[m[1]] = f
+		}
+	}
+	return confs
+}
+
 func SupervisorRestartProgramBestEffort(exectype string, program string) {
+	if IsDryRun() {
+		RecordPlanStep("supervisorctl restart", program, "")
+		return
+	}
 	_, err1 := exec.Command("supervisorctl", "restart", program).Output()
 
 	if err1 == nil {
@@ -621,6 +826,12 @@ func SupervisorRestartProgramBestEffort(exectype string, program string) {
 
 func SupervisorStop(program []string) []error {
 	errors_vec := []error{}
+	if IsDryRun() {
+		for _, prg := range program {
+			RecordPlanStep("supervisorctl stop", prg, "")
+		}
+		return errors_vec
+	}
 	for _, prg := range program {
 		returned, err := exec.Command("supervisorctl", "stop", prg).Output()
 		if err != nil {
@@ -638,46 +849,3 @@ func SupervisorStop(program []string) []error {
 	time.Sleep(5 * time.Second)
 	return errors_vec
 }
-
-func LogTailer(program []string, instanceID string, lines int) error {
-	intrest_list := []string{}
-	for _, prg := range program {
-		intrest_list = append(intrest_list, prg+"_"+instanceID+"-stdout.*")
-		intrest_list = append(intrest_list, prg+"_"+instanceID+"-stderr.*")
-	}
-
-	fileSubscriptions := make(map[string]string)
-	var runner02logRootDir = "/var/log/supervisor/"
-	err := filepath.Walk(runner02logRootDir, func(path string, f os.FileInfo, _ error) error {
-		if !f.IsDir() {
-			for _, v := range intrest_list {
-				r, err := regexp.MatchString(v, f.Name())
-				if err == nil && r {
-					fileSubscriptions[v[:len(v)-2]] = runner02logRootDir + f.Name()
-				}
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		return nil
-	}
-
-	var wg sync.WaitGroup
-	for k, v := range fileSubscriptions {
-		wg.Add(1)
-		go func(filename string, filelocation string) {
-			seeklocation := GetFileSeekOffsetLastNLines(filelocation, lines)
-			t, err := tail.TailFile(filelocation, tail.Config{Location: &tail.SeekInfo{Offset: seeklocation}, Follow: true, Logger: tail.DiscardingLogger})
-			if err != nil {
-				fmt.Println(err)
-			}
-			for line := range t.Lines {
-				log.Info(fmt.Sprintf("[%20s] ", filename) + line.Text)
-			}
-			wg.Done()
-		}(k, v)
-	}
-	wg.Wait()
-	return nil
-}
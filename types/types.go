@@ -8,6 +8,17 @@ type Project struct {
 	Runtime        string
 	ForcedRuntime  bool
 	AdditionalInfo map[string]interface{}
+	LogPolicy      LogPolicy
+	ServiceUser    string
+}
+
+// LogPolicy holds log settings applied to resources created for a project,
+// empty fields fall back to marlinctl defaults.
+type LogPolicy struct {
+	Dir      string
+	MaxBytes string
+	Backups  string
+	Compress string
 }
 
 type Registry struct {